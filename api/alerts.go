@@ -0,0 +1,514 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"freeport/expr"
+)
+
+// BatterySource is the alert source that reads the battery percentage
+// instead of a method.
+const BatterySource = "system/battery"
+
+// AlertSource is the source of the alerts stored on a rule's notify method.
+const AlertSource = "alerts"
+
+const (
+	AlertOK       = "ok"
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+const (
+	DefaultAlertInterval = 5 * time.Second
+	// keepAlerts bounds how many past alerts are listed.
+	keepAlerts = 100
+)
+
+// AlertRule watches one source. A condition rule reads the source's latest
+// value as value, for example "value < 20" on the battery or
+// "value.temp > 80" on a method, and fires once the condition has held for
+// For. A stale rule fires when nothing has been stored on its method for
+// Stale. A rule has either a condition or Stale, not both.
+//
+// Alerts are listed at /alerts and, when set, stored as JSON on the Notify
+// method (app/method) and posted to the Webhook URL.
+type AlertRule struct {
+	Name      string
+	Source    string
+	Condition string
+	For       time.Duration
+	Stale     time.Duration
+	Notify    string
+	Webhook   string
+}
+
+type AlertRuleStatus struct {
+	Name      string      `json:"name"`
+	Source    string      `json:"source"`
+	Condition string      `json:"condition,omitempty"`
+	For       string      `json:"for,omitempty"`
+	Stale     string      `json:"stale,omitempty"`
+	State     string      `json:"state"`
+	Since     *time.Time  `json:"since,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+	LastError string      `json:"last_error,omitempty"`
+}
+
+// Alert is a rule starting or stopping to fire.
+type Alert struct {
+	ID      int64       `json:"id"`
+	Rule    string      `json:"rule"`
+	Source  string      `json:"source"`
+	State   string      `json:"state"`
+	Message string      `json:"message"`
+	Value   interface{} `json:"value,omitempty"`
+	Time    time.Time   `json:"time"`
+}
+
+type alertRule struct {
+	AlertRule
+	program *expr.Program
+	source  methodRef
+	notify  methodRef
+
+	state     string
+	since     time.Time
+	value     interface{}
+	lastError string
+}
+
+// Alerts evaluates alert rules against a registry every interval.
+type Alerts struct {
+	registry *Registry
+	interval time.Duration
+	battery  func() (int, error)
+	client   *http.Client
+	rules    []*alertRule
+	started  time.Time
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu          sync.Mutex
+	seq         int64
+	recent      []Alert
+	subscribers map[chan Alert]struct{}
+}
+
+// NewAlerts checks rules every interval, or DefaultAlertInterval if it is 0.
+func NewAlerts(registry *Registry, interval time.Duration) *Alerts {
+	if interval <= 0 {
+		interval = DefaultAlertInterval
+	}
+	return &Alerts{
+		registry:    registry,
+		interval:    interval,
+		battery:     GetBatteryPercentage,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		done:        make(chan struct{}),
+		subscribers: make(map[chan Alert]struct{}),
+	}
+}
+
+// AddRule must be called before Start.
+func (a *Alerts) AddRule(rule AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("alert rule without a name")
+	}
+	for _, existing := range a.rules {
+		if existing.Name == rule.Name {
+			return fmt.Errorf("alert %q: listed twice", rule.Name)
+		}
+	}
+
+	r := &alertRule{AlertRule: rule, state: AlertOK}
+	if rule.Source != BatterySource {
+		ref, ok := parseMethodRef(rule.Source)
+		if !ok {
+			return fmt.Errorf("alert %q: source %q is not app/method or %s", rule.Name, rule.Source, BatterySource)
+		}
+		r.source = ref
+	}
+
+	switch {
+	case rule.Condition != "" && rule.Stale > 0:
+		return fmt.Errorf("alert %q: a rule has either a condition or stale, not both", rule.Name)
+	case rule.Condition != "":
+		program, err := expr.Compile(rule.Condition, []string{"value"})
+		if err != nil {
+			return fmt.Errorf("alert %q: condition: %w", rule.Name, err)
+		}
+		r.program = program
+	case rule.Stale > 0:
+		if rule.Source == BatterySource {
+			return fmt.Errorf("alert %q: stale needs a method source", rule.Name)
+		}
+	default:
+		return fmt.Errorf("alert %q: a condition or stale is required", rule.Name)
+	}
+	if rule.For < 0 {
+		return fmt.Errorf("alert %q: for must not be negative", rule.Name)
+	}
+
+	if rule.Notify != "" {
+		ref, ok := parseMethodRef(rule.Notify)
+		if !ok {
+			return fmt.Errorf("alert %q: notify %q is not app/method", rule.Name, rule.Notify)
+		}
+		r.notify = ref
+	}
+	if rule.Webhook != "" {
+		u, err := url.Parse(rule.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("alert %q: invalid webhook %q", rule.Name, rule.Webhook)
+		}
+	}
+
+	a.rules = append(a.rules, r)
+	return nil
+}
+
+func parseMethodRef(s string) (methodRef, bool) {
+	app, method, ok := strings.Cut(s, "/")
+	if !ok || app == "" || method == "" || strings.Contains(method, "/") {
+		return methodRef{}, false
+	}
+	return methodRef{app, method}, true
+}
+
+func (a *Alerts) Start() {
+	a.started = time.Now()
+	a.wg.Add(1)
+	go a.run()
+}
+
+// Close stops evaluating and waits for webhooks in flight.
+func (a *Alerts) Close() {
+	close(a.done)
+	a.wg.Wait()
+}
+
+func (a *Alerts) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	a.evaluate(time.Now())
+	for {
+		select {
+		case <-a.done:
+			return
+		case now := <-ticker.C:
+			a.evaluate(now)
+		}
+	}
+}
+
+// evaluate checks every rule once. The battery is read at most once.
+func (a *Alerts) evaluate(now time.Time) {
+	var battery interface{}
+	var batteryErr error
+	batteryRead := false
+
+	for _, r := range a.rules {
+		var held bool
+		var value interface{}
+		var err error
+
+		switch {
+		case r.Stale > 0:
+			last := a.started
+			if stamp, ok := a.registry.lastStored(r.source.app, r.source.method); ok && stamp.After(last) {
+				last = stamp
+			}
+			value = last
+			held = now.Sub(last) >= r.Stale
+		case r.Source == BatterySource:
+			if !batteryRead {
+				percentage, readErr := a.battery()
+				battery, batteryErr, batteryRead = float64(percentage), readErr, true
+			}
+			value, err = battery, batteryErr
+			if err == nil {
+				held, err = r.check(value)
+			}
+		default:
+			data, ok := a.registry.GetData(r.source.app, r.source.method)
+			if !ok {
+				// Nothing to look at yet; the rule keeps its state.
+				a.record(r, func() { r.lastError = "" })
+				continue
+			}
+			if value, err = exprValue(data); err == nil {
+				held, err = r.check(value)
+			}
+		}
+
+		if err != nil {
+			a.record(r, func() { r.lastError = err.Error() })
+			continue
+		}
+		a.transition(r, held, value, now)
+	}
+}
+
+// check evaluates the rule's condition against value.
+func (r *alertRule) check(value interface{}) (bool, error) {
+	result, err := r.program.Eval(map[string]interface{}{"value": value})
+	if err != nil {
+		return false, err
+	}
+	held, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition gave %v, not true or false", result)
+	}
+	return held, nil
+}
+
+func (a *Alerts) record(r *alertRule, update func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	update()
+}
+
+func (a *Alerts) transition(r *alertRule, held bool, value interface{}, now time.Time) {
+	a.mu.Lock()
+	r.value = value
+	r.lastError = ""
+
+	var fired *Alert
+	switch {
+	case held && r.state == AlertOK:
+		r.since = now
+		r.state = AlertPending
+		if r.Stale > 0 || r.For == 0 {
+			r.state = AlertFiring
+			fired = a.newAlert(r, AlertFiring, now)
+		}
+	case held && r.state == AlertPending && now.Sub(r.since) >= r.For:
+		r.state = AlertFiring
+		r.since = now
+		fired = a.newAlert(r, AlertFiring, now)
+	case !held && r.state == AlertPending:
+		r.state = AlertOK
+		r.since = time.Time{}
+	case !held && r.state == AlertFiring:
+		r.state = AlertOK
+		r.since = time.Time{}
+		fired = a.newAlert(r, AlertResolved, now)
+	}
+	a.mu.Unlock()
+
+	if fired != nil {
+		a.dispatch(r, *fired)
+	}
+}
+
+// newAlert records an alert and hands it to subscribers. The caller holds
+// a.mu.
+func (a *Alerts) newAlert(r *alertRule, state string, now time.Time) *Alert {
+	a.seq++
+	alert := Alert{
+		ID:      a.seq,
+		Rule:    r.Name,
+		Source:  r.Source,
+		State:   state,
+		Message: r.message(state),
+		Value:   r.value,
+		Time:    now,
+	}
+
+	a.recent = append(a.recent, alert)
+	if len(a.recent) > keepAlerts {
+		a.recent = a.recent[len(a.recent)-keepAlerts:]
+	}
+	for ch := range a.subscribers {
+		select {
+		case ch <- alert:
+		default:
+		}
+	}
+	return &alert
+}
+
+func (r *alertRule) message(state string) string {
+	switch {
+	case r.Stale > 0 && state == AlertFiring:
+		return fmt.Sprintf("no data on %s for %s", r.Source, r.Stale)
+	case r.Stale > 0:
+		return fmt.Sprintf("data on %s again", r.Source)
+	case state == AlertFiring && r.For > 0:
+		return fmt.Sprintf("%s on %s for %s", r.Condition, r.Source, r.For)
+	case state == AlertFiring:
+		return fmt.Sprintf("%s on %s", r.Condition, r.Source)
+	}
+	return fmt.Sprintf("%s no longer holds on %s", r.Condition, r.Source)
+}
+
+// dispatch delivers an alert to the audit log, the rule's notify method and
+// its webhook.
+func (a *Alerts) dispatch(r *alertRule, alert Alert) {
+	kind := AuditAlertFired
+	if alert.State == AlertResolved {
+		kind = AuditAlertResolved
+	}
+	a.registry.RecordAudit(kind, r.source.app, r.source.method, r.Name+": "+alert.Message, AlertSource)
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+
+	if r.Notify != "" {
+		if !a.registry.MethodExists(r.notify.app, r.notify.method) {
+			a.record(r, func() { r.lastError = "notify method " + r.Notify + " not found" })
+		} else if a.registry.StoreData(r.notify.app, r.notify.method, AlertSource, json.RawMessage(body)) {
+			a.registry.publishWrite("ALERT", r.notify.app, r.notify.method, AlertSource, json.RawMessage(body), alert.Time)
+		}
+	}
+
+	if r.Webhook != "" {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			if err := a.post(r.Webhook, body); err != nil {
+				a.record(r, func() { r.lastError = "webhook: " + err.Error() })
+			}
+		}()
+	}
+}
+
+func (a *Alerts) post(webhook string, body []byte) error {
+	resp, err := a.client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// Subscribe returns a channel that receives every alert as it fires or
+// resolves. Alerts are dropped rather than holding up the rules when the
+// subscriber falls behind.
+func (a *Alerts) Subscribe(buffer int) (<-chan Alert, func()) {
+	ch := make(chan Alert, buffer)
+
+	a.mu.Lock()
+	a.subscribers[ch] = struct{}{}
+	a.mu.Unlock()
+
+	unsubscribe := func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if _, ok := a.subscribers[ch]; ok {
+			delete(a.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Rules reports each rule's state in the order they were added.
+func (a *Alerts) Rules() []AlertRuleStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	statuses := make([]AlertRuleStatus, 0, len(a.rules))
+	for _, r := range a.rules {
+		status := AlertRuleStatus{
+			Name:      r.Name,
+			Source:    r.Source,
+			Condition: r.Condition,
+			State:     r.state,
+			Value:     r.value,
+			LastError: r.lastError,
+		}
+		if r.For > 0 {
+			status.For = r.For.String()
+		}
+		if r.Stale > 0 {
+			status.Stale = r.Stale.String()
+		}
+		if !r.since.IsZero() {
+			since := r.since
+			status.Since = &since
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Recent lists past alerts, newest first.
+func (a *Alerts) Recent() []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alerts := make([]Alert, len(a.recent))
+	for i, alert := range a.recent {
+		alerts[len(a.recent)-1-i] = alert
+	}
+	return alerts
+}
+
+// lastStored is when the latest value on appName/methodName was written.
+func (reg *Registry) lastStored(appName, methodName string) (time.Time, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists {
+		stamp, ok := protocol.Stamps[methodName]
+		return stamp.Time, ok
+	}
+	return time.Time{}, false
+}
+
+// SetAlerts lists the rules and alerts of a at /alerts.
+func (s *Server) SetAlerts(a *Alerts) {
+	s.alerts = a
+}
+
+type AlertsResponse struct {
+	Response
+	Firing int               `json:"firing"`
+	Rules  []AlertRuleStatus `json:"rules"`
+	Alerts []Alert           `json:"alerts"`
+}
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if s.alerts == nil {
+		writeJSON(w, r, http.StatusOK, &AlertsResponse{Rules: []AlertRuleStatus{}, Alerts: []Alert{}})
+		return
+	}
+
+	rules := s.alerts.Rules()
+	firing := 0
+	for _, rule := range rules {
+		if rule.State == AlertFiring {
+			firing++
+		}
+	}
+	alerts := s.alerts.Recent()
+	if state := r.URL.Query().Get("state"); state != "" {
+		kept := []Alert{}
+		for _, alert := range alerts {
+			if alert.State == state {
+				kept = append(kept, alert)
+			}
+		}
+		alerts = kept
+	}
+	writeJSON(w, r, http.StatusOK, &AlertsResponse{Firing: firing, Rules: rules, Alerts: alerts})
+}
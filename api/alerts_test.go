@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestAlerts(t *testing.T, rule AlertRule) (*Registry, *Alerts) {
+	t.Helper()
+	reg := NewRegistry()
+	reg.RegisterProtocol("app", "key", "")
+	reg.RegisterMethod("app", "temp", "")
+	reg.RegisterMethod("app", "alerts", "")
+
+	a := NewAlerts(reg, 0)
+	if err := a.AddRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	return reg, a
+}
+
+func TestAlertTransitions(t *testing.T) {
+	type step struct {
+		at    time.Duration // since the rules started
+		store string        // stored on the source before evaluating, if set
+		state string        // the rule's state afterwards
+		alert string        // the state of the alert raised, if any
+	}
+
+	tests := []struct {
+		name  string
+		rule  AlertRule
+		steps []step
+	}{
+		{
+			"pending then firing after for",
+			AlertRule{Name: "hot", Source: "app/temp", Condition: "value > 80", For: 10 * time.Second},
+			[]step{
+				{0, "", AlertOK, ""},
+				{time.Second, "90", AlertPending, ""},
+				{5 * time.Second, "", AlertPending, ""},
+				{11 * time.Second, "", AlertFiring, AlertFiring},
+				{12 * time.Second, "", AlertFiring, ""},
+				{13 * time.Second, "70", AlertOK, AlertResolved},
+			},
+		},
+		{
+			"pending cleared before for",
+			AlertRule{Name: "hot", Source: "app/temp", Condition: "value > 80", For: 10 * time.Second},
+			[]step{
+				{time.Second, "90", AlertPending, ""},
+				{2 * time.Second, "70", AlertOK, ""},
+				{3 * time.Second, "90", AlertPending, ""},
+				{12 * time.Second, "", AlertPending, ""},
+				{13 * time.Second, "", AlertFiring, AlertFiring},
+			},
+		},
+		{
+			"no for fires at once",
+			AlertRule{Name: "hot", Source: "app/temp", Condition: "value > 80"},
+			[]step{
+				{0, "90", AlertFiring, AlertFiring},
+				{time.Second, "70", AlertOK, AlertResolved},
+			},
+		},
+		{
+			"stale counts from started",
+			AlertRule{Name: "quiet", Source: "app/temp", Stale: 30 * time.Second},
+			[]step{
+				{29 * time.Second, "", AlertOK, ""},
+				{30 * time.Second, "", AlertFiring, AlertFiring},
+				{31 * time.Second, "", AlertFiring, ""},
+				// Stored values carry the real clock, a minute after start.
+				{61 * time.Second, "1", AlertOK, AlertResolved},
+			},
+		},
+		{
+			"battery",
+			AlertRule{Name: "low", Source: BatterySource, Condition: "value < 20"},
+			[]step{
+				{0, "50", AlertOK, ""},
+				{time.Second, "15", AlertFiring, AlertFiring},
+				{2 * time.Second, "25", AlertOK, AlertResolved},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, a := newTestAlerts(t, tt.rule)
+			battery := 100
+			a.battery = func() (int, error) { return battery, nil }
+			start := time.Now().Add(-time.Minute)
+			a.started = start
+
+			for _, s := range tt.steps {
+				if s.store != "" {
+					if tt.rule.Source == BatterySource {
+						battery, _ = strconv.Atoi(s.store)
+					} else {
+						reg.StoreData("app", "temp", "test", json.RawMessage(s.store))
+					}
+				}
+				before := len(a.Recent())
+				a.evaluate(start.Add(s.at))
+
+				if state := a.Rules()[0].State; state != s.state {
+					t.Fatalf("at %v: state %s, want %s", s.at, state, s.state)
+				}
+				recent := a.Recent()
+				switch {
+				case s.alert == "" && len(recent) != before:
+					t.Fatalf("at %v: unexpected alert %+v", s.at, recent[0])
+				case s.alert != "" && (len(recent) != before+1 || recent[0].State != s.alert):
+					t.Fatalf("at %v: alerts %+v, want a new %s alert", s.at, recent, s.alert)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertDispatch(t *testing.T) {
+	posted := make(chan Alert, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &alert)
+		posted <- alert
+	}))
+	defer webhook.Close()
+
+	reg, a := newTestAlerts(t, AlertRule{
+		Name:      "hot",
+		Source:    "app/temp",
+		Condition: "value > 80",
+		Notify:    "app/alerts",
+		Webhook:   webhook.URL,
+	})
+	reg.StoreData("app", "temp", "test", json.RawMessage(`90`))
+	a.evaluate(time.Now())
+	a.Close()
+
+	data, ok := reg.GetData("app", "alerts")
+	if !ok {
+		t.Fatal("nothing stored on the notify method")
+	}
+	var stored Alert
+	if err := json.Unmarshal(data.(json.RawMessage), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Rule != "hot" || stored.State != AlertFiring || stored.Value != float64(90) {
+		t.Errorf("stored alert = %+v", stored)
+	}
+	if history, _ := reg.GetHistory("app", "alerts", 10); len(history) != 1 || history[0].Source != AlertSource {
+		t.Errorf("notify history = %+v, want one entry from %s", history, AlertSource)
+	}
+
+	select {
+	case alert := <-posted:
+		if alert.ID != stored.ID {
+			t.Errorf("webhook got alert %d, want %d", alert.ID, stored.ID)
+		}
+	default:
+		t.Error("webhook was not called")
+	}
+
+	events := reg.RecentAuditLog(10)
+	if len(events) == 0 || events[len(events)-1].Kind != AuditAlertFired {
+		t.Errorf("audit log = %+v, want an alert_fired event", events)
+	}
+}
+
+func TestAlertDispatchMissingNotify(t *testing.T) {
+	reg, a := newTestAlerts(t, AlertRule{Name: "hot", Source: "app/temp", Condition: "value > 80", Notify: "app/missing"})
+	reg.StoreData("app", "temp", "test", json.RawMessage(`90`))
+	a.evaluate(time.Now())
+
+	if status := a.Rules()[0]; status.State != AlertFiring || status.LastError == "" {
+		t.Errorf("rule = %+v, want firing with an error about the notify method", status)
+	}
+}
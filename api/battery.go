@@ -6,8 +6,32 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// batteryCacheTTL is how long cachedBatteryPercentage reuses a reading.
+const batteryCacheTTL = 30 * time.Second
+
+var batteryCache struct {
+	sync.Mutex
+	percent int
+	err     error
+	at      time.Time
+}
+
+// cachedBatteryPercentage is GetBatteryPercentage without starting a
+// process on every call, for callers such as metrics scrapes that ask often.
+func cachedBatteryPercentage() (int, error) {
+	batteryCache.Lock()
+	defer batteryCache.Unlock()
+	if time.Since(batteryCache.at) > batteryCacheTTL {
+		batteryCache.percent, batteryCache.err = GetBatteryPercentage()
+		batteryCache.at = time.Now()
+	}
+	return batteryCache.percent, batteryCache.err
+}
+
 func GetBatteryPercentage() (int, error) {
 	switch runtime.GOOS {
 	case "darwin": // mac
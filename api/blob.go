@@ -0,0 +1,137 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var errNoFilePart = errors.New("multipart body has no file part")
+
+type Blob struct {
+	ContentType string `json:"content_type"`
+	Filename    string `json:"filename,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	Bytes       []byte `json:"-"`
+}
+
+func newBlob(contentType, filename string, data []byte) *Blob {
+	sum := sha256.Sum256(data)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &Blob{
+		ContentType: contentType,
+		Filename:    filename,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		Bytes:       data,
+	}
+}
+
+func (b *Blob) IsText() bool {
+	mediaType, _, _ := mime.ParseMediaType(b.ContentType)
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/yaml", "application/x-ndjson":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// Preview returns up to n characters of a text blob on a single line.
+func (b *Blob) Preview(n int) string {
+	if !b.IsText() || !utf8.Valid(b.Bytes) {
+		return ""
+	}
+	text := strings.Join(strings.Fields(string(b.Bytes)), " ")
+	if utf8.RuneCountInString(text) > n {
+		return string([]rune(text)[:n]) + "…"
+	}
+	return text
+}
+
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+// isJSONContent reports whether a POST body should be decoded as JSON. Bodies
+// without a content type and curl's default form encoding are treated as JSON
+// so existing clients keep working.
+func isJSONContent(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" ||
+		mediaType == "application/x-www-form-urlencoded" ||
+		strings.HasSuffix(mediaType, "+json")
+}
+
+func readBlob(w http.ResponseWriter, r *http.Request, limit int64) (*Blob, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return newBlob(r.Header.Get("Content-Type"), r.Header.Get("X-Filename"), data), nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errNoFilePart
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		data, err := io.ReadAll(part)
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+		return newBlob(part.Header.Get("Content-Type"), part.FileName(), data), nil
+	}
+}
+
+func serveBlob(w http.ResponseWriter, blob *Blob) {
+	w.Header().Set("Content-Type", blob.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(blob.Size, 10))
+	w.Header().Set("X-Content-SHA256", blob.SHA256)
+	if blob.Filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": blob.Filename}))
+	}
+	w.Write(blob.Bytes)
+}
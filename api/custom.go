@@ -1,8 +1,11 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -15,77 +18,332 @@ type CustomProtocol struct {
 	Methods map[string]string
 	Data map[string]interface{}
 	History map[string][]DataEntry
+	Queues map[string]*Queue
+	Offsets map[string]int64
+	Groups map[string]map[string]int64
+	Stamps map[string]Stamp
+	Expires map[string]time.Time
+	Keys map[string]map[string]*keyed
+	Schemas map[string]*Schema
+	Retention Retention
+	MethodRetention map[string]Retention
+	Derived map[string]*derived
+	Limits *Limits
+}
+
+const defaultHistory = 100
+
+// Retention bounds how much history a method keeps and how long its latest
+// value stays current. A method without its own falls back to the
+// protocol's, then to the default of 100 entries and values that never
+// expire. TTL is a duration such as "30s" or "5m".
+type Retention struct {
+	History int `json:"history,omitempty"`
+	TTL string `json:"ttl,omitempty"`
+}
+
+func (protocol *CustomProtocol) historyLimit(methodName string) int {
+	if limit := protocol.MethodRetention[methodName].History; limit > 0 {
+		return limit
+	}
+	if protocol.Retention.History > 0 {
+		return protocol.Retention.History
+	}
+	return defaultHistory
+}
+
+// ttl is how long a new latest value on methodName stays current, or 0 if
+// it never expires. Retention is checked before it is stored, so a TTL
+// that does not parse here was never accepted.
+func (protocol *CustomProtocol) ttl(methodName string) time.Duration {
+	if ttl, _ := protocol.MethodRetention[methodName].ttl(); ttl > 0 {
+		return ttl
+	}
+	ttl, _ := protocol.Retention.ttl()
+	return ttl
 }
 
 type DataEntry struct {
-	Data interface{}
-	Timestamp time.Time
-	Source string
+	Offset int64 `json:"offset"`
+	Data interface{} `json:"data"`
+	Timestamp time.Time `json:"timestamp"`
+	Source string `json:"source"`
 }
 
-var (
-	protocols = make(map[string]*CustomProtocol)
+// Registry holds the protocols served by a bus. The package-level functions
+// such as RegisterProtocol work on a default registry that every Server uses
+// unless it is given its own with SetRegistry.
+type Registry struct {
+	protocols map[string]*CustomProtocol
 	mu sync.RWMutex
-)
+	node string
+	watchers []func(StoreEvent)
+	replays []*replay
+	replaySeq int
+	generators map[string]*generator
+	reaper sync.Once
+	limits *limiter
+	metrics *metrics
+	logs *logs
+	traffic *trafficFeed
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		protocols: make(map[string]*CustomProtocol),
+		limits: newLimiter(),
+		metrics: newMetrics(),
+		logs: newLogs(),
+		traffic: newTrafficFeed(),
+	}
+}
+
+var defaultRegistry = NewRegistry()
+
+// Stamp records when and on which node a value was first written. Values
+// mirrored from other instances keep their original stamp so every node
+// settles on the same latest value whatever order they arrive in.
+type Stamp struct {
+	Time time.Time
+	Node string
+}
 
-func RegisterProtocol(appName, passkey, description string) {
-	mu.Lock()
-	defer mu.Unlock()
-	protocols[appName] = &CustomProtocol{
+// nextStamp stamps a write made on node that replaces the value stamped
+// current. Local stamps only move forward, so two writes in the same clock
+// tick still get different revisions, and a write made just after a value
+// mirrored from a node whose clock runs ahead still becomes the latest.
+func nextStamp(node string, current Stamp) Stamp {
+	stamp := Stamp{Time: time.Now().Round(0), Node: node}
+	if !stamp.After(current) {
+		stamp.Time = current.Time.Add(time.Nanosecond)
+	}
+	return stamp
+}
+
+// After orders stamps by time, breaking ties on the node name.
+func (a Stamp) After(b Stamp) bool {
+	if !a.Time.Equal(b.Time) {
+		return a.Time.After(b.Time)
+	}
+	return a.Node > b.Node
+}
+
+// StoreEvent describes a value that has just been stored. Path lists the
+// nodes the value passed through before this one, starting with its origin.
+type StoreEvent struct {
+	App string
+	Method string
+	Source string
+	Data interface{}
+	Stamp Stamp
+	Path []string
+	// TTL is the time to live the write asked for; 0 leaves it to the
+	// method's retention.
+	TTL time.Duration
+}
+
+// SetNode names this registry's instance in the stamps of local writes.
+func (reg *Registry) SetNode(node string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.node = node
+}
+
+func (reg *Registry) Node() string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.node
+}
+
+// Watch calls fn after every successful store. fn runs on the storing
+// goroutine and must not block.
+func (reg *Registry) Watch(fn func(StoreEvent)) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.watchers = append(reg.watchers, fn)
+}
+
+// newProtocol makes an empty protocol with the limits configured for its
+// name. Every way of creating a protocol goes through it.
+func (reg *Registry) newProtocol(appName, passkey, description string) *CustomProtocol {
+	protocol := &CustomProtocol{
 		AppName: appName,
 		Passkey: passkey,
 		Description: description,
 		Methods: make(map[string]string),
 		Data: make(map[string]interface{}),
 		History: make(map[string][]DataEntry),
+		Queues: make(map[string]*Queue),
+		Offsets: make(map[string]int64),
+		Groups: make(map[string]map[string]int64),
+		Stamps: make(map[string]Stamp),
+		Expires: make(map[string]time.Time),
+		Keys: make(map[string]map[string]*keyed),
+		Schemas: make(map[string]*Schema),
+		MethodRetention: make(map[string]Retention),
+		Derived: make(map[string]*derived),
+		Limits: reg.configuredLimits(appName),
+	}
+	protocol.Methods["init"] = "Initialize connection"
+	return protocol
+}
+
+func (reg *Registry) RegisterProtocol(appName, passkey, description string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.protocols[appName] = reg.newProtocol(appName, passkey, description)
+	reg.RecordAudit(AuditProtocolCreated, appName, "", description, "")
+}
+
+// ErrProtocolExists is returned by CreateProtocol when appName is taken.
+var ErrProtocolExists = errors.New("protocol already exists")
+
+// CreateProtocol is RegisterProtocol for a name that must be new, with its
+// methods added in the same step so that two creators cannot both succeed.
+func (reg *Registry) CreateProtocol(appName, passkey, description string, methods []MethodInfo) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, exists := reg.protocols[appName]; exists {
+		return ErrProtocolExists
+	}
+	protocol := reg.newProtocol(appName, passkey, description)
+	for _, method := range methods {
+		if method.Name != "" {
+			protocol.Methods[method.Name] = method.Description
+		}
 	}
-	protocols[appName].Methods["init"] = "Initialize connection"
+	reg.protocols[appName] = protocol
+	reg.RecordAudit(AuditProtocolCreated, appName, "", description, "")
+	return nil
 }
 
-func RegisterMethod(appName, methodName, description string) {
-	mu.Lock()
-	defer mu.Unlock()
-	if protocol, exists := protocols[appName]; exists {
+func (reg *Registry) UnregisterProtocol(appName string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, exists := reg.protocols[appName]; !exists {
+		return false
+	}
+	delete(reg.protocols, appName)
+	reg.stopGenerators(appName)
+	reg.stopReplays(appName)
+	reg.RecordAudit(AuditProtocolDeleted, appName, "", "", "")
+	return true
+}
+
+func (reg *Registry) RegisterMethod(appName, methodName, description string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if protocol, exists := reg.protocols[appName]; exists {
 		protocol.Methods[methodName] = description
 	}
 }
 
-func StoreData(appName, methodName, source string, data interface{}) bool {
-	mu.Lock()
-	defer mu.Unlock()
-	if protocol, exists := protocols[appName]; exists {
-		protocol.Data[methodName] = data
+func (reg *Registry) StoreData(appName, methodName, source string, data interface{}) bool {
+	stored, _ := reg.store(appName, methodName, source, data, Stamp{}, nil)
+	return stored
+}
 
-		entry := DataEntry{
-			Data: data,
-			Timestamp: time.Now(),
-			Source: source,
-		}
-		protocol.History[methodName] = append(protocol.History[methodName], entry)
+// StoreReplica stores a value mirrored from another instance. It is added to
+// the history and queue like any other write, but only becomes the latest
+// value if its stamp is newer than the current one; latest reports whether
+// it did. stored is false if the protocol is gone or the value is already
+// the latest one, having arrived by another route. ttl is the one the
+// original write asked for, counted from the stamp.
+func (reg *Registry) StoreReplica(appName, methodName, source string, data interface{}, stamp Stamp, path []string, ttl time.Duration) (stored, latest bool) {
+	_, stored, latest, _ = reg.storeIf(appName, methodName, source, data, stamp, path, ttl, nil)
+	return stored, latest
+}
 
-		if len(protocol.History[methodName]) > 100 {
-			protocol.History[methodName] = protocol.History[methodName][1:]
+// store writes data with stamp, or with a new local stamp if stamp is the
+// zero Stamp.
+func (reg *Registry) store(appName, methodName, source string, data interface{}, stamp Stamp, path []string) (bool, bool) {
+	_, stored, latest, _ := reg.storeIf(appName, methodName, source, data, stamp, path, 0, nil)
+	return stored, latest
+}
+
+// storeIf is store with the time the value stays current and a condition
+// on the current value, checked under the same lock as the write. A ttl of
+// 0 uses the method's retention; a nil cond always holds. It returns the
+// stamp the value was stored with.
+func (reg *Registry) storeIf(appName, methodName, source string, data interface{}, stamp Stamp, path []string, ttl time.Duration, cond *Precondition) (Stamp, bool, bool, error) {
+	reg.mu.Lock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		reg.mu.Unlock()
+		return Stamp{}, false, false, nil
+	}
+	if cond != nil && !cond.holds(protocol.revision(methodName, time.Now())) {
+		reg.mu.Unlock()
+		return Stamp{}, false, false, ErrPreconditionFailed
+	}
+	if stamp == (Stamp{}) {
+		stamp = nextStamp(reg.node, protocol.Stamps[methodName])
+	}
+
+	requested := ttl
+	latest := true
+	if current, ok := protocol.Stamps[methodName]; ok {
+		if current.Node == stamp.Node && current.Time.Equal(stamp.Time) {
+			// The same write reached us over a second route.
+			reg.mu.Unlock()
+			return Stamp{}, false, false, nil
+		}
+		latest = stamp.After(current)
+	}
+	if latest {
+		protocol.Data[methodName] = data
+		protocol.Stamps[methodName] = stamp
+		if ttl == 0 {
+			ttl = protocol.ttl(methodName)
 		}
+		if ttl > 0 {
+			protocol.Expires[methodName] = stamp.Time.Add(ttl)
+		} else {
+			delete(protocol.Expires, methodName)
+		}
+	}
+	protocol.Offsets[methodName]++
 
-		return true
+	entry := DataEntry{
+		Offset: protocol.Offsets[methodName],
+		Data: data,
+		Timestamp: stamp.Time,
+		Source: source,
 	}
-	return false
+	protocol.History[methodName] = append(protocol.History[methodName], entry)
+
+	if limit := protocol.historyLimit(methodName); len(protocol.History[methodName]) > limit {
+		protocol.History[methodName] = protocol.History[methodName][len(protocol.History[methodName])-limit:]
+	}
+
+	if q, ok := protocol.Queues[methodName]; ok {
+		q.enqueue(data, source)
+	}
+
+	watchers := reg.watchers
+	reg.mu.Unlock()
+
+	event := StoreEvent{App: appName, Method: methodName, Source: source, Data: data, Stamp: stamp, Path: path, TTL: requested}
+	for _, fn := range watchers {
+		fn(event)
+	}
+	reg.propagate(event)
+	return stamp, true, latest, nil
 }
 
-func GetData(appName, methodName string) (interface{}, bool) {
-	mu.RLock()
-	defer mu.RUnlock()
-	if protocol, exists := protocols[appName]; exists {
-		data, ok := protocol.Data[methodName]
-		return data, ok
+func (reg *Registry) GetData(appName, methodName string) (interface{}, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists {
+		return protocol.current(methodName, time.Now())
 	}
 	return nil, false
 }
 
-func GetHistory(appName, methodName string, limit int) ([]DataEntry, bool) {
-	mu.RLock()
-	defer mu.RUnlock()
-	if protocol, exists := protocols[appName]; exists {
+func (reg *Registry) GetHistory(appName, methodName string, limit int) ([]DataEntry, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists {
 		history, ok := protocol.History[methodName]
 		if !ok {
 			return nil, false
@@ -100,179 +358,397 @@ func GetHistory(appName, methodName string, limit int) ([]DataEntry, bool) {
 	return nil, false
 }
 
-func ClearData(appName, methodName string) bool {
-	mu.Lock()
-	defer mu.Unlock()
-	if protocol, exists := protocols[appName]; exists {
+func (reg *Registry) ClearData(appName, methodName string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if protocol, exists := reg.protocols[appName]; exists {
 		delete(protocol.Data, methodName)
 		delete(protocol.History, methodName)
+		delete(protocol.Stamps, methodName)
+		delete(protocol.Expires, methodName)
+		delete(protocol.Keys, methodName)
+		reg.RecordAudit(AuditDataCleared, appName, methodName, "", "")
 		return true
 	}
 	return false
 }
 
-func ValidateProtocol(appName, passkey string) bool {
-	mu.RLock()
-	defer mu.RUnlock()
-	protocol, exists := protocols[appName]
+func (reg *Registry) ValidateProtocol(appName, passkey string) bool {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	protocol, exists := reg.protocols[appName]
 	if !exists {
 		return false
 	}
 	return protocol.Passkey == passkey
 }
 
-func MethodExists(appName, methodName string) bool {
-	mu.RLock()
-	defer mu.RUnlock()
-	if protocol, exists := protocols[appName]; exists {
+func (reg *Registry) ProtocolExists(appName string) bool {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	_, exists := reg.protocols[appName]
+	return exists
+}
+
+// MethodSchema returns the schema payloads to the method must match, or nil.
+func (reg *Registry) MethodSchema(appName, methodName string) *Schema {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists {
+		return protocol.Schemas[methodName]
+	}
+	return nil
+}
+
+func (reg *Registry) MethodExists(appName, methodName string) bool {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists {
 		_, methodExists := protocol.Methods[methodName]
 		return methodExists
 	}
 	return false
 }
 
-func (s *Server) handleCustomInit(w http.ResponseWriter, r *http.Request, appName string) {
-	headerAppName := r.Header.Get("X-App-Name")
-	headerPasskey := r.Header.Get("X-Passkey")
+// readJSON reads a single JSON value of any type. The raw bytes are kept
+// verbatim so large numbers survive the round trip; the decoded value uses
+// json.Number for the same reason.
+func readJSON(body io.Reader) (json.RawMessage, interface{}, error) {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if headerAppName != appName {
-		http.Error(w, "App name mismatch", http.StatusBadRequest)
-		return
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, nil, fmt.Errorf("unexpected data after JSON value")
 	}
 
-	if !ValidateProtocol(appName, headerPasskey) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+	return json.RawMessage(bytes.TrimSpace(raw)), value, nil
+}
+
+type InitResponse struct {
+	Response
+	AppName string `json:"app_name"`
+	Message string `json:"message"`
+	Time    string `json:"time"`
+}
+
+type StoreResponse struct {
+	Response
+	AppName     string `json:"app_name"`
+	Method      string `json:"method"`
+	Key         string `json:"key,omitempty"`
+	Message     string `json:"message"`
+	Timestamp   string `json:"timestamp"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	Revision    string `json:"revision"`
+	Expires     string `json:"expires,omitempty"`
+}
+
+// ValueResponse carries the latest value on a method. Stale is set when an
+// expired value was asked for with ?stale=true.
+type ValueResponse struct {
+	Response
+	AppName    string      `json:"app_name"`
+	Method     string      `json:"method"`
+	Key        string      `json:"key,omitempty"`
+	Data       interface{} `json:"data"`
+	Time       string      `json:"time"`
+	Stored     string      `json:"stored"`
+	Revision   string      `json:"revision"`
+	AgeSeconds int64       `json:"age_seconds"`
+	Expires    string      `json:"expires,omitempty"`
+	Stale      bool        `json:"stale,omitempty"`
+}
+
+// NoDataResponse answers a GET on an unversioned path when nothing is
+// stored; /v1 returns a no_data error instead.
+type NoDataResponse struct {
+	Response
+	AppName string `json:"app_name"`
+	Method  string `json:"method"`
+	Message string `json:"message"`
+	Time    string `json:"time"`
+}
+
+// legacyEntry is a history entry as the unversioned paths have always
+// written it, keyed by the Go field names.
+type legacyEntry struct {
+	Data      interface{}
+	Timestamp time.Time
+	Source    string
+}
+
+type legacyHistoryResponse struct {
+	Response
+	AppName string        `json:"app_name"`
+	Method  string        `json:"method"`
+	Count   int           `json:"count"`
+	History []legacyEntry `json:"history"`
+}
+
+type HistoryResponse struct {
+	Response
+	AppName string      `json:"app_name"`
+	Method  string      `json:"method"`
+	Key     string      `json:"key,omitempty"`
+	Count   int         `json:"count"`
+	History []DataEntry `json:"history"`
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, appName string) bool {
+	if r.Header.Get("X-App-Name") != appName {
+		writeError(w, r, http.StatusBadRequest, CodeAppMismatch, "App name mismatch")
+		return false
+	}
+
+	if inProcess(r) && s.registry.ProtocolExists(appName) {
+		return true
+	}
+	if s.peerTrusted(r) && s.registry.ProtocolExists(appName) {
+		return s.allowRequest(w, r, appName)
 	}
 
-	response := map[string]interface{}{
-		"message": "Hello, World!",
-		"app_name": appName,
-		"status": "initialized",
-		"time": time.Now().Format(time.RFC3339),
+	if !s.registry.ValidateProtocol(appName, r.Header.Get("X-Passkey")) {
+		if !s.allowFailedAuth(w, r, appName) {
+			return false
+		}
+		s.registry.RecordAudit(AuditAuthFailed, appName, "", r.Method+" "+r.URL.Path, remoteAddr(r))
+		s.registry.metrics.recordAuthFailure(s.registry.metricsApp(appName))
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+		return false
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	return s.allowRequest(w, r, appName)
 }
 
-func (s *Server) handleCustomMethod(w http.ResponseWriter, r *http.Request, appName, methodName string) {
-	headerAppName := r.Header.Get("X-App-Name")
-	headerPasskey := r.Header.Get("X-Passkey")
-
-	if headerAppName != appName {
-		http.Error(w, "App name mismatch", http.StatusBadRequest)
+func (s *Server) handleCustomInit(w http.ResponseWriter, r *http.Request, appName string) {
+	if !s.authorize(w, r, appName) {
 		return
 	}
 
-	if !ValidateProtocol(appName, headerPasskey) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	writeJSON(w, r, http.StatusOK, &InitResponse{
+		AppName: appName,
+		Message: "Hello, World!",
+		Time:    time.Now().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) handleCustomMethod(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	if !s.authorize(w, r, appName) {
 		return
 	}
 
-	if !MethodExists(appName, methodName) {
-		http.Error(w, "Method not found", http.StatusNotFound)
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
 		return
 	}
 
 	if r.Method == http.MethodPost {
-		var requestData map[string]interface{}
-		
-		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if s.registry.IsDerived(appName, methodName) {
+			writeError(w, r, http.StatusConflict, CodeConflict, "Method is derived from other methods and cannot be written to")
 			return
 		}
 
-		source := headerAppName
-		if src, ok := requestData["source"]; ok {
-			source = fmt.Sprintf("%v", src)
+		ttl, err := requestTTL(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, err.Error())
+			return
 		}
 
-		if StoreData(appName, methodName, source, requestData) {
-			response := map[string]interface{}{
-				"status":    "success",
-				"message":   "Data stored successfully",
-				"app_name":  appName,
-				"method":    methodName,
-				"timestamp": time.Now().Format(time.RFC3339),
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		} else {
-			http.Error(w, "Failed to store data", http.StatusInternalServerError)
+		payload, source, ok := s.readPayload(w, r, appName, isJSONContent(r.Header.Get("Content-Type")))
+		if !ok || !s.checkSchema(w, r, appName, methodName, payload) {
+			return
+		}
+
+		revision, err := s.registry.StoreDataIf(appName, methodName, source, payload, ttl, requestPrecondition(r))
+		if errors.Is(err, ErrPreconditionFailed) {
+			current, _ := s.registry.Revision(appName, methodName)
+			writePreconditionFailed(w, r, current)
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to store data")
+			return
 		}
+
+		response := &StoreResponse{
+			AppName:   appName,
+			Method:    methodName,
+			Message:   "Data stored successfully",
+			Timestamp: time.Now().Format(time.RFC3339),
+			Revision:  revision,
+		}
+		if value, ok := s.registry.Value(appName, methodName); ok && value.Revision == revision && !value.Expires.IsZero() {
+			response.Expires = value.Expires.Format(time.RFC3339)
+		}
+		w.Header().Set("ETag", etag(revision))
+		if blob, ok := payload.(*Blob); ok {
+			response.ContentType = blob.ContentType
+			response.Size = blob.Size
+			response.SHA256 = blob.SHA256
+		}
+		writeJSON(w, r, http.StatusOK, response)
 		return
 	}
 
 	if r.Method == http.MethodGet {
-		data, exists := GetData(appName, methodName)
-		
-		response := map[string]interface{}{
-			"app_name": appName,
-			"method":   methodName,
-			"time":     time.Now().Format(time.RFC3339),
+		value, exists := s.registry.Value(appName, methodName)
+		if unversioned(r) && (!exists || value.Expired(time.Now()) && r.URL.Query().Get("stale") != "true") {
+			writeJSON(w, r, http.StatusOK, &NoDataResponse{
+				Response: Response{Status: "no_data"},
+				AppName:  appName,
+				Method:   methodName,
+				Message:  "No data available",
+				Time:     time.Now().Format(time.RFC3339),
+			})
+			return
 		}
-
-		if exists {
-			response["data"] = data
-			response["status"] = "success"
-		} else {
-			response["message"] = "No data available"
-			response["status"] = "no_data"
+		if !exists {
+			writeError(w, r, http.StatusNotFound, CodeNoData, "No data available")
+			return
 		}
+		writeValue(w, r, value, ValueResponse{AppName: appName, Method: methodName})
+		return
+	}
+
+	if !s.registry.ClearData(appName, methodName) {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to clear data")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, &MessageResponse{
+		AppName: appName,
+		Method:  methodName,
+		Message: "Data cleared successfully",
+	})
+}
+
+// writeValue answers a GET for the current value of a method or of one of
+// its keys. base names what was asked for.
+func writeValue(w http.ResponseWriter, r *http.Request, value Value, base ValueResponse) {
+	now := time.Now()
+	age := now.Sub(value.Stored)
+	stale := value.Expired(now)
+	if stale && r.URL.Query().Get("stale") != "true" {
+		writeErrorDetails(w, r, http.StatusNotFound, CodeNoData, "Value expired", map[string]interface{}{
+			"expired_at":  value.Expires.Format(time.RFC3339),
+			"age_seconds": int64(age / time.Second),
+		})
+		return
+	}
+	setValueHeaders(w, value, age, stale)
+	if tags := parseETags(r.Header.Get("If-None-Match")); tags != nil && matchRevision(tags, value.Revision) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if blob, ok := value.Data.(*Blob); ok && r.URL.Query().Get("format") != "json" {
+		serveBlob(w, blob)
+		return
+	}
 
+	if raw, ok := value.Data.(json.RawMessage); ok && r.URL.Query().Get("format") == "raw" {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+		w.Write(raw)
 		return
 	}
 
-	if r.Method == http.MethodDelete {
-		if ClearData(appName, methodName) {
-			response := map[string]interface{}{
-				"status":   "success",
-				"message":  "Data cleared successfully",
-				"app_name": appName,
-				"method":   methodName,
+	response := base
+	response.Data = value.Data
+	response.Time = now.Format(time.RFC3339)
+	response.Stored = value.Stored.Format(time.RFC3339)
+	response.Revision = value.Revision
+	response.AgeSeconds = int64(age / time.Second)
+	response.Stale = stale
+	if !value.Expires.IsZero() {
+		response.Expires = value.Expires.Format(time.RFC3339)
+	}
+	writeJSON(w, r, http.StatusOK, &response)
+}
+
+// readPayload reads a POST body as a JSON value or as a blob and works out
+// its source. It writes the error response itself and reports false if the
+// body could not be read.
+func (s *Server) readPayload(w http.ResponseWriter, r *http.Request, appName string, asJSON bool) (interface{}, string, bool) {
+	source := appName
+	limit := s.registry.GetLimits(appName).MaxPayload
+
+	if asJSON {
+		raw, requestData, err := readJSON(http.MaxBytesReader(w, r.Body, limit))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				s.rejectTooLarge(w, r, appName, limit)
+			} else {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
 			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
+			return nil, "", false
+		}
+
+		if object, ok := requestData.(map[string]interface{}); ok {
+			if src, ok := object["source"]; ok {
+				source = fmt.Sprintf("%v", src)
+			}
+		}
+		return raw, source, true
+	}
+
+	blob, err := readBlob(w, r, limit)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			s.rejectTooLarge(w, r, appName, limit)
 		} else {
-			http.Error(w, "Failed to clear data", http.StatusInternalServerError)
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid payload")
 		}
-		return
+		return nil, "", false
 	}
 
-	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if src := r.Header.Get("X-Source"); src != "" {
+		source = src
+	}
+	return blob, source, true
 }
 
 func (s *Server) handleCustomHistory(w http.ResponseWriter, r *http.Request, appName, methodName string) {
-	headerAppName := r.Header.Get("X-App-Name")
-	headerPasskey := r.Header.Get("X-Passkey")
-
-	if headerAppName != appName {
-		http.Error(w, "App name mismatch", http.StatusBadRequest)
-		return
-	}
-
-	if !ValidateProtocol(appName, headerPasskey) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !s.authorize(w, r, appName) {
 		return
 	}
 
-	history, exists := GetHistory(appName, methodName, 10)
+	history, exists := s.registry.GetHistory(appName, methodName, 10)
 
 	if !exists {
-		http.Error(w, "No history available", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, CodeNoData, "No history available")
 		return
 	}
 
-	response := map[string]interface{}{
-		"app_name": appName,
-		"method": methodName,
-		"count": len(history),
-		"history": history,
+	if unversioned(r) {
+		entries := make([]legacyEntry, len(history))
+		for i, entry := range history {
+			entries[i] = legacyEntry{Data: entry.Data, Timestamp: entry.Timestamp, Source: entry.Source}
+		}
+		writeJSON(w, r, http.StatusOK, &legacyHistoryResponse{
+			AppName: appName,
+			Method:  methodName,
+			Count:   len(history),
+			History: entries,
+		})
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+	writeJSON(w, r, http.StatusOK, &HistoryResponse{
+		AppName: appName,
+		Method:  methodName,
+		Count:   len(history),
+		History: history,
+	})
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestUnversionedPathsKeepOldShape(t *testing.T) {
+	registry, ts := newRevisionServer(t)
+
+	resp, body := request(t, http.MethodGet, ts.URL+"/app/m", "")
+	if resp.StatusCode != http.StatusOK || body["status"] != "no_data" {
+		t.Errorf("unversioned GET with no data: %s %v, want 200 and status no_data", resp.Status, body)
+	}
+	resp, body = request(t, http.MethodGet, ts.URL+"/v1/app/m", "")
+	if apiError, _ := body["error"].(map[string]interface{}); resp.StatusCode != http.StatusNotFound || apiError["code"] != CodeNoData {
+		t.Errorf("/v1 GET with no data: %s %v, want 404 %s", resp.Status, body, CodeNoData)
+	}
+
+	registry.StoreData("app", "m", "test", json.RawMessage(`1`))
+	tests := []struct {
+		path string
+		keys []string
+	}{
+		{"/app/m/history", []string{"Data", "Timestamp", "Source"}},
+		{"/v1/app/m/history", []string{"offset", "data", "timestamp", "source"}},
+	}
+	for _, tt := range tests {
+		resp, body := request(t, http.MethodGet, ts.URL+tt.path, "")
+		history, _ := body["history"].([]interface{})
+		if resp.StatusCode != http.StatusOK || len(history) != 1 {
+			t.Fatalf("%s: %s %v", tt.path, resp.Status, body)
+		}
+		entry, _ := history[0].(map[string]interface{})
+		if len(entry) != len(tt.keys) {
+			t.Errorf("%s: entry %v, want fields %v", tt.path, entry, tt.keys)
+		}
+		for _, key := range tt.keys {
+			if _, ok := entry[key]; !ok {
+				t.Errorf("%s: entry %v has no %q", tt.path, entry, key)
+			}
+		}
+	}
+}
+
+func TestCreateProtocolOnce(t *testing.T) {
+	registry := NewRegistry()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			methods := []MethodInfo{{Name: fmt.Sprint("m", i)}}
+			if registry.CreateProtocol("app", fmt.Sprint("key", i), "", methods) == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Fatalf("%d creates succeeded, want 1", created)
+	}
+	info, _ := registry.GetProtocolInfo("app")
+	added := 0
+	for _, method := range info.Methods {
+		if method.Name != "init" {
+			added++
+		}
+	}
+	if added != 1 {
+		t.Errorf("methods = %+v, want only the winner's", info.Methods)
+	}
+	if err := registry.CreateProtocol("app", "key", "", nil); !errors.Is(err, ErrProtocolExists) {
+		t.Errorf("second create: %v, want ErrProtocolExists", err)
+	}
+}
+
+func TestCreateProtocolConflict(t *testing.T) {
+	server := NewServer("0")
+	server.SetRegistry(NewRegistry())
+	server.SetAdminToken("admin")
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	create := `{"app_name":"b","passkey":"secret","methods":[{"name":"m"}]}`
+	resp, _ := request(t, http.MethodPost, ts.URL+"/v1/system/protocols", create, "X-Admin-Token", "admin")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("first create: %s", resp.Status)
+	}
+	resp, body := request(t, http.MethodPost, ts.URL+"/v1/system/protocols", create, "X-Admin-Token", "admin")
+	if apiError, _ := body["error"].(map[string]interface{}); resp.StatusCode != http.StatusConflict || apiError["code"] != CodeConflict {
+		t.Errorf("second create: %s %v, want 409 %s", resp.Status, body, CodeConflict)
+	}
+}
@@ -0,0 +1,349 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"freeport/expr"
+)
+
+// DerivedSource is the source of every value a derivation stores.
+const DerivedSource = "derived"
+
+// Derivation computes a method's value from other methods. Sources binds
+// the names the expression reads to methods, written app/method or just
+// method for one in the same protocol. The expression is re-evaluated each
+// time a source is stored, once every source has a value.
+//
+//	{"sources": {"f": "sensor/fahrenheit"}, "expr": "round((f.temp - 32) * 5 / 9, 1)"}
+type Derivation struct {
+	Sources map[string]string `json:"sources"`
+	Expr    string            `json:"expr"`
+}
+
+type DerivedStatus struct {
+	AppName     string            `json:"app_name"`
+	Method      string            `json:"method"`
+	Sources     map[string]string `json:"sources"`
+	Expr        string            `json:"expr"`
+	Evaluations int64             `json:"evaluations"`
+	Failures    int64             `json:"failures"`
+	LastError   string            `json:"last_error,omitempty"`
+	Updated     *time.Time        `json:"updated,omitempty"`
+}
+
+type derived struct {
+	Derivation
+	program *expr.Program
+	// inputs are the resolved sources, keyed by expression name.
+	inputs map[string]methodRef
+
+	evaluations int64
+	failures    int64
+	lastError   string
+	updated     time.Time
+}
+
+type methodRef struct {
+	app, method string
+}
+
+func (m methodRef) String() string {
+	return m.app + "/" + m.method
+}
+
+var errDerivedMethod = errors.New("method is derived from other methods")
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// compile checks a derivation declared on a method of appName.
+func (d *Derivation) compile(appName string) (*derived, error) {
+	if len(d.Sources) == 0 {
+		return nil, fmt.Errorf("at least one source is required")
+	}
+
+	names := make([]string, 0, len(d.Sources))
+	inputs := make(map[string]methodRef, len(d.Sources))
+	for name, source := range d.Sources {
+		if !identifier.MatchString(name) {
+			return nil, fmt.Errorf("source name %q is not an identifier", name)
+		}
+		ref := methodRef{app: appName, method: source}
+		if app, method, ok := strings.Cut(source, "/"); ok {
+			ref = methodRef{app: app, method: method}
+		}
+		if ref.app == "" || ref.method == "" || strings.Contains(ref.method, "/") {
+			return nil, fmt.Errorf("source %s: %q is not app/method", name, source)
+		}
+		names = append(names, name)
+		inputs[name] = ref
+	}
+
+	program, err := expr.Compile(d.Expr, names)
+	if err != nil {
+		return nil, fmt.Errorf("expr: %w", err)
+	}
+	return &derived{Derivation: *d, program: program, inputs: inputs}, nil
+}
+
+// checkDerivations reports a derivation that, directly or through others,
+// reads its own method. graph maps each derived method to its sources.
+func checkDerivations(graph map[methodRef][]methodRef) error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[methodRef]int{}
+
+	var visit func(ref methodRef, path []string) error
+	visit = func(ref methodRef, path []string) error {
+		switch state[ref] {
+		case visiting:
+			return fmt.Errorf("derivation cycle %s", strings.Join(append(path, ref.String()), " -> "))
+		case done:
+			return nil
+		}
+		state[ref] = visiting
+		for _, source := range graph[ref] {
+			if err := visit(source, append(path, ref.String())); err != nil {
+				return err
+			}
+		}
+		state[ref] = done
+		return nil
+	}
+
+	refs := make([]methodRef, 0, len(graph))
+	for ref := range graph {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+	for _, ref := range refs {
+		if err := visit(ref, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// derivationGraph lists the sources of every derived method in the
+// registry. The caller holds reg.mu.
+func (reg *Registry) derivationGraph() map[methodRef][]methodRef {
+	graph := map[methodRef][]methodRef{}
+	for appName, protocol := range reg.protocols {
+		for methodName, d := range protocol.Derived {
+			graph[methodRef{appName, methodName}] = d.sources()
+		}
+	}
+	return graph
+}
+
+func (d *derived) sources() []methodRef {
+	refs := make([]methodRef, 0, len(d.inputs))
+	for _, ref := range d.inputs {
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// propagate re-evaluates the derivations that read the method just stored.
+// Each result is stored in turn, which carries a change down a chain of
+// derivations.
+func (reg *Registry) propagate(event StoreEvent) {
+	stored := methodRef{event.App, event.Method}
+
+	reg.mu.RLock()
+	var targets []methodRef
+	for appName, protocol := range reg.protocols {
+		for methodName, d := range protocol.Derived {
+			for _, ref := range d.inputs {
+				if ref == stored {
+					targets = append(targets, methodRef{appName, methodName})
+					break
+				}
+			}
+		}
+	}
+	reg.mu.RUnlock()
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].String() < targets[j].String() })
+	for _, target := range targets {
+		reg.derive(target)
+	}
+}
+
+// derive evaluates the derivation on target and stores the result. It does
+// nothing until every source has a live value, so an expired source stops
+// feeding it even before the reaper removes the value.
+func (reg *Registry) derive(target methodRef) {
+	now := time.Now()
+	reg.mu.RLock()
+	protocol, exists := reg.protocols[target.app]
+	if !exists || protocol.Derived[target.method] == nil {
+		reg.mu.RUnlock()
+		return
+	}
+	d := protocol.Derived[target.method]
+	schema := protocol.Schemas[target.method]
+
+	vars := make(map[string]interface{}, len(d.inputs))
+	var err error
+	for name, ref := range d.inputs {
+		source, exists := reg.protocols[ref.app]
+		if !exists {
+			reg.mu.RUnlock()
+			return
+		}
+		data, ok := source.current(ref.method, now)
+		if !ok {
+			reg.mu.RUnlock()
+			return
+		}
+		if vars[name], err = exprValue(data); err != nil {
+			err = fmt.Errorf("%s: %w", name, err)
+			break
+		}
+	}
+	reg.mu.RUnlock()
+
+	var raw json.RawMessage
+	if err == nil {
+		var value interface{}
+		if value, err = d.program.Eval(vars); err == nil {
+			raw, err = derivationOutput(value, schema)
+		}
+	}
+
+	reg.mu.Lock()
+	d.evaluations++
+	if err != nil {
+		d.failures++
+		d.lastError = err.Error()
+	} else {
+		d.lastError = ""
+		d.updated = now
+	}
+	reg.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	if stored, _ := reg.store(target.app, target.method, DerivedSource, raw, Stamp{}, nil); stored {
+		reg.publishWrite("DERIVE", target.app, target.method, DerivedSource, raw, now)
+	}
+}
+
+// exprValue turns a stored value into the plain JSON value an
+// expression reads.
+func exprValue(data interface{}) (interface{}, error) {
+	if _, ok := data.(*Blob); ok {
+		return nil, fmt.Errorf("a blob cannot be read by an expression")
+	}
+	raw, ok := data.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(data); err != nil {
+			return nil, err
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func derivationOutput(value interface{}, schema *Schema) (json.RawMessage, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	raw, decoded, err := readJSON(bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if problems := schema.Validate(decoded); len(problems) > 0 {
+		return nil, fmt.Errorf("schema: %s", strings.Join(problems, "; "))
+	}
+	return raw, nil
+}
+
+// IsDerived reports whether appName/methodName is computed by a derivation
+// and so cannot be written to directly.
+func (reg *Registry) IsDerived(appName, methodName string) bool {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists {
+		return protocol.Derived[methodName] != nil
+	}
+	return false
+}
+
+// Derivation reports how the derivation on appName/methodName is doing.
+func (reg *Registry) Derivation(appName, methodName string) (DerivedStatus, bool) {
+	for _, status := range reg.Derivations() {
+		if status.AppName == appName && status.Method == methodName {
+			return status, true
+		}
+	}
+	return DerivedStatus{}, false
+}
+
+// Derivations lists every derived method with how its evaluations went,
+// sorted by app and method.
+func (reg *Registry) Derivations() []DerivedStatus {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	statuses := []DerivedStatus{}
+	for appName, protocol := range reg.protocols {
+		for methodName, d := range protocol.Derived {
+			status := DerivedStatus{
+				AppName:     appName,
+				Method:      methodName,
+				Sources:     d.Sources,
+				Expr:        d.Expr,
+				Evaluations: d.evaluations,
+				Failures:    d.failures,
+				LastError:   d.lastError,
+			}
+			if !d.updated.IsZero() {
+				updated := d.updated
+				status.Updated = &updated
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].AppName != statuses[j].AppName {
+			return statuses[i].AppName < statuses[j].AppName
+		}
+		return statuses[i].Method < statuses[j].Method
+	})
+	return statuses
+}
+
+type DerivedListResponse struct {
+	Response
+	Count   int             `json:"count"`
+	Derived []DerivedStatus `json:"derived"`
+}
+
+func (s *Server) handleDerived(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	derived := s.registry.Derivations()
+	writeJSON(w, r, http.StatusOK, &DerivedListResponse{Count: len(derived), Derived: derived})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckDerivations(t *testing.T) {
+	ref := func(s string) methodRef {
+		app, method, _ := strings.Cut(s, "/")
+		return methodRef{app, method}
+	}
+	graph := func(edges ...string) map[methodRef][]methodRef {
+		g := map[methodRef][]methodRef{}
+		for _, edge := range edges {
+			from, to, _ := strings.Cut(edge, " <- ")
+			g[ref(from)] = append(g[ref(from)], ref(to))
+		}
+		return g
+	}
+
+	tests := []struct {
+		name  string
+		graph map[methodRef][]methodRef
+		want  string // empty for no cycle
+	}{
+		{"empty", graph(), ""},
+		{"chain", graph("a/c <- a/b", "a/b <- a/a"), ""},
+		{"diamond", graph("a/d <- a/b", "a/d <- a/c", "a/b <- a/a", "a/c <- a/a"), ""},
+		{"self", graph("a/x <- a/x"), "derivation cycle a/x -> a/x"},
+		{"two", graph("a/x <- b/y", "b/y <- a/x"), "derivation cycle a/x -> b/y -> a/x"},
+		{"behind a chain", graph("a/a <- a/b", "a/b <- a/c", "a/c <- a/b"), "derivation cycle a/a -> a/b -> a/c -> a/b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDerivations(tt.graph)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && (err == nil || err.Error() != tt.want):
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyRejectsDerivationCycle(t *testing.T) {
+	reg := NewRegistry()
+	m := &Manifest{Protocols: []ManifestProtocol{{
+		Name:    "a",
+		Passkey: "k",
+		Methods: []ManifestMethod{
+			{Name: "x", Derive: &Derivation{Sources: map[string]string{"y": "y"}, Expr: "y"}},
+			{Name: "y", Derive: &Derivation{Sources: map[string]string{"x": "x"}, Expr: "x"}},
+		},
+	}}}
+	if _, err := reg.Apply(m, ApplyOptions{}); err == nil || !strings.Contains(err.Error(), "derivation cycle") {
+		t.Errorf("Apply = %v, want a derivation cycle error", err)
+	}
+	if reg.ProtocolExists("a") {
+		t.Error("protocol created despite the cycle")
+	}
+}
+
+func TestDeriveSkipsExpiredSources(t *testing.T) {
+	reg := NewRegistry()
+	m := &Manifest{Protocols: []ManifestProtocol{{
+		Name:    "a",
+		Passkey: "k",
+		Methods: []ManifestMethod{
+			{Name: "x"},
+			{Name: "y"},
+			{Name: "sum", Derive: &Derivation{Sources: map[string]string{"x": "x", "y": "y"}, Expr: "x + y"}},
+		},
+	}}}
+	if _, err := reg.Apply(m, ApplyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reg.StoreDataIf("a", "x", "test", json.RawMessage(`1`), time.Millisecond, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	reg.StoreData("a", "y", "test", json.RawMessage(`2`))
+	if status, _ := reg.Derivation("a", "sum"); status.Evaluations != 0 {
+		t.Errorf("evaluated %d times with an expired source", status.Evaluations)
+	}
+
+	reg.StoreData("a", "x", "test", json.RawMessage(`3`))
+	data, ok := reg.GetData("a", "sum")
+	if raw, _ := data.(json.RawMessage); !ok || string(raw) != "5" {
+		t.Errorf("sum = %s, want 5", raw)
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const previewSize = 256
+
+type TrafficEvent struct {
+	Time            time.Time
+	Verb            string
+	Path            string
+	App             string
+	Method          string
+	Status          int
+	Latency         time.Duration
+	RequestBytes    int64
+	ResponseBytes   int64
+	RequestPreview  string
+	ResponsePreview string
+	Source          string
+}
+
+// trafficFeed fans the requests of one registry out to its subscribers.
+type trafficFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan TrafficEvent]struct{}
+}
+
+func newTrafficFeed() *trafficFeed {
+	return &trafficFeed{subscribers: make(map[chan TrafficEvent]struct{})}
+}
+
+// SubscribeTraffic returns a channel that receives every request handled by
+// servers on the registry. Events are dropped rather than blocking the
+// server when the subscriber falls behind.
+func (reg *Registry) SubscribeTraffic(buffer int) (<-chan TrafficEvent, func()) {
+	feed := reg.traffic
+	ch := make(chan TrafficEvent, buffer)
+
+	feed.mu.Lock()
+	feed.subscribers[ch] = struct{}{}
+	feed.mu.Unlock()
+
+	unsubscribe := func() {
+		feed.mu.Lock()
+		defer feed.mu.Unlock()
+		if _, ok := feed.subscribers[ch]; ok {
+			delete(feed.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+func (reg *Registry) publishTraffic(event TrafficEvent) {
+	feed := reg.traffic
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	for ch := range feed.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// publishWrite shows a value the bus stored by itself, rather than for a
+// request, in the traffic feed under verb.
+func (reg *Registry) publishWrite(verb, appName, methodName, source string, data interface{}, at time.Time) {
+	var preview string
+	var size int64
+	switch v := data.(type) {
+	case *Blob:
+		preview, size = v.ContentType+" blob", v.Size
+	default:
+		raw, ok := data.(json.RawMessage)
+		if !ok {
+			raw, _ = json.Marshal(data)
+		}
+		var buffer previewBuffer
+		buffer.record(raw)
+		preview, size = buffer.String(), buffer.total
+	}
+
+	reg.publishTraffic(TrafficEvent{
+		Time:           at,
+		Verb:           verb,
+		Path:           "/" + APIVersion + "/" + appName + "/" + methodName,
+		App:            appName,
+		Method:         methodName,
+		Status:         http.StatusOK,
+		RequestBytes:   size,
+		RequestPreview: preview,
+		Source:         source,
+	})
+}
+
+func requestMethod(r *http.Request) string {
+	segments := apiSegments(r)
+	if len(segments) < 2 {
+		return ""
+	}
+	return segments[1]
+}
+
+// previewBuffer keeps the first previewSize bytes written through it.
+type previewBuffer struct {
+	data  []byte
+	total int64
+}
+
+func (p *previewBuffer) record(b []byte) {
+	p.total += int64(len(b))
+	if room := previewSize - len(p.data); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		p.data = append(p.data, b...)
+	}
+}
+
+func (p *previewBuffer) String() string {
+	return strings.ToValidUTF8(string(p.data), "?")
+}
+
+// redactedPreview stands in for a body the Monitor must not show.
+const redactedPreview = "(redacted)"
+
+// credentialField matches a JSON field that holds a secret.
+var credentialField = regexp.MustCompile(`(?i)"(passkey|password|secret|[a-z_]*token)"\s*:`)
+
+// safePreview is p for the traffic feed. Bodies of /system calls carry
+// passkeys, tokens, manifests and snapshots, so they are never shown, and
+// neither is any other body that looks like it holds credentials.
+func safePreview(r *http.Request, p *previewBuffer) string {
+	if p.total == 0 {
+		return ""
+	}
+	segments := apiSegments(r)
+	if len(segments) > 0 && segments[0] == "system" {
+		return redactedPreview
+	}
+	preview := p.String()
+	if credentialField.MatchString(preview) {
+		return redactedPreview
+	}
+	return preview
+}
+
+type previewReader struct {
+	io.ReadCloser
+	preview previewBuffer
+}
+
+func (r *previewReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.preview.record(b[:n])
+	return n, err
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTrafficPreviewsHideCredentials(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterProtocol("app", "key", "")
+	registry.RegisterMethod("app", "m", "")
+	server := NewServer("0")
+	server.SetRegistry(registry)
+	server.SetAdminToken("admin")
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	events, unsubscribe := registry.SubscribeTraffic(10)
+	defer unsubscribe()
+	next := func() TrafficEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no traffic event")
+		}
+		return TrafficEvent{}
+	}
+
+	tests := []struct {
+		name, method, path, body string
+		request, response        string // "" means shown as sent
+	}{
+		{"protocol create", http.MethodPost, "/v1/system/protocols", `{"app_name":"b","passkey":"hunter2"}`, redactedPreview, redactedPreview},
+		{"manifest export", http.MethodGet, "/system/manifest?passkeys=true", "", "", redactedPreview},
+		{"plain data", http.MethodPost, "/v1/app/m", `{"temp":21}`, `{"temp":21}`, ""},
+		{"data with a token", http.MethodPost, "/v1/app/m", `{"api_token":"abc"}`, redactedPreview, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request(t, tt.method, ts.URL+tt.path, tt.body, "X-Admin-Token", "admin")
+			e := next()
+			if e.RequestPreview != tt.request {
+				t.Errorf("request preview %q, want %q", e.RequestPreview, tt.request)
+			}
+			if tt.response != "" && e.ResponsePreview != tt.response {
+				t.Errorf("response preview %q, want %q", e.ResponsePreview, tt.response)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reapInterval is how often expired values are removed.
+const reapInterval = 10 * time.Second
+
+// ParseTTL reads a time-to-live written as a Go duration ("90s", "5m") or
+// as a whole number of seconds. An empty string is 0, which means the
+// method's own retention applies.
+func ParseTTL(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseInt(text, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("ttl %q is negative", text)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	ttl, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("ttl %q is not a duration", text)
+	}
+	if ttl < 0 {
+		return 0, fmt.Errorf("ttl %q is negative", text)
+	}
+	return ttl, nil
+}
+
+// Check reports a retention whose TTL cannot be read.
+func (r *Retention) Check() error {
+	if r == nil {
+		return nil
+	}
+	_, err := r.ttl()
+	return err
+}
+
+func (r Retention) ttl() (time.Duration, error) {
+	return ParseTTL(r.TTL)
+}
+
+// current is the latest value on methodName unless it has expired by now.
+func (protocol *CustomProtocol) current(methodName string, now time.Time) (interface{}, bool) {
+	data, ok := protocol.Data[methodName]
+	if !ok {
+		return nil, false
+	}
+	if expires, ok := protocol.Expires[methodName]; ok && !now.Before(expires) {
+		return nil, false
+	}
+	return data, true
+}
+
+// Value is the latest value on a method with when it was stored and its
+// revision. Expires is zero for a value that never expires.
+type Value struct {
+	Data     interface{}
+	Stored   time.Time
+	Revision string
+	Expires  time.Time
+}
+
+// Expired reports whether v is past its TTL at now.
+func (v Value) Expired(now time.Time) bool {
+	return !v.Expires.IsZero() && !now.Before(v.Expires)
+}
+
+// Value returns the latest value on appName/methodName, expired or not, as
+// long as the reaper has not removed it yet.
+func (reg *Registry) Value(appName, methodName string) (Value, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return Value{}, false
+	}
+	data, ok := protocol.Data[methodName]
+	if !ok {
+		return Value{}, false
+	}
+	stamp := protocol.Stamps[methodName]
+	return Value{
+		Data:     data,
+		Stored:   stamp.Time,
+		Revision: stamp.Revision(),
+		Expires:  protocol.Expires[methodName],
+	}, true
+}
+
+// requestTTL reads the TTL a POST asks for, from the X-TTL header or the
+// ttl query parameter.
+func requestTTL(r *http.Request) (time.Duration, error) {
+	text := r.Header.Get("X-TTL")
+	if text == "" {
+		text = r.URL.Query().Get("ttl")
+	}
+	return ParseTTL(text)
+}
+
+// setValueHeaders describes the revision and age of a value in HTTP terms,
+// so that blobs and ?format=raw responses carry them too.
+func setValueHeaders(w http.ResponseWriter, value Value, age time.Duration, stale bool) {
+	w.Header().Set("ETag", etag(value.Revision))
+	w.Header().Set("Last-Modified", value.Stored.UTC().Format(http.TimeFormat))
+	w.Header().Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	if !value.Expires.IsZero() {
+		w.Header().Set("Expires", value.Expires.UTC().Format(http.TimeFormat))
+	}
+	if stale {
+		w.Header().Set("X-Stale", "true")
+	}
+}
+
+// startReaper removes expired values in the background from then on. It
+// is safe to call more than once.
+func (reg *Registry) startReaper() {
+	reg.reaper.Do(func() {
+		go func() {
+			ticker := time.NewTicker(reapInterval)
+			defer ticker.Stop()
+			for now := range ticker.C {
+				reg.reap(now)
+			}
+		}()
+	})
+}
+
+// reap removes the values that have expired by now, keys included. The
+// history of a method's value stays, and so does its stamp, so an older
+// replica arriving later cannot take the place of a value that has already
+// expired.
+func (reg *Registry) reap(now time.Time) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reaped := 0
+	for _, protocol := range reg.protocols {
+		for methodName, expires := range protocol.Expires {
+			if now.Before(expires) {
+				continue
+			}
+			delete(protocol.Data, methodName)
+			delete(protocol.Expires, methodName)
+			reaped++
+		}
+		reaped += protocol.reapKeys(now)
+	}
+	return reaped
+}
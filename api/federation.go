@@ -0,0 +1,420 @@
+package api
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers carried by mirrored writes. The path lists every node the value
+// has already been through, so a node that finds itself on it drops the
+// value instead of sending it round a cycle of links again.
+const (
+	headerFederationToken = "X-Federation-Token"
+	headerOrigin          = "X-Freeport-Origin"
+	headerStamp           = "X-Freeport-Stamp"
+	headerPath            = "X-Freeport-Path"
+	headerKind            = "X-Freeport-Kind"
+)
+
+const (
+	LinkIdle = "idle"
+	LinkUp   = "up"
+	LinkDown = "down"
+)
+
+const linkQueueSize = 256
+
+// LinkConfig mirrors writes to a peer instance. Each Mirror entry is either
+// "app" for every method of a protocol or "app/method" for a single one.
+// Token is the peer's federation token.
+type LinkConfig struct {
+	Name   string
+	URL    string
+	Token  string
+	Mirror []string
+}
+
+type LinkStatus struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Mirror    []string  `json:"mirror"`
+	State     string    `json:"state"`
+	Peer      string    `json:"peer,omitempty"`
+	Sent      int64     `json:"sent"`
+	Looped    int64     `json:"looped"`
+	Failed    int64     `json:"failed"`
+	Dropped   int64     `json:"dropped"`
+	Pending   int       `json:"pending"`
+	LastError string    `json:"last_error,omitempty"`
+	LastSent  time.Time `json:"last_sent"`
+}
+
+type link struct {
+	config LinkConfig
+	base   string
+	queue  chan StoreEvent
+
+	mu     sync.Mutex
+	status LinkStatus
+}
+
+// Federation mirrors selected protocols of a registry to other freeport
+// instances and accepts their writes in return once a Server is given it
+// with SetFederation.
+type Federation struct {
+	registry *Registry
+	node     string
+	token    string
+	client   *http.Client
+	links    []*link
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewFederation names this instance node and accepts mirrored writes that
+// present token. An empty token refuses every incoming write, which suits
+// an instance that only pushes.
+func NewFederation(registry *Registry, node, token string) *Federation {
+	f := &Federation{
+		registry: registry,
+		node:     node,
+		token:    token,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		done:     make(chan struct{}),
+	}
+	registry.SetNode(node)
+	registry.Watch(f.mirror)
+	return f
+}
+
+func (f *Federation) Node() string {
+	return f.node
+}
+
+// AddLink must be called before Start.
+func (f *Federation) AddLink(config LinkConfig) error {
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("link %q: invalid url %q", config.Name, config.URL)
+	}
+	if len(config.Mirror) == 0 {
+		return fmt.Errorf("link %q: nothing to mirror", config.Name)
+	}
+	if config.Name == "" {
+		config.Name = u.Host
+	}
+
+	f.links = append(f.links, &link{
+		config: config,
+		base:   strings.TrimSuffix(config.URL, "/"),
+		queue:  make(chan StoreEvent, linkQueueSize),
+		status: LinkStatus{
+			Name:   config.Name,
+			URL:    config.URL,
+			Mirror: config.Mirror,
+			State:  LinkIdle,
+		},
+	})
+	return nil
+}
+
+func (f *Federation) Start() {
+	for _, l := range f.links {
+		f.wg.Add(1)
+		go f.run(l)
+	}
+}
+
+func (f *Federation) Close() {
+	close(f.done)
+	f.wg.Wait()
+}
+
+func (f *Federation) Links() []LinkStatus {
+	statuses := make([]LinkStatus, 0, len(f.links))
+	for _, l := range f.links {
+		l.mu.Lock()
+		status := l.status
+		l.mu.Unlock()
+		status.Pending = len(l.queue)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func (l *link) matches(appName, methodName string) bool {
+	for _, entry := range l.config.Mirror {
+		app, method, scoped := strings.Cut(entry, "/")
+		if app == appName && (!scoped || method == "*" || method == methodName) {
+			return true
+		}
+	}
+	return false
+}
+
+// mirror queues a stored value on every link that wants it. When a queue is
+// full the oldest value is dropped, since the newest is the one peers need
+// for their latest value.
+func (f *Federation) mirror(event StoreEvent) {
+	for _, l := range f.links {
+		if !l.matches(event.App, event.Method) {
+			continue
+		}
+
+		l.mu.Lock()
+		peer := l.status.Peer
+		l.mu.Unlock()
+		if peer != "" && onPath(event.Path, peer) {
+			l.record(func(s *LinkStatus) { s.Looped++ })
+			continue
+		}
+
+		for {
+			select {
+			case l.queue <- event:
+			default:
+				select {
+				case <-l.queue:
+					l.record(func(s *LinkStatus) { s.Dropped++ })
+				default:
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+func onPath(path []string, node string) bool {
+	for _, n := range path {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *link) record(update func(*LinkStatus)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	update(&l.status)
+}
+
+func (f *Federation) run(l *link) {
+	defer f.wg.Done()
+	for {
+		select {
+		case <-f.done:
+			return
+		case event := <-l.queue:
+			f.deliver(l, event)
+		}
+	}
+}
+
+// deliver sends event until the peer takes it. Network errors and 5xx
+// answers are retried with backoff; anything else means the peer will never
+// accept the value, so it is counted as failed and dropped.
+func (f *Federation) deliver(l *link, event StoreEvent) {
+	wait := 500 * time.Millisecond
+	for {
+		reply, retry, err := f.send(l, event)
+		if err == nil {
+			l.record(func(s *LinkStatus) {
+				s.State = LinkUp
+				s.Peer = reply.Node
+				s.LastError = ""
+				if reply.Looped {
+					s.Looped++
+				} else {
+					s.Sent++
+					s.LastSent = time.Now()
+				}
+			})
+			return
+		}
+
+		l.record(func(s *LinkStatus) {
+			s.State = LinkDown
+			s.LastError = err.Error()
+			if !retry {
+				s.Failed++
+			}
+		})
+		if !retry {
+			return
+		}
+
+		select {
+		case <-f.done:
+			return
+		case <-time.After(wait):
+		}
+		if wait < 30*time.Second {
+			wait *= 2
+		}
+	}
+}
+
+func (f *Federation) send(l *link, event StoreEvent) (*ReplicaResponse, bool, error) {
+	var body []byte
+	contentType, kind := "application/json", "json"
+	switch data := event.Data.(type) {
+	case *Blob:
+		body, contentType, kind = data.Bytes, data.ContentType, "blob"
+	case json.RawMessage:
+		body = data
+	default:
+		var err error
+		if body, err = json.Marshal(data); err != nil {
+			return nil, false, err
+		}
+	}
+
+	target := l.base + "/" + APIVersion + "/system/federation/" + url.PathEscape(event.App) + "/" + url.PathEscape(event.Method)
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(headerFederationToken, l.config.Token)
+	req.Header.Set(headerOrigin, event.Stamp.Node)
+	req.Header.Set(headerStamp, event.Stamp.Time.UTC().Format(time.RFC3339Nano))
+	req.Header.Set(headerPath, strings.Join(append(append([]string{}, event.Path...), f.node), ","))
+	req.Header.Set(headerKind, kind)
+	req.Header.Set("X-Source", event.Source)
+	if event.TTL > 0 {
+		req.Header.Set("X-TTL", event.TTL.String())
+	}
+	if blob, ok := event.Data.(*Blob); ok && blob.Filename != "" {
+		req.Header.Set("X-Filename", blob.Filename)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	var reply ReplicaResponse
+	json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&reply)
+	if resp.StatusCode != http.StatusOK {
+		message := resp.Status
+		if reply.Error != nil {
+			message = fmt.Sprintf("%s: %s", resp.Status, reply.Error.Message)
+		}
+		return nil, resp.StatusCode >= 500, fmt.Errorf("%s", message)
+	}
+	return &reply, false, nil
+}
+
+type ReplicaResponse struct {
+	Response
+	AppName string `json:"app_name"`
+	Method  string `json:"method"`
+	Node    string `json:"node"`
+	Stored  bool   `json:"stored"`
+	Latest  bool   `json:"latest"`
+	Looped  bool   `json:"looped"`
+}
+
+type FederationResponse struct {
+	Response
+	Node  string       `json:"node"`
+	Links []LinkStatus `json:"links"`
+}
+
+// SetFederation mirrors writes through f and accepts writes from its peers.
+func (s *Server) SetFederation(f *Federation) {
+	s.federation = f
+}
+
+func (s *Server) handleFederation(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if s.federation == nil {
+		writeJSON(w, r, http.StatusOK, &FederationResponse{Links: []LinkStatus{}})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, &FederationResponse{
+		Node:  s.federation.node,
+		Links: s.federation.Links(),
+	})
+}
+
+// handleReplica stores a value mirrored by a peer. A value that has already
+// been through this node is acknowledged but not stored, and one that loses
+// to the current latest value only goes into the history.
+func (s *Server) handleReplica(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	f := s.federation
+	if f == nil {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Federation is not enabled")
+		return
+	}
+
+	token := r.Header.Get(headerFederationToken)
+	if f.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(f.token)) != 1 {
+		// The token is the same for every protocol, so guesses share the
+		// system bucket rather than getting one per app.
+		if !s.allowFailedAuth(w, r, "system") {
+			return
+		}
+		s.registry.RecordAudit(AuditAuthFailed, appName, methodName, r.Method+" "+r.URL.Path, remoteAddr(r))
+		s.registry.metrics.recordAuthFailure(s.registry.metricsApp(appName))
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	response := &ReplicaResponse{AppName: appName, Method: methodName, Node: f.node}
+
+	var path []string
+	if header := r.Header.Get(headerPath); header != "" {
+		path = strings.Split(header, ",")
+	}
+	if onPath(path, f.node) {
+		response.Looped = true
+		writeJSON(w, r, http.StatusOK, response)
+		return
+	}
+
+	origin := r.Header.Get(headerOrigin)
+	stampTime, err := time.Parse(time.RFC3339Nano, r.Header.Get(headerStamp))
+	if origin == "" || err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Missing or invalid origin stamp")
+		return
+	}
+	ttl, err := requestTTL(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+
+	if !s.registry.ProtocolExists(appName) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Protocol not found")
+		return
+	}
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return
+	}
+
+	payload, source, ok := s.readPayload(w, r, appName, r.Header.Get(headerKind) != "blob")
+	if !ok || !s.checkSchema(w, r, appName, methodName, payload) {
+		return
+	}
+	if src := r.Header.Get("X-Source"); src != "" {
+		source = src
+	}
+
+	response.Stored, response.Latest = s.registry.StoreReplica(appName, methodName, source, payload, Stamp{Time: stampTime, Node: origin}, path, ttl)
+	writeJSON(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testNode struct {
+	registry   *Registry
+	federation *Federation
+	server     *httptest.Server
+}
+
+// newTestNode runs a bus with its own registry and a "weather/temp" method.
+func newTestNode(t *testing.T, name string) *testNode {
+	t.Helper()
+	registry := NewRegistry()
+	registry.RegisterProtocol("weather", "secret", "")
+	registry.RegisterMethod("weather", "temp", "")
+
+	server := NewServer("0")
+	server.SetRegistry(registry)
+	federation := NewFederation(registry, name, "token-"+name)
+	server.SetFederation(federation)
+
+	n := &testNode{registry: registry, federation: federation, server: httptest.NewServer(server.Handler())}
+	t.Cleanup(n.server.Close)
+	return n
+}
+
+func (n *testNode) linkTo(t *testing.T, peer *testNode, name string) {
+	t.Helper()
+	err := n.federation.AddLink(LinkConfig{
+		Name:   name,
+		URL:    peer.server.URL,
+		Token:  "token-" + peer.federation.Node(),
+		Mirror: []string{"weather"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (n *testNode) start(t *testing.T) {
+	n.federation.Start()
+	t.Cleanup(n.federation.Close)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func historyLen(r *Registry) int {
+	history, _ := r.GetHistory("weather", "temp", 100)
+	return len(history)
+}
+
+func TestFederationMirrorsWithoutLooping(t *testing.T) {
+	a := newTestNode(t, "a")
+	b := newTestNode(t, "b")
+	a.linkTo(t, b, "to-b")
+	b.linkTo(t, a, "to-a")
+	a.start(t)
+	b.start(t)
+
+	if !a.registry.StoreData("weather", "temp", "sensor", json.RawMessage(`21`)) {
+		t.Fatal("StoreData failed")
+	}
+	waitFor(t, "value on b", func() bool {
+		data, _ := b.registry.GetData("weather", "temp")
+		raw, _ := data.(json.RawMessage)
+		return string(raw) == "21"
+	})
+
+	// b sends the value back to a, which finds itself on the path.
+	waitFor(t, "loop to be detected", func() bool {
+		return b.federation.Links()[0].Looped > 0 || a.federation.Links()[0].Looped > 0
+	})
+	if n := historyLen(a.registry); n != 1 {
+		t.Errorf("a has %d history entries, want 1", n)
+	}
+	if n := historyLen(b.registry); n != 1 {
+		t.Errorf("b has %d history entries, want 1", n)
+	}
+	if sent := a.federation.Links()[0].Sent; sent != 1 {
+		t.Errorf("a sent %d values, want 1", sent)
+	}
+
+	got, _ := b.registry.Value("weather", "temp")
+	want, _ := a.registry.Value("weather", "temp")
+	if got.Revision != want.Revision {
+		t.Errorf("b revision = %s, want the origin's %s", got.Revision, want.Revision)
+	}
+}
+
+func TestFederationLastWriterWins(t *testing.T) {
+	b := newTestNode(t, "b")
+
+	newer := time.Now()
+	older := newer.Add(-time.Second)
+	post := func(stamp time.Time, value string) ReplicaResponse {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, b.server.URL+"/v1/system/federation/weather/temp", strings.NewReader(value))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(headerFederationToken, "token-b")
+		req.Header.Set(headerOrigin, "a")
+		req.Header.Set(headerStamp, stamp.UTC().Format(time.RFC3339Nano))
+		req.Header.Set(headerPath, "a")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var reply ReplicaResponse
+		json.NewDecoder(resp.Body).Decode(&reply)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("replica write: %s", resp.Status)
+		}
+		return reply
+	}
+
+	if reply := post(newer, `2`); !reply.Stored || !reply.Latest {
+		t.Fatalf("newer write = %+v, want stored and latest", reply)
+	}
+	if reply := post(older, `1`); !reply.Stored || reply.Latest {
+		t.Fatalf("older write = %+v, want stored but not latest", reply)
+	}
+	if reply := post(newer, `2`); reply.Stored {
+		t.Errorf("repeated write = %+v, want it dropped", reply)
+	}
+
+	data, _ := b.registry.GetData("weather", "temp")
+	if raw, _ := data.(json.RawMessage); string(raw) != "2" {
+		t.Errorf("latest = %s, want 2", raw)
+	}
+	if n := historyLen(b.registry); n != 2 {
+		t.Errorf("history has %d entries, want 2", n)
+	}
+}
+
+func TestFederationRejectsBadToken(t *testing.T) {
+	b := newTestNode(t, "b")
+	req, _ := http.NewRequest(http.MethodPost, b.server.URL+"/v1/system/federation/weather/temp", strings.NewReader(`1`))
+	req.Header.Set(headerFederationToken, "wrong")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+	if events := b.registry.RecentAuditLog(10); len(events) == 0 || events[len(events)-1].Kind != AuditAuthFailed {
+		t.Errorf("audit log = %+v, want an auth failure", events)
+	}
+	if events := defaultRegistry.RecentAuditLog(10); len(events) != 0 {
+		t.Errorf("default registry audit log = %+v, want it untouched", events)
+	}
+
+	for i := 0; i < failedAuthLimits.Burst; i++ {
+		req, _ := http.NewRequest(http.MethodPost, b.server.URL+"/v1/system/federation/weather/temp", strings.NewReader(`1`))
+		req.Header.Set(headerFederationToken, "wrong")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return
+		}
+	}
+	t.Error("bad tokens were never throttled")
+}
+
+func TestFederationCarriesTTL(t *testing.T) {
+	a := newTestNode(t, "a")
+	b := newTestNode(t, "b")
+	a.linkTo(t, b, "to-b")
+	a.start(t)
+
+	if _, err := a.registry.StoreDataIf("weather", "temp", "sensor", json.RawMessage(`5`), time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := a.registry.Value("weather", "temp")
+	waitFor(t, "value on b", func() bool {
+		got, ok := b.registry.Value("weather", "temp")
+		return ok && got.Revision == want.Revision
+	})
+
+	got, _ := b.registry.Value("weather", "temp")
+	if want.Expires.IsZero() || !got.Expires.Equal(want.Expires) {
+		t.Errorf("b expires at %v, want %v", got.Expires, want.Expires)
+	}
+}
@@ -0,0 +1,637 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GeneratorSource is the source of every payload a generator stores.
+const GeneratorSource = "generator"
+
+const (
+	GenerateTemplate = "template"
+	GenerateList     = "list"
+	GenerateSchema   = "schema"
+)
+
+const (
+	DefaultGeneratorInterval = time.Second
+	MinGeneratorInterval     = 10 * time.Millisecond
+)
+
+// GeneratorConfig describes the payloads a generator posts on a method.
+//
+// A template is any JSON document whose strings may hold placeholders:
+// {{seq}}, {{random}}, {{random min max}}, {{bool}}, {{choice a b ...}},
+// {{uuid}}, {{now}}, {{unix}} and {{unixms}}. A string that is a single
+// placeholder takes the placeholder's type; otherwise the value is spliced
+// into the text. A list is posted in order, starting over at the end. The
+// schema mode makes up values that match the method's schema.
+type GeneratorConfig struct {
+	Mode     string
+	Template json.RawMessage
+	Values   []json.RawMessage
+	Interval time.Duration
+	// Count stops the generator after that many payloads have been
+	// stored; rejected ones do not count. 0 runs until stopped.
+	Count int64
+}
+
+type GeneratorStatus struct {
+	AppName   string    `json:"app_name"`
+	Method    string    `json:"method"`
+	Mode      string    `json:"mode"`
+	Interval  string    `json:"interval"`
+	Count     int64     `json:"count,omitempty"`
+	Running   bool      `json:"running"`
+	Sent      int64     `json:"sent"`
+	Rejected  int64     `json:"rejected"`
+	LastError string    `json:"last_error,omitempty"`
+	Started   time.Time `json:"started"`
+}
+
+type generator struct {
+	config   GeneratorConfig
+	template interface{}
+	rnd      *rand.Rand
+	seq      int64
+	stop     chan struct{}
+	rate     chan time.Duration
+
+	mu     sync.Mutex
+	status GeneratorStatus
+}
+
+var errNoGenerator = errors.New("no generator on this method")
+
+var placeholder = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+func generatorKey(appName, methodName string) string {
+	return appName + "/" + methodName
+}
+
+// StartGenerator attaches a generator to appName/methodName, replacing any
+// generator already there. The first payload is posted straight away.
+func (reg *Registry) StartGenerator(appName, methodName string, config GeneratorConfig) (GeneratorStatus, error) {
+	if config.Interval == 0 {
+		config.Interval = DefaultGeneratorInterval
+	}
+	if config.Interval < MinGeneratorInterval {
+		return GeneratorStatus{}, fmt.Errorf("interval must be at least %s", MinGeneratorInterval)
+	}
+	if config.Count < 0 {
+		return GeneratorStatus{}, fmt.Errorf("count must not be negative")
+	}
+
+	g := &generator{
+		config: config,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		stop:   make(chan struct{}),
+		rate:   make(chan time.Duration, 1),
+		status: GeneratorStatus{
+			AppName:  appName,
+			Method:   methodName,
+			Mode:     config.Mode,
+			Interval: config.Interval.String(),
+			Count:    config.Count,
+			Running:  true,
+			Started:  time.Now(),
+		},
+	}
+
+	switch config.Mode {
+	case GenerateTemplate:
+		if len(config.Template) == 0 {
+			return GeneratorStatus{}, fmt.Errorf("a template is required")
+		}
+		decoder := json.NewDecoder(bytes.NewReader(config.Template))
+		decoder.UseNumber()
+		if err := decoder.Decode(&g.template); err != nil {
+			return GeneratorStatus{}, fmt.Errorf("template: %w", err)
+		}
+		// Rendering once up front reports unknown placeholders now rather
+		// than on every tick.
+		if _, err := g.render(g.template); err != nil {
+			return GeneratorStatus{}, fmt.Errorf("template: %w", err)
+		}
+	case GenerateList:
+		if len(config.Values) == 0 {
+			return GeneratorStatus{}, fmt.Errorf("at least one value is required")
+		}
+		for i, value := range config.Values {
+			if !json.Valid(value) {
+				return GeneratorStatus{}, fmt.Errorf("values[%d] is not valid JSON", i)
+			}
+		}
+	case GenerateSchema:
+		if reg.MethodSchema(appName, methodName) == nil {
+			return GeneratorStatus{}, fmt.Errorf("%s/%s has no schema", appName, methodName)
+		}
+	default:
+		return GeneratorStatus{}, fmt.Errorf("mode must be %s, %s or %s", GenerateTemplate, GenerateList, GenerateSchema)
+	}
+
+	reg.mu.Lock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		reg.mu.Unlock()
+		return GeneratorStatus{}, fmt.Errorf("protocol %s not found", appName)
+	}
+	if protocol.Derived[methodName] != nil {
+		reg.mu.Unlock()
+		return GeneratorStatus{}, errDerivedMethod
+	}
+	if reg.generators == nil {
+		reg.generators = make(map[string]*generator)
+	}
+	key := generatorKey(appName, methodName)
+	if previous, exists := reg.generators[key]; exists {
+		previous.finish("")
+	}
+	reg.generators[key] = g
+	reg.mu.Unlock()
+
+	go reg.runGenerator(g)
+	return g.snapshot(), nil
+}
+
+// StopGenerator detaches the generator from appName/methodName. It reports
+// false if there was none.
+func (reg *Registry) StopGenerator(appName, methodName string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	key := generatorKey(appName, methodName)
+	g, exists := reg.generators[key]
+	if !exists {
+		return false
+	}
+	g.finish("")
+	delete(reg.generators, key)
+	return true
+}
+
+// stopGenerators detaches every generator of appName. The caller holds
+// reg.mu.
+func (reg *Registry) stopGenerators(appName string) {
+	for key, g := range reg.generators {
+		if g.status.AppName == appName {
+			g.finish("")
+			delete(reg.generators, key)
+		}
+	}
+}
+
+// SetGeneratorInterval changes how often a running generator posts without
+// restarting its sequence.
+func (reg *Registry) SetGeneratorInterval(appName, methodName string, interval time.Duration) (GeneratorStatus, error) {
+	if interval < MinGeneratorInterval {
+		return GeneratorStatus{}, fmt.Errorf("interval must be at least %s", MinGeneratorInterval)
+	}
+
+	reg.mu.RLock()
+	g, exists := reg.generators[generatorKey(appName, methodName)]
+	reg.mu.RUnlock()
+	if !exists {
+		return GeneratorStatus{}, errNoGenerator
+	}
+
+	g.mu.Lock()
+	g.status.Interval = interval.String()
+	running := g.status.Running
+	g.mu.Unlock()
+	if running {
+		// The channel holds one pending change; a newer one replaces it.
+		select {
+		case <-g.rate:
+		default:
+		}
+		g.rate <- interval
+	}
+	return g.snapshot(), nil
+}
+
+// Generator returns the state of the generator on appName/methodName.
+func (reg *Registry) Generator(appName, methodName string) (GeneratorStatus, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	g, exists := reg.generators[generatorKey(appName, methodName)]
+	if !exists {
+		return GeneratorStatus{}, false
+	}
+	return g.snapshot(), true
+}
+
+// Generators lists every generator, including ones that stopped by
+// themselves, sorted by app and method.
+func (reg *Registry) Generators() []GeneratorStatus {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	keys := make([]string, 0, len(reg.generators))
+	for key := range reg.generators {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	statuses := []GeneratorStatus{}
+	for _, key := range keys {
+		statuses = append(statuses, reg.generators[key].snapshot())
+	}
+	return statuses
+}
+
+func (g *generator) snapshot() GeneratorStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status
+}
+
+func (g *generator) finish(message string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.status.Running {
+		return
+	}
+	g.status.Running = false
+	if message != "" {
+		g.status.LastError = message
+	}
+	close(g.stop)
+}
+
+func (reg *Registry) runGenerator(g *generator) {
+	ticker := time.NewTicker(g.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if !reg.generate(g) {
+			g.finish("method was removed")
+			return
+		}
+		g.mu.Lock()
+		done := g.config.Count > 0 && g.status.Sent >= g.config.Count
+		g.mu.Unlock()
+		if done {
+			g.finish("")
+			return
+		}
+
+		select {
+		case <-g.stop:
+			return
+		case interval := <-g.rate:
+			ticker.Reset(interval)
+			select {
+			case <-g.stop:
+				return
+			case <-ticker.C:
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// generate posts the next payload. A payload that breaks the method's
+// schema is counted as rejected and skipped. It reports false once the
+// method can no longer be written to.
+func (reg *Registry) generate(g *generator) bool {
+	app, method := g.status.AppName, g.status.Method
+	if !reg.MethodExists(app, method) {
+		return false
+	}
+
+	schema := reg.MethodSchema(app, method)
+	g.seq++
+	value, err := g.next(schema)
+	var raw json.RawMessage
+	var decoded interface{}
+	if err == nil {
+		var encoded []byte
+		if encoded, err = json.Marshal(value); err == nil {
+			raw, decoded, err = readJSON(bytes.NewReader(encoded))
+		}
+	}
+	if err == nil {
+		if problems := schema.Validate(decoded); len(problems) > 0 {
+			err = fmt.Errorf("schema: %s", strings.Join(problems, "; "))
+		}
+	}
+	if err != nil {
+		g.mu.Lock()
+		g.status.Rejected++
+		g.status.LastError = err.Error()
+		g.mu.Unlock()
+		return true
+	}
+
+	now := time.Now()
+	if stored, _ := reg.store(app, method, GeneratorSource, raw, Stamp{}, nil); !stored {
+		return false
+	}
+	g.mu.Lock()
+	g.status.Sent++
+	g.mu.Unlock()
+
+	reg.publishWrite("GEN", app, method, GeneratorSource, raw, now)
+	return true
+}
+
+func (g *generator) next(schema *Schema) (interface{}, error) {
+	switch g.config.Mode {
+	case GenerateTemplate:
+		return g.render(g.template)
+	case GenerateList:
+		return g.config.Values[(g.seq-1)%int64(len(g.config.Values))], nil
+	default:
+		return g.fromSchema(schema), nil
+	}
+}
+
+func (g *generator) render(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			rendered, err := g.render(item)
+			if err != nil {
+				return nil, err
+			}
+			out[name] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := g.render(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	case string:
+		if match := placeholder.FindStringSubmatch(v); match != nil && match[0] == v {
+			return g.eval(match[1])
+		}
+		var failure error
+		text := placeholder.ReplaceAllStringFunc(v, func(s string) string {
+			result, err := g.eval(placeholder.FindStringSubmatch(s)[1])
+			if err != nil {
+				failure = err
+				return s
+			}
+			return fmt.Sprint(result)
+		})
+		return text, failure
+	}
+	return value, nil
+}
+
+func (g *generator) eval(expr string) (interface{}, error) {
+	fields := strings.Fields(expr)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty placeholder")
+	}
+
+	switch name, args := fields[0], fields[1:]; name {
+	case "seq":
+		return g.seq, nil
+	case "random":
+		if len(args) == 0 {
+			return g.rnd.Float64(), nil
+		}
+		if len(args) != 2 {
+			return nil, fmt.Errorf("{{random}} takes no arguments or a min and max")
+		}
+		lo, loErr := strconv.ParseInt(args[0], 10, 64)
+		hi, hiErr := strconv.ParseInt(args[1], 10, 64)
+		if loErr == nil && hiErr == nil {
+			if hi < lo {
+				return nil, fmt.Errorf("{{random %d %d}}: max is below min", lo, hi)
+			}
+			return lo + g.rnd.Int63n(hi-lo+1), nil
+		}
+		flo, loErr := strconv.ParseFloat(args[0], 64)
+		fhi, hiErr := strconv.ParseFloat(args[1], 64)
+		if loErr != nil || hiErr != nil || fhi < flo {
+			return nil, fmt.Errorf("{{random %s %s}}: want a min and max", args[0], args[1])
+		}
+		return flo + g.rnd.Float64()*(fhi-flo), nil
+	case "bool":
+		return g.rnd.Intn(2) == 1, nil
+	case "choice":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("{{choice}} needs at least one option")
+		}
+		return args[g.rnd.Intn(len(args))], nil
+	case "uuid":
+		b := make([]byte, 16)
+		g.rnd.Read(b)
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+	case "now":
+		return time.Now().UTC().Format(time.RFC3339Nano), nil
+	case "unix":
+		return time.Now().Unix(), nil
+	case "unixms":
+		return time.Now().UnixMilli(), nil
+	}
+	return nil, fmt.Errorf("unknown placeholder {{%s}}", expr)
+}
+
+var generatorWords = []string{"alpha", "bravo", "delta", "echo", "kilo", "lima", "nova", "oscar", "sierra", "tango"}
+
+// fromSchema makes up a value that matches s. Every property of an object
+// is filled in, not only the required ones.
+func (g *generator) fromSchema(s *Schema) interface{} {
+	if s == nil {
+		return g.seq
+	}
+	if len(s.Enum) > 0 {
+		return s.Enum[g.rnd.Intn(len(s.Enum))]
+	}
+
+	lo, hi := 0.0, 100.0
+	if s.Minimum != nil {
+		lo = *s.Minimum
+		if s.Maximum == nil {
+			hi = lo + 100
+		}
+	}
+	if s.Maximum != nil {
+		hi = *s.Maximum
+		if s.Minimum == nil {
+			lo = math.Min(0, hi-100)
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		out := make(map[string]interface{}, len(s.Properties))
+		for name, property := range s.Properties {
+			out[name] = g.fromSchema(property)
+		}
+		return out
+	case "array":
+		out := make([]interface{}, 1+g.rnd.Intn(3))
+		for i := range out {
+			out[i] = g.fromSchema(s.Items)
+		}
+		return out
+	case "string":
+		minLength, maxLength := 1, 12
+		if s.MinLength != nil {
+			minLength = *s.MinLength
+			maxLength = max(maxLength, minLength)
+		}
+		if s.MaxLength != nil {
+			maxLength = *s.MaxLength
+			minLength = min(minLength, maxLength)
+		}
+		text := generatorWords[g.rnd.Intn(len(generatorWords))]
+		for len(text) < minLength {
+			text += "-" + generatorWords[g.rnd.Intn(len(generatorWords))]
+		}
+		if len(text) > maxLength {
+			text = text[:maxLength]
+		}
+		return text
+	case "integer":
+		first, last := int64(math.Ceil(lo)), int64(math.Floor(hi))
+		if last < first {
+			return first
+		}
+		return first + g.rnd.Int63n(last-first+1)
+	case "number":
+		return math.Round((lo+g.rnd.Float64()*(hi-lo))*100) / 100
+	case "boolean":
+		return g.rnd.Intn(2) == 1
+	case "null":
+		return nil
+	}
+	if s.Properties != nil {
+		return g.fromSchema(&Schema{Type: "object", Properties: s.Properties})
+	}
+	return g.seq
+}
+
+type GeneratorResponse struct {
+	Response
+	Generator GeneratorStatus `json:"generator"`
+}
+
+type GeneratorListResponse struct {
+	Response
+	Count      int               `json:"count"`
+	Generators []GeneratorStatus `json:"generators"`
+}
+
+func (s *Server) handleGenerators(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	generators := s.registry.Generators()
+	writeJSON(w, r, http.StatusOK, &GeneratorListResponse{Count: len(generators), Generators: generators})
+}
+
+func (s *Server) handleGenerator(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		status, exists := s.registry.Generator(appName, methodName)
+		if !exists {
+			writeError(w, r, http.StatusNotFound, CodeGeneratorNotFound, "No generator on this method")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, &GeneratorResponse{Generator: status})
+
+	case http.MethodPut, http.MethodPatch:
+		var settings struct {
+			Mode     string            `json:"mode"`
+			Template json.RawMessage   `json:"template"`
+			Values   []json.RawMessage `json:"values"`
+			Interval string            `json:"interval"`
+			Count    int64             `json:"count"`
+		}
+		s.limitBody(w, r, "system")
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&settings); err != nil {
+			if s.rejectedTooLarge(w, r, "system", err) {
+				return
+			}
+			writeErrorDetails(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid generator settings", map[string]interface{}{
+				"reason": err.Error(),
+			})
+			return
+		}
+
+		var interval time.Duration
+		if settings.Interval != "" {
+			d, err := time.ParseDuration(settings.Interval)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid interval")
+				return
+			}
+			interval = d
+		}
+
+		var status GeneratorStatus
+		var err error
+		if r.Method == http.MethodPatch {
+			// PATCH only changes the rate of the running generator.
+			if interval == 0 {
+				writeError(w, r, http.StatusBadRequest, CodeBadRequest, "interval is required")
+				return
+			}
+			status, err = s.registry.SetGeneratorInterval(appName, methodName, interval)
+			if errors.Is(err, errNoGenerator) {
+				writeError(w, r, http.StatusNotFound, CodeGeneratorNotFound, "No generator on this method")
+				return
+			}
+		} else {
+			status, err = s.registry.StartGenerator(appName, methodName, GeneratorConfig{
+				Mode:     settings.Mode,
+				Template: settings.Template,
+				Values:   settings.Values,
+				Interval: interval,
+				Count:    settings.Count,
+			})
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, r, http.StatusOK, &GeneratorResponse{Generator: status})
+
+	case http.MethodDelete:
+		if !s.registry.StopGenerator(appName, methodName) {
+			writeError(w, r, http.StatusNotFound, CodeGeneratorNotFound, "No generator on this method")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, &MessageResponse{
+			AppName: appName,
+			Method:  methodName,
+			Message: "Generator stopped",
+		})
+	}
+}
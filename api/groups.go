@@ -0,0 +1,404 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const DefaultGroupBatch = 10
+
+type GroupStatus struct {
+	Group     string `json:"group"`
+	Committed int64  `json:"committed"`
+	Latest    int64  `json:"latest"`
+	Lag       int64  `json:"lag"`
+}
+
+type GroupReadResponse struct {
+	Response
+	AppName    string      `json:"app_name"`
+	Method     string      `json:"method"`
+	Group      string      `json:"group"`
+	Committed  int64       `json:"committed"`
+	Latest     int64       `json:"latest"`
+	Lag        int64       `json:"lag"`
+	NextOffset *int64      `json:"next_offset,omitempty"`
+	Skipped    int64       `json:"skipped,omitempty"`
+	Count      int         `json:"count"`
+	Entries    []DataEntry `json:"entries"`
+	Time       string      `json:"time"`
+}
+
+type GroupCommitResponse struct {
+	Response
+	AppName   string `json:"app_name"`
+	Method    string `json:"method"`
+	Group     string `json:"group"`
+	Committed int64  `json:"committed"`
+	Lag       int64  `json:"lag"`
+}
+
+type GroupResponse struct {
+	Response
+	AppName string `json:"app_name"`
+	Method  string `json:"method"`
+	GroupStatus
+}
+
+type GroupListResponse struct {
+	Response
+	AppName string        `json:"app_name"`
+	Method  string        `json:"method"`
+	Count   int           `json:"count"`
+	Groups  []GroupStatus `json:"groups"`
+}
+
+var (
+	errGroupExists      = errors.New("group already exists")
+	errGroupNotFound    = errors.New("group not found")
+	errOffsetOutOfRange = errors.New("offset out of range")
+)
+
+// CreateGroup starts a consumer group on methodName. A group created with
+// fromLatest set skips everything stored so far; otherwise it starts at the
+// beginning of the stream.
+func (reg *Registry) CreateGroup(appName, methodName, group string, fromLatest bool) (GroupStatus, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return GroupStatus{}, fmt.Errorf("protocol %s not found", appName)
+	}
+
+	groups, ok := protocol.Groups[methodName]
+	if !ok {
+		groups = make(map[string]int64)
+		protocol.Groups[methodName] = groups
+	}
+	if _, ok := groups[group]; ok {
+		return GroupStatus{}, errGroupExists
+	}
+	groups[group] = 0
+	if fromLatest {
+		groups[group] = protocol.Offsets[methodName]
+	}
+	return groupStatus(protocol, methodName, group), nil
+}
+
+// ReadGroup returns the retained entries after the group's committed offset.
+// Entries trimmed from history before the group read them cannot be
+// returned any more; skipped counts them, so the consumer knows it has a
+// gap. ok is false if there is no such group.
+func (reg *Registry) ReadGroup(appName, methodName, group string, max int) (entries []DataEntry, skipped int64, status GroupStatus, ok bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return nil, 0, GroupStatus{}, false
+	}
+	committed, ok := protocol.Groups[methodName][group]
+	if !ok {
+		return nil, 0, GroupStatus{}, false
+	}
+
+	entries, skipped = readAfter(protocol, methodName, committed, max)
+	return entries, skipped, groupStatus(protocol, methodName, group), true
+}
+
+// ReadAfter is ReadGroup for a reader that keeps its own position: it
+// returns the entries after offset and the latest offset, and keeps no
+// state on the bus.
+func (reg *Registry) ReadAfter(appName, methodName string, offset int64, max int) (entries []DataEntry, skipped, latest int64, ok bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return nil, 0, 0, false
+	}
+
+	entries, skipped = readAfter(protocol, methodName, offset, max)
+	return entries, skipped, protocol.Offsets[methodName], true
+}
+
+func readAfter(protocol *CustomProtocol, methodName string, offset int64, max int) ([]DataEntry, int64) {
+	if max <= 0 {
+		max = DefaultGroupBatch
+	}
+
+	history := protocol.History[methodName]
+	first := protocol.Offsets[methodName] + 1
+	if len(history) > 0 {
+		first = history[0].Offset
+	}
+	var skipped int64
+	if first > offset+1 {
+		skipped = first - offset - 1
+	}
+
+	entries := []DataEntry{}
+	for _, entry := range history {
+		if entry.Offset <= offset {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) == max {
+			break
+		}
+	}
+	return entries, skipped
+}
+
+func (reg *Registry) CommitOffset(appName, methodName, group string, offset int64) (GroupStatus, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return GroupStatus{}, errGroupNotFound
+	}
+	if _, ok := protocol.Groups[methodName][group]; !ok {
+		return GroupStatus{}, errGroupNotFound
+	}
+	if offset < 0 || offset > protocol.Offsets[methodName] {
+		return GroupStatus{}, errOffsetOutOfRange
+	}
+	protocol.Groups[methodName][group] = offset
+
+	return groupStatus(protocol, methodName, group), nil
+}
+
+func (reg *Registry) DeleteGroup(appName, methodName, group string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return false
+	}
+	if _, ok := protocol.Groups[methodName][group]; !ok {
+		return false
+	}
+	delete(protocol.Groups[methodName], group)
+	return true
+}
+
+func (reg *Registry) ListGroups(appName, methodName string) ([]GroupStatus, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return nil, false
+	}
+
+	statuses := []GroupStatus{}
+	for group := range protocol.Groups[methodName] {
+		statuses = append(statuses, groupStatus(protocol, methodName, group))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Group < statuses[j].Group
+	})
+	return statuses, true
+}
+
+func groupStatus(protocol *CustomProtocol, methodName, group string) GroupStatus {
+	committed := protocol.Groups[methodName][group]
+	latest := protocol.Offsets[methodName]
+	return GroupStatus{
+		Group:     group,
+		Committed: committed,
+		Latest:    latest,
+		Lag:       latest - committed,
+	}
+}
+
+func (s *Server) handleGroupNext(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	if !s.authorize(w, r, appName) {
+		return
+	}
+
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return
+	}
+
+	query := r.URL.Query()
+	max, _ := strconv.Atoi(query.Get("max"))
+	group := query.Get("group")
+	if group == "" {
+		s.readAfter(w, r, appName, methodName, max)
+		return
+	}
+
+	entries, skipped, status, ok := s.registry.ReadGroup(appName, methodName, group, max)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, CodeGroupNotFound, "Group not found")
+		return
+	}
+
+	response := &GroupReadResponse{
+		AppName:   appName,
+		Method:    methodName,
+		Group:     group,
+		Committed: status.Committed,
+		Latest:    status.Latest,
+		Lag:       status.Lag,
+		Skipped:   skipped,
+		Count:     len(entries),
+		Entries:   entries,
+		Time:      time.Now().Format(time.RFC3339),
+	}
+	if len(entries) > 0 {
+		next := entries[len(entries)-1].Offset
+		response.NextOffset = &next
+	}
+
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+// readAfter answers a /next without a group, which reads after the offset
+// in the after parameter instead of a committed one.
+func (s *Server) readAfter(w http.ResponseWriter, r *http.Request, appName, methodName string, max int) {
+	after, err := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+	if err != nil || after < 0 {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Missing group or after parameter")
+		return
+	}
+
+	entries, skipped, latest, _ := s.registry.ReadAfter(appName, methodName, after, max)
+	lag := latest - after
+	if lag < 0 {
+		lag = 0
+	}
+	response := &GroupReadResponse{
+		AppName:   appName,
+		Method:    methodName,
+		Committed: after,
+		Latest:    latest,
+		Lag:       lag,
+		Skipped:   skipped,
+		Count:     len(entries),
+		Entries:   entries,
+		Time:      time.Now().Format(time.RFC3339),
+	}
+	if len(entries) > 0 {
+		next := entries[len(entries)-1].Offset
+		response.NextOffset = &next
+	}
+
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+func (s *Server) handleGroupCommit(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	if !s.authorize(w, r, appName) {
+		return
+	}
+
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return
+	}
+
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Missing group parameter")
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid offset parameter")
+		return
+	}
+
+	status, err := s.registry.CommitOffset(appName, methodName, group, offset)
+	if errors.Is(err, errGroupNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeGroupNotFound, "Group not found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeOffsetOutOfRange, "Offset out of range")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, &GroupCommitResponse{
+		AppName:   appName,
+		Method:    methodName,
+		Group:     group,
+		Committed: status.Committed,
+		Lag:       status.Lag,
+	})
+}
+
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	if !s.authorize(w, r, appName) {
+		return
+	}
+
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var request struct {
+			Group string `json:"group"`
+			Start string `json:"start"`
+		}
+		s.limitBody(w, r, appName)
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			if !s.rejectedTooLarge(w, r, appName, err) {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+			}
+			return
+		}
+		if request.Group == "" {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Missing group")
+			return
+		}
+		if request.Start != "" && request.Start != "earliest" && request.Start != "latest" {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "start must be earliest or latest")
+			return
+		}
+
+		status, err := s.registry.CreateGroup(appName, methodName, request.Group, request.Start == "latest")
+		if errors.Is(err, errGroupExists) {
+			writeError(w, r, http.StatusConflict, CodeConflict, "Group already exists")
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create group")
+			return
+		}
+		writeJSON(w, r, http.StatusCreated, &GroupResponse{
+			AppName:     appName,
+			Method:      methodName,
+			GroupStatus: status,
+		})
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		group := r.URL.Query().Get("group")
+		if !s.registry.DeleteGroup(appName, methodName, group) {
+			writeError(w, r, http.StatusNotFound, CodeGroupNotFound, "Group not found")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, &MessageResponse{
+			AppName: appName,
+			Method:  methodName,
+			Message: "Consumer group " + group + " deleted",
+		})
+		return
+	}
+
+	groups, _ := s.registry.ListGroups(appName, methodName)
+	writeJSON(w, r, http.StatusOK, &GroupListResponse{
+		AppName: appName,
+		Method:  methodName,
+		Count:   len(groups),
+		Groups:  groups,
+	})
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// Version is stamped at build time with
+// -ldflags "-X freeport/api.Version=v1.2.3".
+var Version = "dev"
+
+var startedAt = time.Now()
+
+type ProtocolInfo struct {
+	AppName     string       `json:"app_name"`
+	Description string       `json:"description"`
+	Methods     []MethodInfo `json:"methods"`
+}
+
+type MethodInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+type HealthResponse struct {
+	Response
+	Uptime string `json:"uptime"`
+}
+
+type ReadyResponse struct {
+	Response
+	Ready bool `json:"ready"`
+}
+
+type VersionResponse struct {
+	Response
+	BuildInfo
+}
+
+type ProtocolsResponse struct {
+	Response
+	Count     int            `json:"count"`
+	Protocols []ProtocolInfo `json:"protocols"`
+}
+
+type ProtocolResponse struct {
+	Response
+	ProtocolInfo
+}
+
+type RootResponse struct {
+	Response
+	AppName    string   `json:"app_name"`
+	Version    string   `json:"version"`
+	APIVersion string   `json:"api_version"`
+	Endpoints  []string `json:"endpoints"`
+}
+
+func protocolInfo(protocol *CustomProtocol) ProtocolInfo {
+	info := ProtocolInfo{
+		AppName:     protocol.AppName,
+		Description: protocol.Description,
+		Methods:     []MethodInfo{},
+	}
+	for _, name := range sortedKeys(protocol.Methods) {
+		info.Methods = append(info.Methods, MethodInfo{Name: name, Description: protocol.Methods[name]})
+	}
+	return info
+}
+
+func (reg *Registry) ListProtocols() []ProtocolInfo {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	infos := []ProtocolInfo{}
+	for _, protocol := range reg.protocols {
+		infos = append(infos, protocolInfo(protocol))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].AppName < infos[j].AppName
+	})
+	return infos
+}
+
+func (reg *Registry) GetProtocolInfo(appName string) (ProtocolInfo, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return ProtocolInfo{}, false
+	}
+	return protocolInfo(protocol), true
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.time":
+				info.BuildTime = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+func (s *Server) SetAdminToken(token string) {
+	s.adminToken = token
+}
+
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := r.Header.Get("X-Admin-Token")
+	if s.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		if !s.allowFailedAuth(w, r, "system") {
+			return false
+		}
+		s.registry.RecordAudit(AuditAuthFailed, "system", "", r.Method+" "+r.URL.Path, remoteAddr(r))
+		s.registry.metrics.recordAuthFailure("system")
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, &HealthResponse{
+		Uptime: time.Since(startedAt).Round(time.Second).String(),
+	})
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		writeError(w, r, http.StatusServiceUnavailable, CodeNotReady, "Server is starting")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, &ReadyResponse{Ready: true})
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, &VersionResponse{BuildInfo: buildInfo()})
+}
+
+func (s *Server) handleSystemProtocols(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	protocols := s.registry.ListProtocols()
+	writeJSON(w, r, http.StatusOK, &ProtocolsResponse{
+		Count:     len(protocols),
+		Protocols: protocols,
+	})
+}
+
+func (s *Server) handleCreateProtocol(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	var request struct {
+		AppName     string       `json:"app_name"`
+		Passkey     string       `json:"passkey"`
+		Description string       `json:"description"`
+		Methods     []MethodInfo `json:"methods"`
+	}
+	s.limitBody(w, r, "system")
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		if !s.rejectedTooLarge(w, r, "system", err) {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		}
+		return
+	}
+	if request.AppName == "" || request.Passkey == "" {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "app_name and passkey are required")
+		return
+	}
+	if request.AppName == "system" || request.AppName == APIVersion {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Reserved app name")
+		return
+	}
+	err := s.registry.CreateProtocol(request.AppName, request.Passkey, request.Description, request.Methods)
+	if errors.Is(err, ErrProtocolExists) {
+		writeError(w, r, http.StatusConflict, CodeConflict, "Protocol already exists")
+		return
+	}
+
+	info, _ := s.registry.GetProtocolInfo(request.AppName)
+	writeJSON(w, r, http.StatusCreated, &ProtocolResponse{ProtocolInfo: info})
+}
+
+func (s *Server) handleDeleteProtocol(w http.ResponseWriter, r *http.Request, appName string) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	if !s.registry.UnregisterProtocol(appName) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Protocol not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, &MessageResponse{
+		AppName: appName,
+		Message: "Protocol deleted",
+	})
+}
+
+func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, &RootResponse{
+		AppName:    "freeport",
+		Version:    Version,
+		APIVersion: APIVersion,
+		Endpoints: []string{
+			"/healthz",
+			"/readyz",
+			"/version",
+			"/metrics",
+			"/v1/system/battery",
+			"/v1/system/protocols",
+			"/v1/{app}/init",
+			"/v1/{app}/{method}",
+		},
+	})
+}
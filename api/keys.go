@@ -0,0 +1,381 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultKeyPage = 100
+	maxKeyPage     = 1000
+)
+
+// keyed is the value stored under one key of a method. Each key has its own
+// revision, TTL and history, bounded by the method's retention. Keys live
+// on this instance only: they are not mirrored to peers, queued, or read by
+// derivations.
+type keyed struct {
+	data    interface{}
+	stamp   Stamp
+	expires time.Time
+	offset  int64
+	history []DataEntry
+}
+
+func (k *keyed) value() Value {
+	return Value{Data: k.data, Stored: k.stamp.Time, Revision: k.stamp.Revision(), Expires: k.expires}
+}
+
+// revision is the revision of the key's value at now, or "" if it has
+// expired.
+func (k *keyed) revision(now time.Time) string {
+	if k == nil || k.value().Expired(now) {
+		return ""
+	}
+	return k.stamp.Revision()
+}
+
+// KeyInfo describes one key in a listing.
+type KeyInfo struct {
+	Key      string     `json:"key"`
+	Revision string     `json:"revision"`
+	Stored   time.Time  `json:"stored"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Entries  int        `json:"entries"`
+}
+
+// keys returns the keys of methodName, making room for them on first use.
+// The caller holds reg.mu for writing.
+func (protocol *CustomProtocol) keys(methodName string) map[string]*keyed {
+	if protocol.Keys[methodName] == nil {
+		protocol.Keys[methodName] = make(map[string]*keyed)
+	}
+	return protocol.Keys[methodName]
+}
+
+var (
+	errKeyNotFound = errors.New("key not found")
+	errTooManyKeys = errors.New("too many keys")
+)
+
+// StoreKey stores data under key on appName/methodName if cond holds for
+// the key's current value, and returns the new revision. A ttl of 0 uses
+// the method's retention. A new key fails with errTooManyKeys once the
+// method holds as many unexpired keys as its limits allow.
+func (reg *Registry) StoreKey(appName, methodName, key, source string, data interface{}, ttl time.Duration, cond *Precondition) (string, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return "", errKeyNotFound
+	}
+	now := time.Now()
+	k := protocol.Keys[methodName][key]
+	if cond != nil && !cond.holds(k.revision(now)) {
+		return "", ErrPreconditionFailed
+	}
+
+	if k == nil {
+		keys := protocol.keys(methodName)
+		if limit := reg.maxKeys(protocol); limit > 0 && len(keys) >= limit {
+			for name, other := range keys {
+				if other.value().Expired(now) {
+					delete(keys, name)
+				}
+			}
+			if len(keys) >= limit {
+				return "", errTooManyKeys
+			}
+		}
+		k = &keyed{}
+		keys[key] = k
+	}
+	k.data = data
+	k.stamp = nextStamp(reg.node, k.stamp)
+	k.expires = time.Time{}
+	if ttl == 0 {
+		ttl = protocol.ttl(methodName)
+	}
+	if ttl > 0 {
+		k.expires = k.stamp.Time.Add(ttl)
+	}
+
+	k.offset++
+	k.history = append(k.history, DataEntry{Offset: k.offset, Data: data, Timestamp: k.stamp.Time, Source: source})
+	if limit := protocol.historyLimit(methodName); len(k.history) > limit {
+		k.history = k.history[len(k.history)-limit:]
+	}
+	return k.stamp.Revision(), nil
+}
+
+// Key returns the value under key, expired or not, as long as the reaper
+// has not removed it yet.
+func (reg *Registry) Key(appName, methodName, key string) (Value, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists {
+		if k := protocol.Keys[methodName][key]; k != nil {
+			return k.value(), true
+		}
+	}
+	return Value{}, false
+}
+
+// KeyRevision returns the revision of the current value under key.
+func (reg *Registry) KeyRevision(appName, methodName, key string) (string, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists {
+		revision := protocol.Keys[methodName][key].revision(time.Now())
+		return revision, revision != ""
+	}
+	return "", false
+}
+
+// DeleteKey removes key and its history if cond holds for its current
+// value. It fails with errKeyNotFound if there is no such key.
+func (reg *Registry) DeleteKey(appName, methodName, key string, cond *Precondition) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return errKeyNotFound
+	}
+	k := protocol.Keys[methodName][key]
+	if k == nil {
+		return errKeyNotFound
+	}
+	if cond != nil && !cond.holds(k.revision(time.Now())) {
+		return ErrPreconditionFailed
+	}
+	delete(protocol.Keys[methodName], key)
+	return nil
+}
+
+// ListKeys returns up to limit keys of appName/methodName that start with
+// prefix, in order, beginning after the key after. next is the after to
+// pass for the following page, or "" on the last one.
+func (reg *Registry) ListKeys(appName, methodName, prefix, after string, limit int) (keys []KeyInfo, next string) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	keys = []KeyInfo{}
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return keys, ""
+	}
+
+	names := make([]string, 0, len(protocol.Keys[methodName]))
+	for name := range protocol.Keys[methodName] {
+		if strings.HasPrefix(name, prefix) && name > after {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > limit {
+		names = names[:limit]
+		next = names[limit-1]
+	}
+
+	for _, name := range names {
+		k := protocol.Keys[methodName][name]
+		info := KeyInfo{Key: name, Revision: k.stamp.Revision(), Stored: k.stamp.Time, Entries: len(k.history)}
+		if !k.expires.IsZero() {
+			expires := k.expires
+			info.Expires = &expires
+		}
+		keys = append(keys, info)
+	}
+	return keys, next
+}
+
+// KeyHistory returns the last limit values stored under key.
+func (reg *Registry) KeyHistory(appName, methodName, key string, limit int) ([]DataEntry, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists {
+		if k := protocol.Keys[methodName][key]; k != nil {
+			start := 0
+			if len(k.history) > limit {
+				start = len(k.history) - limit
+			}
+			return k.history[start:], true
+		}
+	}
+	return nil, false
+}
+
+// reapKeys removes the keys that have expired by now. Unlike a method's
+// value, an expired key goes with its history. The caller holds reg.mu.
+func (protocol *CustomProtocol) reapKeys(now time.Time) int {
+	reaped := 0
+	for _, keys := range protocol.Keys {
+		for name, k := range keys {
+			if k.value().Expired(now) {
+				delete(keys, name)
+				reaped++
+			}
+		}
+	}
+	return reaped
+}
+
+type KeysResponse struct {
+	Response
+	AppName string    `json:"app_name"`
+	Method  string    `json:"method"`
+	Prefix  string    `json:"prefix,omitempty"`
+	Count   int       `json:"count"`
+	Keys    []KeyInfo `json:"keys"`
+	Next    string    `json:"next,omitempty"`
+}
+
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	if !s.authorize(w, r, appName) {
+		return
+	}
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultKeyPage
+	if text := query.Get("limit"); text != "" {
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = min(n, maxKeyPage)
+	}
+
+	prefix := query.Get("prefix")
+	keys, next := s.registry.ListKeys(appName, methodName, prefix, query.Get("after"), limit)
+	writeJSON(w, r, http.StatusOK, &KeysResponse{
+		AppName: appName,
+		Method:  methodName,
+		Prefix:  prefix,
+		Count:   len(keys),
+		Keys:    keys,
+		Next:    next,
+	})
+}
+
+func (s *Server) handleKey(w http.ResponseWriter, r *http.Request, appName, methodName, key string) {
+	if !s.authorize(w, r, appName) {
+		return
+	}
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		value, exists := s.registry.Key(appName, methodName, key)
+		if !exists {
+			writeError(w, r, http.StatusNotFound, CodeNoData, "No data under this key")
+			return
+		}
+		writeValue(w, r, value, ValueResponse{AppName: appName, Method: methodName, Key: key})
+
+	case http.MethodPut:
+		if s.registry.IsDerived(appName, methodName) {
+			writeError(w, r, http.StatusConflict, CodeConflict, "Method is derived from other methods and cannot be written to")
+			return
+		}
+		ttl, err := requestTTL(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, err.Error())
+			return
+		}
+
+		payload, source, ok := s.readPayload(w, r, appName, isJSONContent(r.Header.Get("Content-Type")))
+		if !ok || !s.checkSchema(w, r, appName, methodName, payload) {
+			return
+		}
+
+		revision, err := s.registry.StoreKey(appName, methodName, key, source, payload, ttl, requestPrecondition(r))
+		if errors.Is(err, ErrPreconditionFailed) {
+			current, _ := s.registry.KeyRevision(appName, methodName, key)
+			writePreconditionFailed(w, r, current)
+			return
+		}
+		if errors.Is(err, errTooManyKeys) {
+			writeErrorDetails(w, r, http.StatusConflict, CodeTooManyKeys, "Method holds too many keys", map[string]interface{}{
+				"max_keys": s.registry.GetLimits(appName).MaxKeys,
+			})
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to store data")
+			return
+		}
+
+		response := &StoreResponse{
+			AppName:   appName,
+			Method:    methodName,
+			Key:       key,
+			Message:   "Data stored successfully",
+			Timestamp: time.Now().Format(time.RFC3339),
+			Revision:  revision,
+		}
+		if value, ok := s.registry.Key(appName, methodName, key); ok && value.Revision == revision && !value.Expires.IsZero() {
+			response.Expires = value.Expires.Format(time.RFC3339)
+		}
+		w.Header().Set("ETag", etag(revision))
+		if blob, ok := payload.(*Blob); ok {
+			response.ContentType = blob.ContentType
+			response.Size = blob.Size
+			response.SHA256 = blob.SHA256
+		}
+		writeJSON(w, r, http.StatusOK, response)
+
+	case http.MethodDelete:
+		err := s.registry.DeleteKey(appName, methodName, key, requestPrecondition(r))
+		switch {
+		case errors.Is(err, errKeyNotFound):
+			writeError(w, r, http.StatusNotFound, CodeNoData, "No data under this key")
+		case errors.Is(err, ErrPreconditionFailed):
+			current, _ := s.registry.KeyRevision(appName, methodName, key)
+			writePreconditionFailed(w, r, current)
+		default:
+			writeJSON(w, r, http.StatusOK, &MessageResponse{
+				AppName: appName,
+				Method:  methodName,
+				Message: "Key deleted successfully",
+			})
+		}
+	}
+}
+
+func (s *Server) handleKeyHistory(w http.ResponseWriter, r *http.Request, appName, methodName, key string) {
+	if !s.authorize(w, r, appName) {
+		return
+	}
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return
+	}
+
+	history, exists := s.registry.KeyHistory(appName, methodName, key, 10)
+	if !exists {
+		writeError(w, r, http.StatusNotFound, CodeNoData, "No history available")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, &HistoryResponse{
+		AppName: appName,
+		Method:  methodName,
+		Key:     key,
+		Count:   len(history),
+		History: history,
+	})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStoreKeyLimit(t *testing.T) {
+	registry, ts := newRevisionServer(t)
+	registry.SetProtocolLimits("app", Limits{MaxKeys: 2})
+
+	if _, err := registry.StoreKey("app", "k", "a", "test", json.RawMessage(`1`), 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.StoreKey("app", "k", "b", "test", json.RawMessage(`1`), time.Nanosecond, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := registry.StoreKey("app", "k", "c", "test", json.RawMessage(`1`), 0, nil); err != nil {
+		t.Fatalf("new key in place of an expired one: %v", err)
+	}
+	if _, err := registry.StoreKey("app", "k", "a", "test", json.RawMessage(`2`), 0, nil); err != nil {
+		t.Errorf("update at the limit: %v", err)
+	}
+	if _, err := registry.StoreKey("app", "k", "d", "test", json.RawMessage(`1`), 0, nil); !errors.Is(err, errTooManyKeys) {
+		t.Errorf("new key past the limit = %v, want errTooManyKeys", err)
+	}
+
+	resp, body := request(t, http.MethodPut, ts.URL+"/v1/app/k/keys/d", `1`)
+	apiError, _ := body["error"].(map[string]interface{})
+	if resp.StatusCode != http.StatusConflict || apiError["code"] != CodeTooManyKeys {
+		t.Errorf("PUT past the limit: %s %v, want 409 %s", resp.Status, body, CodeTooManyKeys)
+	}
+}
+
+func TestClearDataRemovesKeys(t *testing.T) {
+	registry, ts := newRevisionServer(t)
+	if _, err := registry.StoreKey("app", "k", "a", "test", json.RawMessage(`1`), 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	registry.ClearData("app", "k")
+	if _, exists := registry.KeyHistory("app", "k", "a", 10); exists {
+		t.Error("key survived ClearData")
+	}
+
+	resp, body := request(t, http.MethodGet, ts.URL+"/v1/app/missing/keys/a/history", "")
+	apiError, _ := body["error"].(map[string]interface{})
+	if resp.StatusCode != http.StatusNotFound || apiError["code"] != CodeMethodNotFound {
+		t.Errorf("history of a missing method: %s %v, want 404 %s", resp.Status, body, CodeMethodNotFound)
+	}
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Limits struct {
+	MaxPayload        int64
+	RequestsPerSecond float64
+	Burst             int
+	// MaxKeys bounds the keys each method of a protocol holds.
+	MaxKeys int
+}
+
+type RejectionStats struct {
+	PayloadTooLarge int64
+	RateLimited     int64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// DefaultLimits are the limits of a registry until SetDefaultLimits
+// changes them.
+var DefaultLimits = Limits{
+	MaxPayload:        10 << 20,
+	RequestsPerSecond: 50,
+	Burst:             100,
+	MaxKeys:           10000,
+}
+
+// failedAuthLimits is the budget of requests that fail to authenticate,
+// kept apart from the app's own so that guessing at an app's passkey cannot
+// get the app itself rate limited.
+var failedAuthLimits = Limits{
+	RequestsPerSecond: 1,
+	Burst:             10,
+}
+
+// limiter is the rate limiting and rejection bookkeeping of a registry.
+type limiter struct {
+	mu         sync.Mutex
+	defaults   Limits
+	configured map[string]Limits
+	buckets    map[string]*tokenBucket
+	failedAuth map[string]*tokenBucket
+	rejections map[string]*RejectionStats
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		defaults:   DefaultLimits,
+		configured: make(map[string]Limits),
+		buckets:    make(map[string]*tokenBucket),
+		failedAuth: make(map[string]*tokenBucket),
+		rejections: make(map[string]*RejectionStats),
+	}
+}
+
+func (reg *Registry) SetDefaultLimits(limits Limits) {
+	reg.limits.mu.Lock()
+	defer reg.limits.mu.Unlock()
+	reg.limits.defaults = limits
+}
+
+// ConfigureProtocolLimits sets the limits of appName now if it exists, and
+// again whenever a protocol of that name is created, however that happens.
+func (reg *Registry) ConfigureProtocolLimits(appName string, limits Limits) {
+	reg.limits.mu.Lock()
+	reg.limits.configured[appName] = limits
+	reg.limits.mu.Unlock()
+	reg.SetProtocolLimits(appName, limits)
+}
+
+// configuredLimits returns the limits configured for appName, or nil.
+func (reg *Registry) configuredLimits(appName string) *Limits {
+	reg.limits.mu.Lock()
+	defer reg.limits.mu.Unlock()
+	if limits, ok := reg.limits.configured[appName]; ok {
+		return &limits
+	}
+	return nil
+}
+
+func (reg *Registry) SetProtocolLimits(appName string, limits Limits) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if protocol, exists := reg.protocols[appName]; exists {
+		protocol.Limits = &limits
+		return true
+	}
+	return false
+}
+
+// GetLimits returns the limits for a protocol, falling back to the server
+// defaults for any field the protocol leaves at zero.
+func (reg *Registry) GetLimits(appName string) Limits {
+	reg.limits.mu.Lock()
+	limits := reg.limits.defaults
+	reg.limits.mu.Unlock()
+
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists && protocol.Limits != nil {
+		if protocol.Limits.MaxPayload > 0 {
+			limits.MaxPayload = protocol.Limits.MaxPayload
+		}
+		if protocol.Limits.RequestsPerSecond > 0 {
+			limits.RequestsPerSecond = protocol.Limits.RequestsPerSecond
+		}
+		if protocol.Limits.Burst > 0 {
+			limits.Burst = protocol.Limits.Burst
+		}
+		if protocol.Limits.MaxKeys > 0 {
+			limits.MaxKeys = protocol.Limits.MaxKeys
+		}
+	}
+	return limits
+}
+
+// maxKeys is GetLimits(...).MaxKeys for a caller that holds reg.mu.
+func (reg *Registry) maxKeys(protocol *CustomProtocol) int {
+	if protocol.Limits != nil && protocol.Limits.MaxKeys > 0 {
+		return protocol.Limits.MaxKeys
+	}
+	reg.limits.mu.Lock()
+	defer reg.limits.mu.Unlock()
+	return reg.limits.defaults.MaxKeys
+}
+
+func (reg *Registry) GetRejections(appName string) RejectionStats {
+	reg.limits.mu.Lock()
+	defer reg.limits.mu.Unlock()
+	if stats, ok := reg.limits.rejections[appName]; ok {
+		return *stats
+	}
+	return RejectionStats{}
+}
+
+func (reg *Registry) recordRejection(appName string, status int) {
+	reg.limits.mu.Lock()
+	defer reg.limits.mu.Unlock()
+	stats, ok := reg.limits.rejections[appName]
+	if !ok {
+		stats = &RejectionStats{}
+		reg.limits.rejections[appName] = stats
+	}
+	switch status {
+	case http.StatusRequestEntityTooLarge:
+		stats.PayloadTooLarge++
+	case http.StatusTooManyRequests:
+		stats.RateLimited++
+	}
+}
+
+// takeToken reports whether the bucket named key may take another request,
+// and if not, how long it should wait before retrying.
+func (l *limiter) takeToken(buckets map[string]*tokenBucket, key string, limits Limits) (bool, time.Duration) {
+	if limits.RequestsPerSecond <= 0 {
+		return true, 0
+	}
+	burst := float64(limits.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limits.RequestsPerSecond)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := (1 - bucket.tokens) / limits.RequestsPerSecond
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// allowRequest charges an authenticated request to its app's bucket. It
+// writes the 429 itself and reports false once the bucket is empty.
+func (s *Server) allowRequest(w http.ResponseWriter, r *http.Request, appName string) bool {
+	if !s.registry.ProtocolExists(appName) {
+		return true
+	}
+
+	limiter := s.registry.limits
+	ok, wait := limiter.takeToken(limiter.buckets, appName, s.registry.GetLimits(appName))
+	if ok {
+		return true
+	}
+
+	s.registry.recordRejection(appName, http.StatusTooManyRequests)
+	writeRateLimited(w, r, wait)
+	return false
+}
+
+// allowFailedAuth charges a request that failed to authenticate to the
+// failed-auth bucket of appName, which apps that are not registered share.
+func (s *Server) allowFailedAuth(w http.ResponseWriter, r *http.Request, appName string) bool {
+	limiter := s.registry.limits
+	ok, wait := limiter.takeToken(limiter.failedAuth, s.registry.metricsApp(appName), failedAuthLimits)
+	if ok {
+		return true
+	}
+
+	writeRateLimited(w, r, wait)
+	return false
+}
+
+func writeRateLimited(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeErrorDetails(w, r, http.StatusTooManyRequests, CodeRateLimited, "Too many requests", map[string]interface{}{
+		"retry_after_seconds": retryAfter,
+	})
+}
+
+// limitBody caps r's body at the payload limit of appName. Admin endpoints
+// pass "system", which gets the default limit.
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request, appName string) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.registry.GetLimits(appName).MaxPayload)
+}
+
+// rejectedTooLarge answers 413 and reports true if err means a body cut off
+// by limitBody.
+func (s *Server) rejectedTooLarge(w http.ResponseWriter, r *http.Request, appName string, err error) bool {
+	var maxErr *http.MaxBytesError
+	if !errors.As(err, &maxErr) {
+		return false
+	}
+	s.rejectTooLarge(w, r, appName, maxErr.Limit)
+	return true
+}
+
+func (s *Server) rejectTooLarge(w http.ResponseWriter, r *http.Request, appName string, limit int64) {
+	s.registry.recordRejection(appName, http.StatusRequestEntityTooLarge)
+	writeErrorDetails(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Payload too large", map[string]interface{}{
+		"max_bytes": limit,
+	})
+}
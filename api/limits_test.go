@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimits(t *testing.T) {
+	registry := NewRegistry()
+	registry.SetDefaultLimits(Limits{MaxPayload: 64})
+	registry.RegisterProtocol("app", "key", "")
+	registry.RegisterMethod("app", "m", "")
+	server := NewServer("0")
+	server.SetRegistry(registry)
+	server.SetAdminToken("admin")
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	big := `{"pad":"` + strings.Repeat("x", 100) + `"}`
+	tests := []struct {
+		method, path string
+	}{
+		{http.MethodPost, "/v1/system/protocols"},
+		{http.MethodPut, "/v1/system/manifest"},
+		{http.MethodPost, "/v1/system/snapshot?mode=merge"},
+		{http.MethodPut, "/v1/system/generators/app/m"},
+		{http.MethodPost, "/v1/app/m/groups"},
+		{http.MethodPut, "/v1/app/m/queue"},
+		{http.MethodPost, "/v1/app/m/replay"},
+	}
+	for _, tt := range tests {
+		resp, body := request(t, tt.method, ts.URL+tt.path, big, "X-Admin-Token", "admin")
+		apiError, _ := body["error"].(map[string]interface{})
+		if resp.StatusCode != http.StatusRequestEntityTooLarge || apiError["code"] != CodePayloadTooLarge {
+			t.Errorf("%s %s: %s %v, want 413", tt.method, tt.path, resp.Status, body)
+		}
+	}
+}
+
+func TestCappedReader(t *testing.T) {
+	for _, size := range []int{9, 10} {
+		r := &cappedReader{r: strings.NewReader(strings.Repeat("x", size)), left: 10}
+		data, err := io.ReadAll(r)
+		if err != nil || len(data) != size {
+			t.Errorf("%d bytes: read %d, %v", size, len(data), err)
+		}
+	}
+	r := &cappedReader{r: strings.NewReader(strings.Repeat("x", 11)), left: 10}
+	if data, err := io.ReadAll(r); !errors.Is(err, ErrSnapshotTooLarge) || len(data) != 10 {
+		t.Errorf("11 bytes: read %d, %v; want 10 and ErrSnapshotTooLarge", len(data), err)
+	}
+}
@@ -0,0 +1,301 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const logBufferSize = 500
+
+type AccessEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	App       string    `json:"app,omitempty"`
+	Status    int       `json:"status"`
+	LatencyMs float64   `json:"latency_ms"`
+	Bytes     int64     `json:"bytes"`
+	Source    string    `json:"source"`
+}
+
+type AuditEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	App    string    `json:"app,omitempty"`
+	Method string    `json:"method,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+	Source string    `json:"source,omitempty"`
+}
+
+const (
+	AuditAuthFailed       = "auth_failed"
+	AuditProtocolCreated  = "protocol_created"
+	AuditProtocolDeleted  = "protocol_deleted"
+	AuditDataCleared      = "data_cleared"
+	AuditSnapshotRestored = "snapshot_restored"
+	AuditReplayStarted    = "replay_started"
+	AuditAlertFired       = "alert_fired"
+	AuditAlertResolved    = "alert_resolved"
+)
+
+// RotatingFile is an io.Writer that starts a new file once the current one
+// reaches MaxBytes, keeping at most MaxBackups old files alongside it.
+type RotatingFile struct {
+	Path       string
+	MaxBytes   int64
+	MaxBackups int
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+}
+
+func NewRotatingFile(path string, maxBytes int64, maxBackups int) *RotatingFile {
+	return &RotatingFile{Path: path, MaxBytes: maxBytes, MaxBackups: maxBackups}
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.MaxBytes > 0 && f.size+int64(len(p)) > f.MaxBytes && f.size > 0 {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+
+	for i := f.MaxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.Path, i), fmt.Sprintf("%s.%d", f.Path, i+1))
+	}
+	if f.MaxBackups > 0 {
+		os.Rename(f.Path, f.Path+".1")
+	} else {
+		os.Remove(f.Path)
+	}
+	return f.open()
+}
+
+// logs keeps the recent access log and audit trail of one registry and
+// copies both to their writers.
+type logs struct {
+	mu           sync.Mutex
+	access       []AccessEntry
+	audit        []AuditEvent
+	accessWriter io.Writer
+	auditWriter  io.Writer
+}
+
+func newLogs() *logs {
+	return &logs{accessWriter: io.Discard, auditWriter: io.Discard}
+}
+
+// ConfigureLogging writes the access log and audit trail as JSON lines to
+// rotating files in dir.
+func (reg *Registry) ConfigureLogging(dir string, maxBytes int64, maxBackups int) {
+	l := reg.logs
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.accessWriter = NewRotatingFile(filepath.Join(dir, "access.log"), maxBytes, maxBackups)
+	l.auditWriter = NewRotatingFile(filepath.Join(dir, "audit.log"), maxBytes, maxBackups)
+}
+
+func (reg *Registry) RecordAudit(kind, appName, methodName, detail, source string) {
+	event := AuditEvent{
+		Time:   time.Now(),
+		Kind:   kind,
+		App:    appName,
+		Method: methodName,
+		Detail: detail,
+		Source: source,
+	}
+
+	l := reg.logs
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.audit = append(l.audit, event)
+	if len(l.audit) > logBufferSize {
+		l.audit = l.audit[1:]
+	}
+	writeJSONLine(l.auditWriter, event)
+}
+
+func (reg *Registry) recordAccess(entry AccessEntry) {
+	l := reg.logs
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.access = append(l.access, entry)
+	if len(l.access) > logBufferSize {
+		l.access = l.access[1:]
+	}
+	writeJSONLine(l.accessWriter, entry)
+}
+
+func writeJSONLine(w io.Writer, v interface{}) {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	w.Write(append(line, '\n'))
+}
+
+func (reg *Registry) RecentAccessLog(limit int) []AccessEntry {
+	l := reg.logs
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	start := 0
+	if len(l.access) > limit {
+		start = len(l.access) - limit
+	}
+	return append([]AccessEntry(nil), l.access[start:]...)
+}
+
+func (reg *Registry) RecentAuditLog(limit int) []AuditEvent {
+	l := reg.logs
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	start := 0
+	if len(l.audit) > limit {
+		start = len(l.audit) - limit
+	}
+	return append([]AuditEvent(nil), l.audit[start:]...)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	preview previewBuffer
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.preview.record(p[:n])
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func requestApp(r *http.Request) string {
+	if app := r.Header.Get("X-App-Name"); app != "" {
+		return app
+	}
+	segments := apiSegments(r)
+	if len(segments) == 0 {
+		return ""
+	}
+	return segments[0]
+}
+
+func (s *Server) logRequests(next *router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		body := &previewReader{ReadCloser: r.Body}
+		r.Body = body
+
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = withRequestID(r, id)
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		latency := time.Since(start)
+		app := requestApp(r)
+		labelApp, labelMethod := s.registry.metricsLabels(app, requestMethod(r))
+		if labelApp == "system" && labelMethod != "" && !next.systemEndpoint(labelMethod) {
+			labelMethod = "unknown"
+		}
+		s.registry.metrics.observeRequest(labelApp, labelMethod, rec.status, latency)
+
+		s.registry.recordAccess(AccessEntry{
+			Time:      start,
+			RequestID: id,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			App:       app,
+			Status:    rec.status,
+			LatencyMs: float64(latency.Microseconds()) / 1000,
+			Bytes:     rec.preview.total,
+			Source:    remoteAddr(r),
+		})
+
+		s.registry.publishTraffic(TrafficEvent{
+			Time:            start,
+			Verb:            r.Method,
+			Path:            r.URL.Path,
+			App:             app,
+			Method:          requestMethod(r),
+			Status:          rec.status,
+			Latency:         latency,
+			RequestBytes:    body.preview.total,
+			ResponseBytes:   rec.preview.total,
+			RequestPreview:  safePreview(r, &body.preview),
+			ResponsePreview: safePreview(r, &rec.preview),
+			Source:          remoteAddr(r),
+		})
+	})
+}
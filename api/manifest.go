@@ -0,0 +1,420 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// ManifestVersion is the format version written by Export and accepted by
+// Apply.
+const ManifestVersion = 1
+
+// Manifest declares protocols and their methods so the same set can be
+// applied to every bus. Passkeys are only needed to create a protocol and
+// are left out of exports unless asked for.
+type Manifest struct {
+	Version   int                `json:"version"`
+	Protocols []ManifestProtocol `json:"protocols"`
+}
+
+type ManifestProtocol struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Passkey     string           `json:"passkey,omitempty"`
+	Retention   *Retention       `json:"retention,omitempty"`
+	Methods     []ManifestMethod `json:"methods,omitempty"`
+}
+
+type ManifestMethod struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Schema      *Schema     `json:"schema,omitempty"`
+	Retention   *Retention  `json:"retention,omitempty"`
+	Derive      *Derivation `json:"derive,omitempty"`
+}
+
+// Change is one step Apply took, or would take on a dry run. Target is an
+// app name or app/method.
+type Change struct {
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Detail string `json:"detail,omitempty"`
+}
+
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+type ApplyOptions struct {
+	// Prune deletes protocols and methods the manifest does not mention.
+	Prune  bool
+	DryRun bool
+}
+
+// Validate checks the manifest on its own, before it is compared with a
+// registry.
+func (m *Manifest) Validate() error {
+	if m.Version != 0 && m.Version != ManifestVersion {
+		return fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+
+	seen := map[string]bool{}
+	for _, protocol := range m.Protocols {
+		switch {
+		case protocol.Name == "":
+			return fmt.Errorf("protocol without a name")
+		case protocol.Name == "system" || protocol.Name == APIVersion:
+			return fmt.Errorf("%s: reserved app name", protocol.Name)
+		case seen[protocol.Name]:
+			return fmt.Errorf("%s: listed twice", protocol.Name)
+		}
+		seen[protocol.Name] = true
+		if err := protocol.Retention.Check(); err != nil {
+			return fmt.Errorf("%s: retention: %w", protocol.Name, err)
+		}
+
+		methods := map[string]bool{}
+		for _, method := range protocol.Methods {
+			target := protocol.Name + "/" + method.Name
+			switch {
+			case method.Name == "":
+				return fmt.Errorf("%s: method without a name", protocol.Name)
+			case methods[method.Name]:
+				return fmt.Errorf("%s: listed twice", target)
+			}
+			methods[method.Name] = true
+			if err := method.Schema.Check(); err != nil {
+				return fmt.Errorf("%s: schema: %w", target, err)
+			}
+			if err := method.Retention.Check(); err != nil {
+				return fmt.Errorf("%s: retention: %w", target, err)
+			}
+			if method.Derive != nil {
+				if _, err := method.Derive.compile(protocol.Name); err != nil {
+					return fmt.Errorf("%s: derive: %w", target, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Apply makes the registry match the manifest and returns what it changed.
+// Applying the same manifest again changes nothing. Either every change is
+// made or, if the manifest is invalid, none is. Derived methods that are new
+// or changed are evaluated once their sources have values.
+func (reg *Registry) Apply(m *Manifest, options ApplyOptions) ([]Change, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	changes, derive, err := reg.apply(m, options)
+	for _, target := range derive {
+		reg.derive(target)
+	}
+	return changes, err
+}
+
+func (reg *Registry) apply(m *Manifest, options ApplyOptions) ([]Change, []methodRef, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for _, declared := range m.Protocols {
+		if _, exists := reg.protocols[declared.Name]; !exists && declared.Passkey == "" {
+			return nil, nil, fmt.Errorf("%s: a passkey is needed to create the protocol", declared.Name)
+		}
+	}
+	if err := checkDerivations(reg.plannedDerivations(m, options.Prune)); err != nil {
+		return nil, nil, err
+	}
+	var derive []methodRef
+
+	changes := []Change{}
+	change := func(action, target, detail string) {
+		changes = append(changes, Change{Action: action, Target: target, Detail: detail})
+	}
+
+	declaredNames := map[string]bool{}
+	for _, declared := range m.Protocols {
+		declaredNames[declared.Name] = true
+
+		protocol, exists := reg.protocols[declared.Name]
+		if !exists {
+			change(ChangeCreate, declared.Name, declared.Description)
+			if options.DryRun {
+				for _, method := range declared.Methods {
+					if method.Name != "init" {
+						change(ChangeCreate, declared.Name+"/"+method.Name, method.Description)
+					}
+				}
+				continue
+			}
+			protocol = reg.newProtocol(declared.Name, declared.Passkey, declared.Description)
+			reg.protocols[declared.Name] = protocol
+			reg.RecordAudit(AuditProtocolCreated, declared.Name, "", declared.Description, "manifest")
+		} else {
+			if protocol.Description != declared.Description {
+				change(ChangeUpdate, declared.Name, "description")
+			}
+			if declared.Passkey != "" && protocol.Passkey != declared.Passkey {
+				change(ChangeUpdate, declared.Name, "passkey")
+			}
+			if protocol.Retention != retentionOf(declared.Retention) {
+				change(ChangeUpdate, declared.Name, "retention")
+			}
+			if !options.DryRun {
+				protocol.Description = declared.Description
+				if declared.Passkey != "" {
+					protocol.Passkey = declared.Passkey
+				}
+			}
+		}
+		if !options.DryRun {
+			protocol.Retention = retentionOf(declared.Retention)
+		}
+
+		declaredMethods := map[string]bool{"init": true}
+		for _, method := range declared.Methods {
+			declaredMethods[method.Name] = true
+			if method.Name == "init" {
+				continue
+			}
+			target := declared.Name + "/" + method.Name
+
+			description, exists := protocol.Methods[method.Name]
+			if !exists {
+				change(ChangeCreate, target, method.Description)
+			} else {
+				if description != method.Description {
+					change(ChangeUpdate, target, "description")
+				}
+				if !reflect.DeepEqual(protocol.Schemas[method.Name], method.Schema) {
+					change(ChangeUpdate, target, "schema")
+				}
+				if protocol.MethodRetention[method.Name] != retentionOf(method.Retention) {
+					change(ChangeUpdate, target, "retention")
+				}
+				if !reflect.DeepEqual(protocol.Derived[method.Name].declared(), method.Derive) {
+					change(ChangeUpdate, target, "derive")
+				}
+			}
+			if options.DryRun {
+				continue
+			}
+
+			protocol.Methods[method.Name] = method.Description
+			if method.Schema != nil {
+				protocol.Schemas[method.Name] = method.Schema
+			} else {
+				delete(protocol.Schemas, method.Name)
+			}
+			if method.Retention != nil {
+				protocol.MethodRetention[method.Name] = *method.Retention
+			} else {
+				delete(protocol.MethodRetention, method.Name)
+			}
+			switch {
+			case method.Derive == nil:
+				delete(protocol.Derived, method.Name)
+			case !reflect.DeepEqual(protocol.Derived[method.Name].declared(), method.Derive):
+				protocol.Derived[method.Name], _ = method.Derive.compile(declared.Name)
+				derive = append(derive, methodRef{declared.Name, method.Name})
+			}
+		}
+
+		if options.Prune {
+			for _, name := range sortedKeys(protocol.Methods) {
+				if declaredMethods[name] {
+					continue
+				}
+				change(ChangeDelete, declared.Name+"/"+name, "")
+				if !options.DryRun {
+					protocol.removeMethod(name)
+				}
+			}
+		}
+	}
+
+	if options.Prune {
+		names := make([]string, 0, len(reg.protocols))
+		for name := range reg.protocols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if declaredNames[name] {
+				continue
+			}
+			change(ChangeDelete, name, "")
+			if !options.DryRun {
+				delete(reg.protocols, name)
+				reg.stopGenerators(name)
+				reg.stopReplays(name)
+				reg.RecordAudit(AuditProtocolDeleted, name, "", "", "manifest")
+			}
+		}
+	}
+
+	return changes, derive, nil
+}
+
+// plannedDerivations is the derivation graph the registry would have after
+// applying m. The caller holds reg.mu.
+func (reg *Registry) plannedDerivations(m *Manifest, prune bool) map[methodRef][]methodRef {
+	graph := reg.derivationGraph()
+	declaredMethods := map[methodRef]bool{}
+	for _, declared := range m.Protocols {
+		for _, method := range declared.Methods {
+			ref := methodRef{declared.Name, method.Name}
+			declaredMethods[ref] = true
+			delete(graph, ref)
+			if method.Derive != nil {
+				d, _ := method.Derive.compile(declared.Name)
+				graph[ref] = d.sources()
+			}
+		}
+	}
+
+	if prune {
+		for ref := range graph {
+			if !declaredMethods[ref] {
+				delete(graph, ref)
+			}
+		}
+	}
+	return graph
+}
+
+// declared is the derivation as a manifest lists it, or nil.
+func (d *derived) declared() *Derivation {
+	if d == nil {
+		return nil
+	}
+	return &d.Derivation
+}
+
+func retentionOf(retention *Retention) Retention {
+	if retention == nil {
+		return Retention{}
+	}
+	return *retention
+}
+
+func (protocol *CustomProtocol) removeMethod(name string) {
+	delete(protocol.Methods, name)
+	delete(protocol.Data, name)
+	delete(protocol.History, name)
+	delete(protocol.Queues, name)
+	delete(protocol.Offsets, name)
+	delete(protocol.Groups, name)
+	delete(protocol.Stamps, name)
+	delete(protocol.Expires, name)
+	delete(protocol.Keys, name)
+	delete(protocol.Schemas, name)
+	delete(protocol.MethodRetention, name)
+	delete(protocol.Derived, name)
+}
+
+// Export describes the registry as a manifest that Apply would reproduce.
+func (reg *Registry) Export(includePasskeys bool) *Manifest {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.export(includePasskeys)
+}
+
+func (reg *Registry) export(includePasskeys bool) *Manifest {
+	names := make([]string, 0, len(reg.protocols))
+	for name := range reg.protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m := &Manifest{Version: ManifestVersion, Protocols: []ManifestProtocol{}}
+	for _, name := range names {
+		protocol := reg.protocols[name]
+		declared := ManifestProtocol{
+			Name:        name,
+			Description: protocol.Description,
+		}
+		if includePasskeys {
+			declared.Passkey = protocol.Passkey
+		}
+		if protocol.Retention != (Retention{}) {
+			retention := protocol.Retention
+			declared.Retention = &retention
+		}
+
+		for _, methodName := range sortedKeys(protocol.Methods) {
+			if methodName == "init" {
+				continue
+			}
+			method := ManifestMethod{
+				Name:        methodName,
+				Description: protocol.Methods[methodName],
+				Schema:      protocol.Schemas[methodName],
+			}
+			if retention, ok := protocol.MethodRetention[methodName]; ok {
+				method.Retention = &retention
+			}
+			method.Derive = protocol.Derived[methodName].declared()
+			declared.Methods = append(declared.Methods, method)
+		}
+		m.Protocols = append(m.Protocols, declared)
+	}
+	return m
+}
+
+type ManifestResponse struct {
+	Response
+	Manifest *Manifest `json:"manifest"`
+}
+
+type ApplyResponse struct {
+	Response
+	DryRun  bool     `json:"dry_run"`
+	Changes []Change `json:"changes"`
+}
+
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		writeJSON(w, r, http.StatusOK, &ManifestResponse{
+			Manifest: s.registry.Export(r.URL.Query().Get("passkeys") == "true"),
+		})
+		return
+	}
+
+	var m Manifest
+	s.limitBody(w, r, "system")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&m); err != nil {
+		if s.rejectedTooLarge(w, r, "system", err) {
+			return
+		}
+		writeErrorDetails(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid manifest", map[string]interface{}{
+			"reason": err.Error(),
+		})
+		return
+	}
+
+	options := ApplyOptions{
+		Prune:  r.URL.Query().Get("prune") == "true",
+		DryRun: r.URL.Query().Get("dry_run") == "true",
+	}
+	changes, err := s.registry.Apply(&m, options)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, &ApplyResponse{DryRun: options.DryRun, Changes: changes})
+}
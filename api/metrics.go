@@ -0,0 +1,293 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type requestKey struct {
+	app    string
+	method string
+	status int
+}
+
+type latencyKey struct {
+	app    string
+	method string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// metrics holds the request counters of one registry.
+type metrics struct {
+	mu           sync.Mutex
+	requests     map[requestKey]uint64
+	latencies    map[latencyKey]*histogram
+	authFailures map[string]uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:     make(map[requestKey]uint64),
+		latencies:    make(map[latencyKey]*histogram),
+		authFailures: make(map[string]uint64),
+	}
+}
+
+// metricsApp keeps label cardinality bounded: requests for apps that are not
+// registered are counted under "unknown".
+func (reg *Registry) metricsApp(appName string) string {
+	if appName == "system" {
+		return appName
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if _, exists := reg.protocols[appName]; exists {
+		return appName
+	}
+	return "unknown"
+}
+
+// metricsLabels bounds the method label the same way: a method that is
+// not registered on its app is counted under "unknown". System endpoints
+// are checked against the routes by the caller.
+func (reg *Registry) metricsLabels(appName, methodName string) (string, string) {
+	app := reg.metricsApp(appName)
+	if app == "unknown" || app == "system" || methodName == "" {
+		return app, methodName
+	}
+	if !reg.MethodExists(appName, methodName) {
+		return app, "unknown"
+	}
+	return app, methodName
+}
+
+// observeRequest records a finished request. appName and methodName must
+// already have been passed through metricsLabels.
+func (m *metrics) observeRequest(appName, methodName string, status int, latency time.Duration) {
+	if appName == "unknown" {
+		methodName = ""
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{appName, methodName, status}]++
+
+	key := latencyKey{appName, methodName}
+	h, ok := m.latencies[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latencies[key] = h
+	}
+	seconds := latency.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (m *metrics) recordAuthFailure(appName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.authFailures[appName]++
+}
+
+type protocolUsage struct {
+	app         string
+	entries     int
+	bytes       int64
+	subscribers map[string]int
+	queues      map[string]QueueStats
+}
+
+func (reg *Registry) collectProtocolUsage() []protocolUsage {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	usage := []protocolUsage{}
+	now := time.Now()
+	for appName, protocol := range reg.protocols {
+		u := protocolUsage{
+			app:         appName,
+			subscribers: make(map[string]int),
+			queues:      make(map[string]QueueStats),
+		}
+		for _, history := range protocol.History {
+			u.entries += len(history)
+			for _, entry := range history {
+				u.bytes += payloadSize(entry.Data)
+			}
+		}
+		for methodName, groups := range protocol.Groups {
+			u.subscribers[methodName] = len(groups)
+		}
+		for methodName, q := range protocol.Queues {
+			q.requeueExpired(now)
+			u.queues[methodName] = q.stats()
+		}
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].app < usage[j].app
+	})
+	return usage
+}
+
+func payloadSize(data interface{}) int64 {
+	switch v := data.(type) {
+	case json.RawMessage:
+		return int64(len(v))
+	case *Blob:
+		return v.Size
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return 0
+		}
+		return int64(len(encoded))
+	}
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func labels(pairs ...string) string {
+	parts := []string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], escapeLabel(pairs[i+1])))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeMetrics(w io.Writer, registry *Registry) {
+	m := registry.metrics
+	m.mu.Lock()
+
+	writeMetricHeader(w, "freeport_requests_total", "counter", "Requests handled by the API bus.")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].app != keys[j].app {
+			return keys[i].app < keys[j].app
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "freeport_requests_total%s %d\n",
+			labels("app", key.app, "method", key.method, "status", fmt.Sprint(key.status)), m.requests[key])
+	}
+
+	writeMetricHeader(w, "freeport_request_duration_seconds", "histogram", "Request latency in seconds.")
+	latencyKeys := make([]latencyKey, 0, len(m.latencies))
+	for key := range m.latencies {
+		latencyKeys = append(latencyKeys, key)
+	}
+	sort.Slice(latencyKeys, func(i, j int) bool {
+		if latencyKeys[i].app != latencyKeys[j].app {
+			return latencyKeys[i].app < latencyKeys[j].app
+		}
+		return latencyKeys[i].method < latencyKeys[j].method
+	})
+	for _, key := range latencyKeys {
+		h := m.latencies[key]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "freeport_request_duration_seconds_bucket%s %d\n",
+				labels("app", key.app, "method", key.method, "le", fmt.Sprint(bound)), h.counts[i])
+		}
+		fmt.Fprintf(w, "freeport_request_duration_seconds_bucket%s %d\n",
+			labels("app", key.app, "method", key.method, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "freeport_request_duration_seconds_sum%s %g\n", labels("app", key.app, "method", key.method), h.sum)
+		fmt.Fprintf(w, "freeport_request_duration_seconds_count%s %d\n", labels("app", key.app, "method", key.method), h.count)
+	}
+
+	writeMetricHeader(w, "freeport_auth_failures_total", "counter", "Requests rejected for a bad passkey.")
+	for _, app := range sortedKeys(m.authFailures) {
+		fmt.Fprintf(w, "freeport_auth_failures_total%s %d\n", labels("app", app), m.authFailures[app])
+	}
+
+	m.mu.Unlock()
+
+	usage := registry.collectProtocolUsage()
+
+	writeMetricHeader(w, "freeport_stored_entries", "gauge", "History entries held per protocol.")
+	for _, u := range usage {
+		fmt.Fprintf(w, "freeport_stored_entries%s %d\n", labels("app", u.app), u.entries)
+	}
+
+	writeMetricHeader(w, "freeport_stored_bytes", "gauge", "Approximate payload bytes held per protocol.")
+	for _, u := range usage {
+		fmt.Fprintf(w, "freeport_stored_bytes%s %d\n", labels("app", u.app), u.bytes)
+	}
+
+	writeMetricHeader(w, "freeport_subscribers", "gauge", "Consumer groups reading each method.")
+	for _, u := range usage {
+		for _, method := range sortedKeys(u.subscribers) {
+			fmt.Fprintf(w, "freeport_subscribers%s %d\n", labels("app", u.app, "method", method), u.subscribers[method])
+		}
+	}
+
+	writeMetricHeader(w, "freeport_queue_messages", "gauge", "Queued messages by state.")
+	for _, u := range usage {
+		for _, method := range sortedKeys(u.queues) {
+			stats := u.queues[method]
+			fmt.Fprintf(w, "freeport_queue_messages%s %d\n", labels("app", u.app, "method", method, "state", "ready"), stats.Depth)
+			fmt.Fprintf(w, "freeport_queue_messages%s %d\n", labels("app", u.app, "method", method, "state", "in_flight"), stats.InFlight)
+			fmt.Fprintf(w, "freeport_queue_messages%s %d\n", labels("app", u.app, "method", method, "state", "dead_letter"), stats.DeadLetters)
+		}
+	}
+
+	writeMetricHeader(w, "freeport_rejected_requests_total", "counter", "Requests rejected by payload or rate limits.")
+	for _, u := range usage {
+		stats := registry.GetRejections(u.app)
+		fmt.Fprintf(w, "freeport_rejected_requests_total%s %d\n", labels("app", u.app, "reason", "payload_too_large"), stats.PayloadTooLarge)
+		fmt.Fprintf(w, "freeport_rejected_requests_total%s %d\n", labels("app", u.app, "reason", "rate_limited"), stats.RateLimited)
+	}
+
+	writeMetricHeader(w, "freeport_battery_percent", "gauge", "Battery charge reported by the system provider.")
+	if battery, err := cachedBatteryPercentage(); err == nil {
+		fmt.Fprintf(w, "freeport_battery_percent %d\n", battery)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, s.registry)
+}
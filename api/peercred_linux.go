@@ -0,0 +1,25 @@
+//go:build linux
+
+package api
+
+import (
+	"net"
+	"syscall"
+)
+
+func connPeerUID(conn *net.UnixConn) (int, bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		return 0, false
+	}
+	return int(cred.Uid), true
+}
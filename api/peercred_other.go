@@ -0,0 +1,11 @@
+//go:build !linux
+
+package api
+
+import "net"
+
+// connPeerUID is only implemented on Linux; elsewhere socket peers must
+// authenticate with a passkey like TCP clients.
+func connPeerUID(conn *net.UnixConn) (int, bool) {
+	return 0, false
+}
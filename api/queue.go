@@ -0,0 +1,478 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultVisibilityTimeout = 30 * time.Second
+	DefaultMaxDeliveries     = 5
+	DefaultMaxDepth          = 10000
+)
+
+type QueueMessage struct {
+	ID         string      `json:"id"`
+	Receipt    string      `json:"receipt,omitempty"`
+	Data       interface{} `json:"data"`
+	Source     string      `json:"source"`
+	EnqueuedAt time.Time   `json:"enqueued_at"`
+	Deliveries int         `json:"deliveries"`
+	seq        int64
+	visibleAt  time.Time
+}
+
+type Queue struct {
+	VisibilityTimeout time.Duration
+	MaxDeliveries     int
+	MaxDepth          int
+	ready             []*QueueMessage
+	inFlight          map[string]*QueueMessage
+	deadLetters       []*QueueMessage
+	nextID            int64
+	dropped           int64
+}
+
+type QueueStats struct {
+	Depth       int   `json:"depth"`
+	InFlight    int   `json:"in_flight"`
+	DeadLetters int   `json:"dead_letters"`
+	Dropped     int64 `json:"dropped"`
+}
+
+type QueueMessagesResponse struct {
+	Response
+	AppName  string         `json:"app_name"`
+	Method   string         `json:"method"`
+	Count    int            `json:"count"`
+	Messages []QueueMessage `json:"messages"`
+}
+
+type ReceiptResponse struct {
+	Response
+	AppName string `json:"app_name"`
+	Method  string `json:"method"`
+	Receipt string `json:"receipt"`
+}
+
+type QueueStatusResponse struct {
+	Response
+	AppName string `json:"app_name"`
+	Method  string `json:"method"`
+	Enabled bool   `json:"enabled"`
+	*QueueStats
+}
+
+func newQueue(visibility time.Duration, maxDeliveries, maxDepth int) *Queue {
+	if visibility <= 0 {
+		visibility = DefaultVisibilityTimeout
+	}
+	if maxDeliveries <= 0 {
+		maxDeliveries = DefaultMaxDeliveries
+	}
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	return &Queue{
+		VisibilityTimeout: visibility,
+		MaxDeliveries:     maxDeliveries,
+		MaxDepth:          maxDepth,
+		inFlight:          make(map[string]*QueueMessage),
+	}
+}
+
+// enqueue adds a message at the tail of the queue. A queue holding MaxDepth
+// ready messages makes room by dropping the oldest, which is counted in
+// its stats.
+func (q *Queue) enqueue(data interface{}, source string) {
+	q.nextID++
+	if len(q.ready) >= q.MaxDepth {
+		drop := len(q.ready) - q.MaxDepth + 1
+		q.ready = q.ready[drop:]
+		q.dropped += int64(drop)
+	}
+	q.ready = append(q.ready, &QueueMessage{
+		ID:         strconv.FormatInt(q.nextID, 10),
+		Data:       data,
+		Source:     source,
+		EnqueuedAt: time.Now(),
+		seq:        q.nextID,
+	})
+}
+
+// release puts a message that failed delivery back at the head of the queue,
+// or into the dead-letter queue once it has used up its deliveries.
+func (q *Queue) release(msg *QueueMessage) {
+	delete(q.inFlight, msg.Receipt)
+	msg.Receipt = ""
+	if msg.Deliveries >= q.MaxDeliveries {
+		q.deadLetters = append(q.deadLetters, msg)
+		return
+	}
+	q.ready = append([]*QueueMessage{msg}, q.ready...)
+}
+
+// requeueExpired releases the in-flight messages whose visibility timeout
+// has passed. Each release goes to the head of the queue, so they are
+// released newest first to come back in the order they were enqueued.
+func (q *Queue) requeueExpired(now time.Time) {
+	expired := []*QueueMessage{}
+	for _, msg := range q.inFlight {
+		if now.After(msg.visibleAt) {
+			expired = append(expired, msg)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].seq > expired[j].seq
+	})
+	for _, msg := range expired {
+		q.release(msg)
+	}
+}
+
+func (q *Queue) stats() QueueStats {
+	return QueueStats{
+		Depth:       len(q.ready),
+		InFlight:    len(q.inFlight),
+		DeadLetters: len(q.deadLetters),
+		Dropped:     q.dropped,
+	}
+}
+
+func newReceipt() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (reg *Registry) getQueue(appName, methodName string) (*Queue, bool) {
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return nil, false
+	}
+	q, ok := protocol.Queues[methodName]
+	return q, ok
+}
+
+func (reg *Registry) EnableQueue(appName, methodName string, visibility time.Duration, maxDeliveries, maxDepth int) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return false
+	}
+	if _, ok := protocol.Methods[methodName]; !ok {
+		return false
+	}
+
+	if q, ok := protocol.Queues[methodName]; ok {
+		updated := newQueue(visibility, maxDeliveries, maxDepth)
+		q.VisibilityTimeout = updated.VisibilityTimeout
+		q.MaxDeliveries = updated.MaxDeliveries
+		q.MaxDepth = updated.MaxDepth
+		return true
+	}
+	protocol.Queues[methodName] = newQueue(visibility, maxDeliveries, maxDepth)
+	return true
+}
+
+func (reg *Registry) DisableQueue(appName, methodName string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if protocol, exists := reg.protocols[appName]; exists {
+		delete(protocol.Queues, methodName)
+		return true
+	}
+	return false
+}
+
+func (reg *Registry) QueueEnabled(appName, methodName string) bool {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	_, ok := reg.getQueue(appName, methodName)
+	return ok
+}
+
+func (reg *Registry) GetQueueStats(appName, methodName string) (QueueStats, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	q, ok := reg.getQueue(appName, methodName)
+	if !ok {
+		return QueueStats{}, false
+	}
+	q.requeueExpired(time.Now())
+	return q.stats(), true
+}
+
+func (reg *Registry) ClaimMessages(appName, methodName string, max int, visibility time.Duration) ([]QueueMessage, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	q, ok := reg.getQueue(appName, methodName)
+	if !ok {
+		return nil, false
+	}
+
+	now := time.Now()
+	q.requeueExpired(now)
+
+	if visibility <= 0 {
+		visibility = q.VisibilityTimeout
+	}
+	if max <= 0 {
+		max = 1
+	}
+
+	claimed := []QueueMessage{}
+	for len(q.ready) > 0 && len(claimed) < max {
+		msg := q.ready[0]
+		q.ready = q.ready[1:]
+
+		msg.Deliveries++
+		msg.Receipt = newReceipt()
+		msg.visibleAt = now.Add(visibility)
+		q.inFlight[msg.Receipt] = msg
+
+		claimed = append(claimed, *msg)
+	}
+	return claimed, true
+}
+
+func (reg *Registry) AckMessage(appName, methodName, receipt string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	q, ok := reg.getQueue(appName, methodName)
+	if !ok {
+		return false
+	}
+	q.requeueExpired(time.Now())
+
+	if _, ok := q.inFlight[receipt]; !ok {
+		return false
+	}
+	delete(q.inFlight, receipt)
+	return true
+}
+
+func (reg *Registry) NackMessage(appName, methodName, receipt string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	q, ok := reg.getQueue(appName, methodName)
+	if !ok {
+		return false
+	}
+	q.requeueExpired(time.Now())
+
+	msg, ok := q.inFlight[receipt]
+	if !ok {
+		return false
+	}
+	q.release(msg)
+	return true
+}
+
+func (reg *Registry) GetDeadLetters(appName, methodName string) ([]QueueMessage, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	q, ok := reg.getQueue(appName, methodName)
+	if !ok {
+		return nil, false
+	}
+	q.requeueExpired(time.Now())
+
+	messages := make([]QueueMessage, 0, len(q.deadLetters))
+	for _, msg := range q.deadLetters {
+		messages = append(messages, *msg)
+	}
+	return messages, true
+}
+
+func (reg *Registry) PurgeDeadLetters(appName, methodName string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	q, ok := reg.getQueue(appName, methodName)
+	if !ok {
+		return false
+	}
+	q.deadLetters = nil
+	return true
+}
+
+func (s *Server) queueRequest(w http.ResponseWriter, r *http.Request, appName, methodName string) bool {
+	if !s.authorize(w, r, appName) {
+		return false
+	}
+
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return false
+	}
+
+	if !s.registry.QueueEnabled(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeQueueDisabled, "Queue mode not enabled")
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) handleQueueClaim(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	if !s.queueRequest(w, r, appName, methodName) {
+		return
+	}
+
+	query := r.URL.Query()
+	var max int
+	if text := query.Get("max"); text != "" {
+		n, err := strconv.Atoi(text)
+		if err == nil && n < 0 {
+			err = fmt.Errorf("max %d is negative", n)
+		}
+		if err != nil {
+			writeErrorDetails(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid max parameter", map[string]interface{}{
+				"reason": err.Error(),
+			})
+			return
+		}
+		max = n
+	}
+	var visibility time.Duration
+	if text := query.Get("visibility"); text != "" {
+		d, err := time.ParseDuration(text)
+		if err == nil && d < 0 {
+			err = fmt.Errorf("visibility %s is negative", d)
+		}
+		if err != nil {
+			writeErrorDetails(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid visibility parameter", map[string]interface{}{
+				"reason": err.Error(),
+			})
+			return
+		}
+		visibility = d
+	}
+
+	messages, _ := s.registry.ClaimMessages(appName, methodName, max, visibility)
+	writeJSON(w, r, http.StatusOK, &QueueMessagesResponse{
+		AppName:  appName,
+		Method:   methodName,
+		Count:    len(messages),
+		Messages: messages,
+	})
+}
+
+func (s *Server) handleQueueSettle(w http.ResponseWriter, r *http.Request, appName, methodName, receipt string, ack bool) {
+	if !s.queueRequest(w, r, appName, methodName) {
+		return
+	}
+
+	var done bool
+	if ack {
+		done = s.registry.AckMessage(appName, methodName, receipt)
+	} else {
+		done = s.registry.NackMessage(appName, methodName, receipt)
+	}
+	if !done {
+		writeError(w, r, http.StatusNotFound, CodeReceiptNotFound, "Receipt not found or expired")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, &ReceiptResponse{
+		AppName: appName,
+		Method:  methodName,
+		Receipt: receipt,
+	})
+}
+
+func (s *Server) handleQueueDeadLetters(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	if !s.queueRequest(w, r, appName, methodName) {
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		s.registry.PurgeDeadLetters(appName, methodName)
+		writeJSON(w, r, http.StatusOK, &MessageResponse{
+			AppName: appName,
+			Method:  methodName,
+			Message: "Dead-letter queue purged",
+		})
+		return
+	}
+
+	messages, _ := s.registry.GetDeadLetters(appName, methodName)
+	writeJSON(w, r, http.StatusOK, &QueueMessagesResponse{
+		AppName:  appName,
+		Method:   methodName,
+		Count:    len(messages),
+		Messages: messages,
+	})
+}
+
+func (s *Server) handleQueueConfig(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	if !s.authorize(w, r, appName) {
+		return
+	}
+
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response := &QueueStatusResponse{
+			AppName: appName,
+			Method:  methodName,
+		}
+		if stats, enabled := s.registry.GetQueueStats(appName, methodName); enabled {
+			response.Enabled = true
+			response.QueueStats = &stats
+		}
+		writeJSON(w, r, http.StatusOK, response)
+
+	case http.MethodPut:
+		var settings struct {
+			VisibilityTimeout string `json:"visibility_timeout"`
+			MaxDeliveries     int    `json:"max_deliveries"`
+			MaxDepth          int    `json:"max_depth"`
+		}
+		if r.ContentLength != 0 {
+			s.limitBody(w, r, appName)
+			if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+				if !s.rejectedTooLarge(w, r, appName, err) {
+					writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+				}
+				return
+			}
+		}
+
+		var visibility time.Duration
+		if settings.VisibilityTimeout != "" {
+			d, err := time.ParseDuration(settings.VisibilityTimeout)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid visibility_timeout")
+				return
+			}
+			visibility = d
+		}
+
+		s.registry.EnableQueue(appName, methodName, visibility, settings.MaxDeliveries, settings.MaxDepth)
+		writeJSON(w, r, http.StatusOK, &MessageResponse{
+			AppName: appName,
+			Method:  methodName,
+			Message: "Queue mode enabled",
+		})
+
+	case http.MethodDelete:
+		s.registry.DisableQueue(appName, methodName)
+		writeJSON(w, r, http.StatusOK, &MessageResponse{
+			AppName: appName,
+			Method:  methodName,
+			Message: "Queue mode disabled",
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestQueueClaimRejectsBadQuery(t *testing.T) {
+	registry, ts := newRevisionServer(t)
+	registry.EnableQueue("app", "m", 0, 0, 0)
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"", http.StatusOK},
+		{"?max=2&visibility=1m", http.StatusOK},
+		{"?max=two", http.StatusBadRequest},
+		{"?max=-1", http.StatusBadRequest},
+		{"?visibility=30", http.StatusBadRequest},
+		{"?visibility=-1s", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, body := request(t, http.MethodPost, ts.URL+"/v1/app/m/queue/claim"+tt.query, "")
+		if resp.StatusCode != tt.status {
+			t.Errorf("%q: %s, want %d", tt.query, resp.Status, tt.status)
+			continue
+		}
+		if tt.status != http.StatusBadRequest {
+			continue
+		}
+		apiError, _ := body["error"].(map[string]interface{})
+		details, _ := apiError["details"].(map[string]interface{})
+		if apiError["code"] != CodeBadRequest || details["reason"] == "" || details["reason"] == nil {
+			t.Errorf("%q: error %v, want bad_request with the reason", tt.query, apiError)
+		}
+	}
+}
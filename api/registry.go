@@ -0,0 +1,190 @@
+package api
+
+import "time"
+
+// The functions below operate on the default registry shared by servers
+// created with NewServer.
+
+func RegisterProtocol(appName, passkey, description string) {
+	defaultRegistry.RegisterProtocol(appName, passkey, description)
+}
+
+func UnregisterProtocol(appName string) bool {
+	return defaultRegistry.UnregisterProtocol(appName)
+}
+
+func RegisterMethod(appName, methodName, description string) {
+	defaultRegistry.RegisterMethod(appName, methodName, description)
+}
+
+func StoreData(appName, methodName, source string, data interface{}) bool {
+	return defaultRegistry.StoreData(appName, methodName, source, data)
+}
+
+func GetData(appName, methodName string) (interface{}, bool) {
+	return defaultRegistry.GetData(appName, methodName)
+}
+
+func GetHistory(appName, methodName string, limit int) ([]DataEntry, bool) {
+	return defaultRegistry.GetHistory(appName, methodName, limit)
+}
+
+func ClearData(appName, methodName string) bool {
+	return defaultRegistry.ClearData(appName, methodName)
+}
+
+func ValidateProtocol(appName, passkey string) bool {
+	return defaultRegistry.ValidateProtocol(appName, passkey)
+}
+
+func ProtocolExists(appName string) bool {
+	return defaultRegistry.ProtocolExists(appName)
+}
+
+func MethodSchema(appName, methodName string) *Schema {
+	return defaultRegistry.MethodSchema(appName, methodName)
+}
+
+func MethodExists(appName, methodName string) bool {
+	return defaultRegistry.MethodExists(appName, methodName)
+}
+
+func CreateGroup(appName, methodName, group string, fromLatest bool) (GroupStatus, error) {
+	return defaultRegistry.CreateGroup(appName, methodName, group, fromLatest)
+}
+
+func ReadGroup(appName, methodName, group string, max int) ([]DataEntry, int64, GroupStatus, bool) {
+	return defaultRegistry.ReadGroup(appName, methodName, group, max)
+}
+
+func CommitOffset(appName, methodName, group string, offset int64) (GroupStatus, error) {
+	return defaultRegistry.CommitOffset(appName, methodName, group, offset)
+}
+
+func DeleteGroup(appName, methodName, group string) bool {
+	return defaultRegistry.DeleteGroup(appName, methodName, group)
+}
+
+func ListGroups(appName, methodName string) ([]GroupStatus, bool) {
+	return defaultRegistry.ListGroups(appName, methodName)
+}
+
+func ListProtocols() []ProtocolInfo {
+	return defaultRegistry.ListProtocols()
+}
+
+func GetProtocolInfo(appName string) (ProtocolInfo, bool) {
+	return defaultRegistry.GetProtocolInfo(appName)
+}
+
+func SetProtocolLimits(appName string, limits Limits) bool {
+	return defaultRegistry.SetProtocolLimits(appName, limits)
+}
+
+func GetLimits(appName string) Limits {
+	return defaultRegistry.GetLimits(appName)
+}
+
+func SetDefaultLimits(limits Limits) {
+	defaultRegistry.SetDefaultLimits(limits)
+}
+
+func ConfigureProtocolLimits(appName string, limits Limits) {
+	defaultRegistry.ConfigureProtocolLimits(appName, limits)
+}
+
+func GetRejections(appName string) RejectionStats {
+	return defaultRegistry.GetRejections(appName)
+}
+
+func EnableQueue(appName, methodName string, visibility time.Duration, maxDeliveries, maxDepth int) bool {
+	return defaultRegistry.EnableQueue(appName, methodName, visibility, maxDeliveries, maxDepth)
+}
+
+func DisableQueue(appName, methodName string) bool {
+	return defaultRegistry.DisableQueue(appName, methodName)
+}
+
+func QueueEnabled(appName, methodName string) bool {
+	return defaultRegistry.QueueEnabled(appName, methodName)
+}
+
+func GetQueueStats(appName, methodName string) (QueueStats, bool) {
+	return defaultRegistry.GetQueueStats(appName, methodName)
+}
+
+func ClaimMessages(appName, methodName string, max int, visibility time.Duration) ([]QueueMessage, bool) {
+	return defaultRegistry.ClaimMessages(appName, methodName, max, visibility)
+}
+
+func AckMessage(appName, methodName, receipt string) bool {
+	return defaultRegistry.AckMessage(appName, methodName, receipt)
+}
+
+func NackMessage(appName, methodName, receipt string) bool {
+	return defaultRegistry.NackMessage(appName, methodName, receipt)
+}
+
+func GetDeadLetters(appName, methodName string) ([]QueueMessage, bool) {
+	return defaultRegistry.GetDeadLetters(appName, methodName)
+}
+
+func PurgeDeadLetters(appName, methodName string) bool {
+	return defaultRegistry.PurgeDeadLetters(appName, methodName)
+}
+
+func ApplyManifest(m *Manifest, options ApplyOptions) ([]Change, error) {
+	return defaultRegistry.Apply(m, options)
+}
+
+func ExportManifest(includePasskeys bool) *Manifest {
+	return defaultRegistry.Export(includePasskeys)
+}
+
+func TakeSnapshot() *Snapshot {
+	return defaultRegistry.Snapshot()
+}
+
+func RestoreSnapshot(s *Snapshot, mode string) (RestoreStats, error) {
+	return defaultRegistry.Restore(s, mode)
+}
+
+func StartGenerator(appName, methodName string, config GeneratorConfig) (GeneratorStatus, error) {
+	return defaultRegistry.StartGenerator(appName, methodName, config)
+}
+
+func StopGenerator(appName, methodName string) bool {
+	return defaultRegistry.StopGenerator(appName, methodName)
+}
+
+func SetGeneratorInterval(appName, methodName string, interval time.Duration) (GeneratorStatus, error) {
+	return defaultRegistry.SetGeneratorInterval(appName, methodName, interval)
+}
+
+func GetGenerator(appName, methodName string) (GeneratorStatus, bool) {
+	return defaultRegistry.Generator(appName, methodName)
+}
+
+func GetDerivation(appName, methodName string) (DerivedStatus, bool) {
+	return defaultRegistry.Derivation(appName, methodName)
+}
+
+func ConfigureLogging(dir string, maxBytes int64, maxBackups int) {
+	defaultRegistry.ConfigureLogging(dir, maxBytes, maxBackups)
+}
+
+func RecordAudit(kind, appName, methodName, detail, source string) {
+	defaultRegistry.RecordAudit(kind, appName, methodName, detail, source)
+}
+
+func RecentAccessLog(limit int) []AccessEntry {
+	return defaultRegistry.RecentAccessLog(limit)
+}
+
+func RecentAuditLog(limit int) []AuditEvent {
+	return defaultRegistry.RecentAuditLog(limit)
+}
+
+func SubscribeTraffic(buffer int) (<-chan TrafficEvent, func()) {
+	return defaultRegistry.SubscribeTraffic(buffer)
+}
@@ -0,0 +1,373 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplaySourcePrefix marks the source of every replayed entry, so consumers
+// can tell a replay from the live producer it imitates.
+const ReplaySourcePrefix = "replay:"
+
+const (
+	ReplayRunning = "running"
+	ReplayDone    = "done"
+	ReplayStopped = "stopped"
+)
+
+const (
+	maxReplaySpeed = 1000
+	// replayLoopPause separates the last entry of one pass from the first
+	// of the next, before scaling by speed.
+	replayLoopPause = time.Second
+	// keepFinishedReplays bounds how many ended replays are still listed.
+	keepFinishedReplays = 20
+)
+
+var errNoEntries = errors.New("no recorded entries to replay")
+
+// ReplayOptions choose what a replay re-emits. From names the method whose
+// history is read and defaults to the target itself. Since and Until select
+// a range of entry timestamps, inclusive. Speed scales the original gaps
+// between entries: 2 plays twice as fast, 0 means 1.
+type ReplayOptions struct {
+	From  string     `json:"from,omitempty"`
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+	Speed float64    `json:"speed,omitempty"`
+	Loop  bool       `json:"loop,omitempty"`
+}
+
+type ReplayStatus struct {
+	ID      string     `json:"id"`
+	AppName string     `json:"app_name"`
+	Method  string     `json:"method"`
+	From    string     `json:"from"`
+	Since   *time.Time `json:"since,omitempty"`
+	Until   *time.Time `json:"until,omitempty"`
+	Speed   float64    `json:"speed"`
+	Loop    bool       `json:"loop"`
+	State   string     `json:"state"`
+	Entries int        `json:"entries"`
+	Sent    int64      `json:"sent"`
+	Loops   int        `json:"loops"`
+	Started time.Time  `json:"started"`
+	Error   string     `json:"error,omitempty"`
+}
+
+type replay struct {
+	entries []DataEntry
+	stop    chan struct{}
+
+	mu     sync.Mutex
+	status ReplayStatus
+}
+
+// ReplaySource is the source a replayed entry is stored with. Replaying a
+// replay keeps a single prefix.
+func ReplaySource(source string) string {
+	return ReplaySourcePrefix + strings.TrimPrefix(source, ReplaySourcePrefix)
+}
+
+// StartReplay re-emits recorded history into appName/methodName in the
+// background, keeping the original time between entries. The entries are
+// copied when it starts, so replaying a method into itself does not feed
+// back.
+func (reg *Registry) StartReplay(appName, methodName string, options ReplayOptions) (ReplayStatus, error) {
+	if options.From == "" {
+		options.From = methodName
+	}
+	if options.Speed == 0 {
+		options.Speed = 1
+	}
+	if options.Speed < 0 || options.Speed > maxReplaySpeed {
+		return ReplayStatus{}, fmt.Errorf("speed must be above 0 and at most %d", maxReplaySpeed)
+	}
+	if options.Since != nil && options.Until != nil && options.Until.Before(*options.Since) {
+		return ReplayStatus{}, fmt.Errorf("until is before since")
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	protocol, exists := reg.protocols[appName]
+	if !exists {
+		return ReplayStatus{}, fmt.Errorf("protocol %s not found", appName)
+	}
+	for _, name := range []string{methodName, options.From} {
+		if _, exists := protocol.Methods[name]; !exists {
+			return ReplayStatus{}, fmt.Errorf("method %s not found", name)
+		}
+	}
+	if protocol.Derived[methodName] != nil {
+		return ReplayStatus{}, errDerivedMethod
+	}
+
+	var entries []DataEntry
+	for _, entry := range protocol.History[options.From] {
+		if options.Since != nil && entry.Timestamp.Before(*options.Since) {
+			continue
+		}
+		if options.Until != nil && entry.Timestamp.After(*options.Until) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return ReplayStatus{}, errNoEntries
+	}
+
+	reg.replaySeq++
+	r := &replay{
+		entries: entries,
+		stop:    make(chan struct{}),
+		status: ReplayStatus{
+			ID:      fmt.Sprintf("r%d", reg.replaySeq),
+			AppName: appName,
+			Method:  methodName,
+			From:    options.From,
+			Since:   options.Since,
+			Until:   options.Until,
+			Speed:   options.Speed,
+			Loop:    options.Loop,
+			State:   ReplayRunning,
+			Entries: len(entries),
+			Started: time.Now(),
+		},
+	}
+	reg.pruneReplays()
+	reg.replays = append(reg.replays, r)
+
+	go reg.runReplay(r)
+	return r.status, nil
+}
+
+// pruneReplays forgets the oldest ended replays beyond keepFinishedReplays.
+func (reg *Registry) pruneReplays() {
+	finished := 0
+	for _, r := range reg.replays {
+		if r.snapshot().State != ReplayRunning {
+			finished++
+		}
+	}
+
+	kept := reg.replays[:0]
+	for _, r := range reg.replays {
+		if finished >= keepFinishedReplays && r.snapshot().State != ReplayRunning {
+			finished--
+			continue
+		}
+		kept = append(kept, r)
+	}
+	reg.replays = kept
+}
+
+// Replays lists the replays into appName/methodName, oldest first.
+func (reg *Registry) Replays(appName, methodName string) []ReplayStatus {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	statuses := []ReplayStatus{}
+	for _, r := range reg.replays {
+		status := r.snapshot()
+		if status.AppName == appName && status.Method == methodName {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// StopReplay ends a running replay. It reports false if there is no such
+// replay into appName/methodName.
+func (reg *Registry) StopReplay(appName, methodName, id string) bool {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	for _, r := range reg.replays {
+		if r.status.ID != id || r.status.AppName != appName || r.status.Method != methodName {
+			continue
+		}
+		r.finish(ReplayStopped, "")
+		return true
+	}
+	return false
+}
+
+// stopReplays stops every running replay into appName. The caller holds
+// reg.mu.
+func (reg *Registry) stopReplays(appName string) {
+	for _, r := range reg.replays {
+		if r.status.AppName == appName {
+			r.finish(ReplayStopped, "protocol was removed")
+		}
+	}
+}
+
+func (r *replay) snapshot() ReplayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// finish moves a running replay to state; a replay that has already ended
+// keeps its state.
+func (r *replay) finish(state, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status.State != ReplayRunning {
+		return
+	}
+	r.status.State = state
+	r.status.Error = message
+	close(r.stop)
+}
+
+// wait sleeps for d scaled by the replay's speed and reports false if the
+// replay was stopped meanwhile.
+func (r *replay) wait(d time.Duration) bool {
+	if d <= 0 {
+		select {
+		case <-r.stop:
+			return false
+		default:
+			return true
+		}
+	}
+
+	timer := time.NewTimer(time.Duration(float64(d) / r.status.Speed))
+	defer timer.Stop()
+	select {
+	case <-r.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (reg *Registry) runReplay(r *replay) {
+	for {
+		for i, entry := range r.entries {
+			if i > 0 && !r.wait(entry.Timestamp.Sub(r.entries[i-1].Timestamp)) {
+				return
+			}
+			if !reg.emitReplay(r, entry) {
+				r.finish(ReplayDone, "method was removed")
+				return
+			}
+		}
+
+		if !r.status.Loop {
+			r.finish(ReplayDone, "")
+			return
+		}
+		r.mu.Lock()
+		r.status.Loops++
+		r.mu.Unlock()
+		if !r.wait(replayLoopPause) {
+			return
+		}
+	}
+}
+
+// emitReplay stores entry as a fresh write and shows it in the traffic feed
+// with the verb REPLAY.
+func (reg *Registry) emitReplay(r *replay, entry DataEntry) bool {
+	app, method := r.status.AppName, r.status.Method
+	if !reg.MethodExists(app, method) {
+		return false
+	}
+
+	source := ReplaySource(entry.Source)
+	now := time.Now()
+	if stored, _ := reg.store(app, method, source, entry.Data, Stamp{}, nil); !stored {
+		return false
+	}
+
+	r.mu.Lock()
+	r.status.Sent++
+	r.mu.Unlock()
+
+	reg.publishWrite("REPLAY", app, method, source, entry.Data, now)
+	return true
+}
+
+type ReplayResponse struct {
+	Response
+	Replay ReplayStatus `json:"replay"`
+}
+
+type ReplayListResponse struct {
+	Response
+	AppName string         `json:"app_name"`
+	Method  string         `json:"method"`
+	Count   int            `json:"count"`
+	Replays []ReplayStatus `json:"replays"`
+}
+
+func (s *Server) handleReplays(w http.ResponseWriter, r *http.Request, appName, methodName string) {
+	if !s.authorize(w, r, appName) {
+		return
+	}
+
+	if !s.registry.MethodExists(appName, methodName) {
+		writeError(w, r, http.StatusNotFound, CodeMethodNotFound, "Method not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var options ReplayOptions
+		if r.ContentLength != 0 {
+			s.limitBody(w, r, appName)
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&options); err != nil {
+				if s.rejectedTooLarge(w, r, appName, err) {
+					return
+				}
+				writeErrorDetails(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid replay options", map[string]interface{}{
+					"reason": err.Error(),
+				})
+				return
+			}
+		}
+
+		status, err := s.registry.StartReplay(appName, methodName, options)
+		if errors.Is(err, errNoEntries) {
+			writeError(w, r, http.StatusNotFound, CodeNoData, "No recorded entries to replay")
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, err.Error())
+			return
+		}
+		s.registry.RecordAudit(AuditReplayStarted, appName, methodName, fmt.Sprintf("%s from %s: %d entries at %gx", status.ID, status.From, status.Entries, status.Speed), remoteAddr(r))
+		writeJSON(w, r, http.StatusAccepted, &ReplayResponse{Replay: status})
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if !s.registry.StopReplay(appName, methodName, id) {
+			writeError(w, r, http.StatusNotFound, CodeReplayNotFound, "Replay not found")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, &MessageResponse{
+			AppName: appName,
+			Method:  methodName,
+			Message: "Replay " + id + " stopped",
+		})
+
+	default:
+		replays := s.registry.Replays(appName, methodName)
+		writeJSON(w, r, http.StatusOK, &ReplayListResponse{
+			AppName: appName,
+			Method:  methodName,
+			Count:   len(replays),
+			Replays: replays,
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	CodeBadRequest         = "bad_request"
+	CodeInvalidJSON        = "invalid_json"
+	CodeAppMismatch        = "app_mismatch"
+	CodeUnauthorized       = "unauthorized"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeMethodNotFound     = "method_not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeNoData             = "no_data"
+	CodePayloadTooLarge    = "payload_too_large"
+	CodeSchemaViolation    = "schema_violation"
+	CodeRateLimited        = "rate_limited"
+	CodeQueueDisabled      = "queue_disabled"
+	CodeReceiptNotFound    = "receipt_not_found"
+	CodeGroupNotFound      = "group_not_found"
+	CodeReplayNotFound     = "replay_not_found"
+	CodeGeneratorNotFound  = "generator_not_found"
+	CodeOffsetOutOfRange   = "offset_out_of_range"
+	CodeNotReady           = "not_ready"
+	CodePreconditionFailed = "precondition_failed"
+	CodeTooManyKeys        = "too_many_keys"
+	CodeInternal           = "internal_error"
+)
+
+// Response is the envelope shared by every JSON reply. Endpoint responses
+// embed it so their own fields sit alongside status and request_id.
+type Response struct {
+	Status    string    `json:"status"`
+	RequestID string    `json:"request_id,omitempty"`
+	Error     *APIError `json:"error,omitempty"`
+}
+
+type APIError struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+type envelope interface {
+	envelope() *Response
+}
+
+func (r *Response) envelope() *Response {
+	return r
+}
+
+type MessageResponse struct {
+	Response
+	AppName string `json:"app_name,omitempty"`
+	Method  string `json:"method,omitempty"`
+	Message string `json:"message"`
+}
+
+type requestIDKey struct{}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func withRequestID(r *http.Request, id string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, body envelope) {
+	meta := body.envelope()
+	if meta.Status == "" {
+		meta.Status = "success"
+	}
+	meta.RequestID = requestID(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeErrorDetails(w, r, status, code, message, nil)
+}
+
+func writeErrorDetails(w http.ResponseWriter, r *http.Request, status int, code, message string, details map[string]interface{}) {
+	writeJSON(w, r, status, &Response{
+		Status: "error",
+		Error: &APIError{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	})
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrPreconditionFailed is returned by a conditional write whose condition
+// does not hold for the current value.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// Revision names one write of a method's value. It is derived from the
+// write's stamp, so a value mirrored to other instances keeps its revision
+// there, and it is sent as the ETag of the value.
+func (a Stamp) Revision() string {
+	revision := strconv.FormatInt(a.Time.UnixNano(), 36)
+	if a.Node != "" {
+		revision += "-" + a.Node
+	}
+	return revision
+}
+
+func etag(revision string) string {
+	return `"` + revision + `"`
+}
+
+// Precondition makes a write depend on the method's current value, in the
+// manner of the If-Match and If-None-Match headers. Each holds "*" or a list
+// of revisions. A value past its TTL counts as no value, so a lock taken with
+// IfNoneMatch "*" and a TTL is released by expiring.
+type Precondition struct {
+	IfMatch     []string
+	IfNoneMatch []string
+}
+
+// holds reports whether the condition is met by a current value at
+// revision, where "" means there is none.
+func (p *Precondition) holds(revision string) bool {
+	if p.IfMatch != nil && (revision == "" || !matchRevision(p.IfMatch, revision)) {
+		return false
+	}
+	if p.IfNoneMatch != nil && revision != "" && matchRevision(p.IfNoneMatch, revision) {
+		return false
+	}
+	return true
+}
+
+func matchRevision(list []string, revision string) bool {
+	for _, candidate := range list {
+		if candidate == "*" || candidate == revision {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETags reads an If-Match or If-None-Match header into revisions. It
+// returns nil for an absent header. Weak tags are compared as strong ones,
+// since every revision here is exact.
+func parseETags(header string) []string {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil
+	}
+	tags := []string{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		tag = strings.TrimPrefix(tag, "W/")
+		tag = strings.Trim(tag, `"`)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// revision is the revision of the current value on methodName at now, or
+// "" if there is none. The caller holds reg.mu.
+func (protocol *CustomProtocol) revision(methodName string, now time.Time) string {
+	if _, ok := protocol.current(methodName, now); ok {
+		return protocol.Stamps[methodName].Revision()
+	}
+	return ""
+}
+
+// requestPrecondition reads the conditional headers of a request, or
+// returns nil if there are none.
+func requestPrecondition(r *http.Request) *Precondition {
+	p := &Precondition{
+		IfMatch:     parseETags(r.Header.Get("If-Match")),
+		IfNoneMatch: parseETags(r.Header.Get("If-None-Match")),
+	}
+	if p.IfMatch == nil && p.IfNoneMatch == nil {
+		return nil
+	}
+	return p
+}
+
+// writePreconditionFailed answers a conditional request that found
+// revision, or no value if it is "".
+func writePreconditionFailed(w http.ResponseWriter, r *http.Request, revision string) {
+	details := map[string]interface{}{}
+	if revision != "" {
+		details["revision"] = revision
+	}
+	writeErrorDetails(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Current value does not match the precondition", details)
+}
+
+// StoreDataIf stores data only if cond holds for the current value, and
+// returns the revision of the value it stored. It fails with
+// ErrPreconditionFailed if cond does not hold, or if the write did not
+// become the current value. A nil cond and a ttl of 0 make it StoreData.
+func (reg *Registry) StoreDataIf(appName, methodName, source string, data interface{}, ttl time.Duration, cond *Precondition) (string, error) {
+	stamp, stored, latest, err := reg.storeIf(appName, methodName, source, data, Stamp{}, nil, ttl, cond)
+	if err != nil {
+		return "", err
+	}
+	if !stored {
+		return "", fmt.Errorf("protocol %s not found", appName)
+	}
+	if !latest {
+		return "", ErrPreconditionFailed
+	}
+	return stamp.Revision(), nil
+}
+
+// Revision returns the revision of the current value on appName/methodName.
+func (reg *Registry) Revision(appName, methodName string) (string, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if protocol, exists := reg.protocols[appName]; exists {
+		revision := protocol.revision(methodName, time.Now())
+		return revision, revision != ""
+	}
+	return "", false
+}
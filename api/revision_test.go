@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRevisionServer(t *testing.T) (*Registry, *httptest.Server) {
+	t.Helper()
+	registry := NewRegistry()
+	registry.RegisterProtocol("app", "key", "")
+	registry.RegisterMethod("app", "m", "")
+	registry.RegisterMethod("app", "k", "")
+
+	server := NewServer("0")
+	server.SetRegistry(registry)
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return registry, ts
+}
+
+func request(t *testing.T, method, url, body string, headers ...string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-App-Name", "app")
+	req.Header.Set("X-Passkey", "key")
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var decoded map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp, decoded
+}
+
+func TestLocalStampsAreDistinct(t *testing.T) {
+	registry, _ := newRevisionServer(t)
+	seen := map[string]bool{}
+	for i := 0; i < defaultHistory; i++ {
+		revision, err := registry.StoreDataIf("app", "m", "test", json.RawMessage(`1`), 0, nil)
+		if err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+		if seen[revision] {
+			t.Fatalf("write %d reused revision %s", i, revision)
+		}
+		seen[revision] = true
+	}
+	if history, _ := registry.GetHistory("app", "m", defaultHistory); len(history) != defaultHistory {
+		t.Errorf("history has %d entries, want %d", len(history), defaultHistory)
+	}
+
+	for i := 0; i < 100; i++ {
+		revision, err := registry.StoreKey("app", "k", "a", "test", json.RawMessage(`1`), 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[revision] {
+			t.Fatalf("key write %d reused revision %s", i, revision)
+		}
+		seen[revision] = true
+	}
+}
+
+func TestLocalWriteFollowsFutureReplica(t *testing.T) {
+	registry, _ := newRevisionServer(t)
+	ahead := Stamp{Time: time.Now().Add(time.Hour), Node: "peer"}
+	registry.StoreReplica("app", "m", "peer", json.RawMessage(`1`), ahead, []string{"peer"}, 0)
+
+	revision, err := registry.StoreDataIf("app", "m", "test", json.RawMessage(`2`), 0, nil)
+	if err != nil {
+		t.Fatalf("StoreDataIf: %v", err)
+	}
+	if current, _ := registry.Revision("app", "m"); current != revision {
+		t.Errorf("current revision %s, want the returned %s", current, revision)
+	}
+}
+
+func TestConditionalWrite(t *testing.T) {
+	_, ts := newRevisionServer(t)
+	url := ts.URL + "/v1/app/m"
+
+	resp, body := request(t, http.MethodPost, url, `1`, "If-None-Match", "*")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create: %s %v", resp.Status, body)
+	}
+	first, _ := body["revision"].(string)
+	if first == "" {
+		t.Fatalf("create returned no revision: %v", body)
+	}
+
+	resp, body = request(t, http.MethodPost, url, `2`, "If-None-Match", "*")
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("second create: %s, want 412", resp.Status)
+	}
+	apiError, _ := body["error"].(map[string]interface{})
+	if details, _ := apiError["details"].(map[string]interface{}); details["revision"] != first {
+		t.Errorf("412 details = %v, want revision %s", details, first)
+	}
+
+	resp, body = request(t, http.MethodPost, url, `3`, "If-Match", etag(first))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("update: %s %v", resp.Status, body)
+	}
+	second, _ := body["revision"].(string)
+	if second == first {
+		t.Fatal("update kept the old revision")
+	}
+
+	resp, _ = request(t, http.MethodPost, url, `4`, "If-Match", etag(first))
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("stale update: %s, want 412", resp.Status)
+	}
+
+	resp, _ = request(t, http.MethodPut, ts.URL+"/v1/app/k/keys/x", `1`, "If-Match", `"nope"`)
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("key update without a value: %s, want 412", resp.Status)
+	}
+}
+
+func TestConditionalRead(t *testing.T) {
+	registry, ts := newRevisionServer(t)
+	url := ts.URL + "/v1/app/m"
+	revision, err := registry.StoreDataIf("app", "m", "test", json.RawMessage(`1`), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := request(t, http.MethodGet, url, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != etag(revision) {
+		t.Fatalf("GET: %s, ETag %q, want 200 and %q", resp.Status, resp.Header.Get("ETag"), etag(revision))
+	}
+
+	resp, _ = request(t, http.MethodGet, url, "", "If-None-Match", etag(revision))
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET with current ETag: %s, want 304", resp.Status)
+	}
+
+	resp, _ = request(t, http.MethodGet, url, "", "If-None-Match", `W/"other", `+etag(revision))
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET with a list of ETags: %s, want 304", resp.Status)
+	}
+
+	registry.StoreData("app", "m", "test", json.RawMessage(`2`))
+	resp, _ = request(t, http.MethodGet, url, "", "If-None-Match", etag(revision))
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET after a write: %s, want 200", resp.Status)
+	}
+}
+
+func TestStoreDataIfPrecondition(t *testing.T) {
+	registry, _ := newRevisionServer(t)
+	if _, err := registry.StoreDataIf("app", "m", "test", json.RawMessage(`1`), 0, &Precondition{IfMatch: []string{"*"}}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("If-Match * on no value = %v, want ErrPreconditionFailed", err)
+	}
+	if _, err := registry.StoreDataIf("missing", "m", "test", json.RawMessage(`1`), 0, nil); err == nil || errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("write to a missing protocol = %v", err)
+	}
+}
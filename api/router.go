@@ -0,0 +1,167 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const APIVersion = "v1"
+
+type params map[string]string
+
+type routeHandler func(w http.ResponseWriter, r *http.Request, p params)
+
+type route struct {
+	segments []string
+	handlers map[string]routeHandler
+}
+
+// router matches slash-separated patterns such as "/{app}/{method}/history".
+// Literal segments win over parameters, so "/system/battery" is never routed
+// to a protocol named "system".
+type router struct {
+	routes []*route
+}
+
+func newRouter() *router {
+	return &router{}
+}
+
+// handle registers a pattern under the versioned prefix and keeps the
+// unversioned path as a compatibility alias.
+func (rt *router) handle(method, pattern string, handler routeHandler) {
+	rt.add(method, "/"+APIVersion+pattern, handler)
+	rt.add(method, pattern, handler)
+}
+
+func (rt *router) add(method, pattern string, handler routeHandler) {
+	segments := splitPath(pattern)
+	for _, existing := range rt.routes {
+		if strings.Join(existing.segments, "/") == strings.Join(segments, "/") {
+			existing.handlers[method] = handler
+			return
+		}
+	}
+	rt.routes = append(rt.routes, &route{
+		segments: segments,
+		handlers: map[string]routeHandler{method: handler},
+	})
+}
+
+// systemEndpoint reports whether name is the segment after /system in one
+// of the routes.
+func (rt *router) systemEndpoint(name string) bool {
+	for _, route := range rt.routes {
+		if len(route.segments) > 1 && route.segments[0] == "system" && route.segments[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
+
+// requestSegments splits the escaped request path so that an encoded slash
+// stays inside its segment, then decodes each segment.
+func requestSegments(r *http.Request) ([]string, bool) {
+	raw := splitPath(r.URL.EscapedPath())
+	segments := make([]string, len(raw))
+	for i, segment := range raw {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, false
+		}
+		segments[i] = decoded
+	}
+	return segments, true
+}
+
+// apiSegments is requestSegments without the version prefix.
+func apiSegments(r *http.Request) []string {
+	segments, _ := requestSegments(r)
+	if len(segments) > 0 && segments[0] == APIVersion {
+		return segments[1:]
+	}
+	return segments
+}
+
+// unversioned reports whether r came in on a compatibility alias rather
+// than under the version prefix. Those paths keep the response shapes they
+// had before /v1.
+func unversioned(r *http.Request) bool {
+	segments, _ := requestSegments(r)
+	return len(segments) == 0 || segments[0] != APIVersion
+}
+
+func (rt *route) match(segments []string) (params, int, bool) {
+	if len(rt.segments) != len(segments) {
+		return nil, 0, false
+	}
+	p := params{}
+	literals := 0
+	for i, segment := range rt.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+			p[segment[1:len(segment)-1]] = segments[i]
+			continue
+		}
+		if segment != segments[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return p, literals, true
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments, ok := requestSegments(r)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid path encoding")
+		return
+	}
+
+	var best *route
+	var bestParams params
+	bestLiterals := -1
+	for _, candidate := range rt.routes {
+		p, literals, ok := candidate.match(segments)
+		if !ok || literals <= bestLiterals {
+			continue
+		}
+		if p["app"] == "system" || p["app"] == APIVersion {
+			continue
+		}
+		best, bestParams, bestLiterals = candidate, p, literals
+	}
+
+	if best == nil {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
+		return
+	}
+
+	handler, ok := best.handlers[r.Method]
+	if !ok {
+		allowed := make([]string, 0, len(best.handlers))
+		for method := range best.handlers {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeErrorDetails(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed", map[string]interface{}{
+			"allow": allowed,
+		})
+		return
+	}
+
+	handler(w, r, bestParams)
+}
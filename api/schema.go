@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Schema is the subset of JSON Schema a method can check its payloads
+// against. Anything outside the subset is rejected when the schema is
+// decoded rather than silently ignored.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+}
+
+var schemaTypes = map[string]bool{
+	"": true, "object": true, "array": true, "string": true,
+	"number": true, "integer": true, "boolean": true, "null": true,
+}
+
+// Check reports a schema that could never be satisfied as written.
+func (s *Schema) Check() error {
+	if s == nil {
+		return nil
+	}
+	if !schemaTypes[s.Type] {
+		return fmt.Errorf("unknown type %q", s.Type)
+	}
+	for name, property := range s.Properties {
+		if err := property.Check(); err != nil {
+			return fmt.Errorf("properties.%s: %w", name, err)
+		}
+	}
+	if err := s.Items.Check(); err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+	return nil
+}
+
+// Validate returns one message per way value breaks the schema. value is a
+// decoded JSON document; numbers may be float64 or json.Number.
+func (s *Schema) Validate(value interface{}) []string {
+	var problems []string
+	s.validate("$", value, &problems)
+	return problems
+}
+
+func (s *Schema) validate(path string, value interface{}, problems *[]string) {
+	if s == nil {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.Type != "" && !hasType(value, s.Type) {
+		fail("expected %s, got %s", s.Type, typeName(value))
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if sameValue(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value is not one of the allowed values")
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, known := s.Properties[name]
+			if !known {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					fail("unexpected property %q", name)
+				}
+				continue
+			}
+			property.validate(path+"."+name, v[name], problems)
+		}
+	case []interface{}:
+		for i, item := range v {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("shorter than %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("longer than %d characters", *s.MaxLength)
+		}
+	}
+
+	if n, ok := number(value); ok {
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("less than minimum %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("greater than maximum %v", *s.Maximum)
+		}
+	}
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func hasType(value interface{}, want string) bool {
+	switch want {
+	case "integer":
+		n, ok := number(value)
+		return ok && n == float64(int64(n))
+	case "number":
+		_, ok := number(value)
+		return ok
+	}
+	return typeName(value) == want
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if _, ok := number(value); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func sameValue(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
+
+// checkSchema validates a payload against the method's schema, if it has
+// one, and writes a 422 listing the problems when it does not match.
+func (s *Server) checkSchema(w http.ResponseWriter, r *http.Request, appName, methodName string, payload interface{}) bool {
+	schema := s.registry.MethodSchema(appName, methodName)
+	if schema == nil {
+		return true
+	}
+
+	raw, ok := payload.(json.RawMessage)
+	if !ok {
+		writeError(w, r, http.StatusUnprocessableEntity, CodeSchemaViolation, "Method only accepts JSON payloads")
+		return false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	decoder.Decode(&value)
+
+	if problems := schema.Validate(value); len(problems) > 0 {
+		writeErrorDetails(w, r, http.StatusUnprocessableEntity, CodeSchemaViolation, "Payload does not match the method schema", map[string]interface{}{
+			"problems": problems,
+		})
+		return false
+	}
+	return true
+}
@@ -1,104 +1,269 @@
 package api
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"net"
 	"net/http"
-	"strings"
+	"os"
+	"sync/atomic"
 	"time"
 )
 
 type Server struct {
-	port string
+	port         string
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+	adminToken   string
+	socketPath   string
+	socketMode   os.FileMode
+	tcpDisabled  bool
+	trustedUIDs  map[int]bool
+	registry     *Registry
+	federation   *Federation
+	alerts       *Alerts
+	ready        atomic.Bool
 }
 
 func NewServer(port string) *Server {
-	return &Server{port: port}
+	return &Server{
+		port:         port,
+		readTimeout:  30 * time.Second,
+		writeTimeout: 30 * time.Second,
+		idleTimeout:  120 * time.Second,
+		registry:     defaultRegistry,
+	}
 }
 
-func (s *Server) Start() error {
-	mux := http.NewServeMux()
+// SetRegistry gives the server its own set of protocols instead of the
+// package-wide default, so that several buses can run in one process.
+func (s *Server) SetRegistry(registry *Registry) {
+	s.registry = registry
+}
 
-	mux.HandleFunc("/system/battery", s.handleBattery)
+func (s *Server) Registry() *Registry {
+	return s.registry
+}
 
-	mux.HandleFunc("/", s.handleCustomOrNotFound)
+func (s *Server) SetTimeouts(read, write, idle time.Duration) {
+	if read > 0 {
+		s.readTimeout = read
+	}
+	if write > 0 {
+		s.writeTimeout = write
+	}
+	if idle > 0 {
+		s.idleTimeout = idle
+	}
+}
 
-	log.Printf("API Server starting on port %s", s.port)
-	return http.ListenAndServe(":"+s.port, mux)
+func (s *Server) Handler() http.Handler {
+	return s.logRequests(s.routes())
 }
 
-func (s *Server) handleBattery(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// InProcessHandler serves the same routes as Handler to callers in this
+// process, such as the TUI. Its requests are trusted like those of a
+// trusted socket peer, are not rate limited, and stay out of the access
+// log, the metrics and the Monitor.
+func (s *Server) InProcessHandler() http.Handler {
+	next := s.routes()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := newRequestID()
+		w.Header().Set("X-Request-ID", id)
+		r = r.WithContext(context.WithValue(r.Context(), inProcessKey{}, true))
+		next.ServeHTTP(w, withRequestID(r, id))
+	})
+}
 
-	battery, err := GetBatteryPercentage()
-	if err != nil {
-		http.Error(w, "Failed to get battery info", http.StatusInternalServerError)
-		return
+func (s *Server) routes() *router {
+	rt := newRouter()
+
+	rt.handle(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleRoot(w, r)
+	})
+	rt.handle(http.MethodGet, "/healthz", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleHealthz(w, r)
+	})
+	rt.handle(http.MethodGet, "/readyz", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleReadyz(w, r)
+	})
+	rt.handle(http.MethodGet, "/version", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleVersion(w, r)
+	})
+	rt.handle(http.MethodGet, "/metrics", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleMetrics(w, r)
+	})
+	rt.handle(http.MethodGet, "/system/battery", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleBattery(w, r)
+	})
+	rt.handle(http.MethodGet, "/system/protocols", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleSystemProtocols(w, r)
+	})
+	rt.handle(http.MethodPost, "/system/protocols", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleCreateProtocol(w, r)
+	})
+	rt.handle(http.MethodDelete, "/system/protocols/{name}", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleDeleteProtocol(w, r, p["name"])
+	})
+	manifest := func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleManifest(w, r)
 	}
+	rt.handle(http.MethodGet, "/system/manifest", manifest)
+	rt.handle(http.MethodPut, "/system/manifest", manifest)
+	snapshot := func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleSnapshot(w, r)
+	}
+	rt.handle(http.MethodGet, "/system/snapshot", snapshot)
+	rt.handle(http.MethodPost, "/system/snapshot", snapshot)
+	rt.handle(http.MethodGet, "/system/generators", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleGenerators(w, r)
+	})
+	generator := func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleGenerator(w, r, p["app"], p["method"])
+	}
+	rt.handle(http.MethodGet, "/system/generators/{app}/{method}", generator)
+	rt.handle(http.MethodPut, "/system/generators/{app}/{method}", generator)
+	rt.handle(http.MethodPatch, "/system/generators/{app}/{method}", generator)
+	rt.handle(http.MethodDelete, "/system/generators/{app}/{method}", generator)
+	rt.handle(http.MethodGet, "/alerts", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleAlerts(w, r)
+	})
+	rt.handle(http.MethodGet, "/system/derived", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleDerived(w, r)
+	})
+	rt.handle(http.MethodGet, "/system/federation", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleFederation(w, r)
+	})
+	rt.handle(http.MethodPost, "/system/federation/{app}/{method}", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleReplica(w, r, p["app"], p["method"])
+	})
+
+	rt.handle(http.MethodGet, "/{app}/init", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleCustomInit(w, r, p["app"])
+	})
 
-	response := map[string]interface{}{
-		"time":     time.Now().Format(time.RFC3339),
-		"battery":  battery,
-		"app_name": "freeport",
+	method := func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleCustomMethod(w, r, p["app"], p["method"])
 	}
+	rt.handle(http.MethodGet, "/{app}/{method}", method)
+	rt.handle(http.MethodPost, "/{app}/{method}", method)
+	rt.handle(http.MethodDelete, "/{app}/{method}", method)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
+	rt.handle(http.MethodGet, "/{app}/{method}/history", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleCustomHistory(w, r, p["app"], p["method"])
+	})
 
-func (s *Server) handleCustomOrNotFound(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(r.URL.Path, "/")
-	parts := strings.Split(path, "/")
+	rt.handle(http.MethodGet, "/{app}/{method}/keys", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleKeys(w, r, p["app"], p["method"])
+	})
+	key := func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleKey(w, r, p["app"], p["method"], p["key"])
+	}
+	rt.handle(http.MethodGet, "/{app}/{method}/keys/{key}", key)
+	rt.handle(http.MethodPut, "/{app}/{method}/keys/{key}", key)
+	rt.handle(http.MethodDelete, "/{app}/{method}/keys/{key}", key)
+	rt.handle(http.MethodGet, "/{app}/{method}/keys/{key}/history", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleKeyHistory(w, r, p["app"], p["method"], p["key"])
+	})
 
-	if path == "" {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
+	rt.handle(http.MethodGet, "/{app}/{method}/next", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleGroupNext(w, r, p["app"], p["method"])
+	})
+	rt.handle(http.MethodPost, "/{app}/{method}/commit", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleGroupCommit(w, r, p["app"], p["method"])
+	})
+	groups := func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleGroups(w, r, p["app"], p["method"])
 	}
+	rt.handle(http.MethodGet, "/{app}/{method}/groups", groups)
+	rt.handle(http.MethodPost, "/{app}/{method}/groups", groups)
+	rt.handle(http.MethodDelete, "/{app}/{method}/groups", groups)
 
-	if len(parts) < 2 {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
+	queue := func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleQueueConfig(w, r, p["app"], p["method"])
+	}
+	rt.handle(http.MethodGet, "/{app}/{method}/queue", queue)
+	rt.handle(http.MethodPut, "/{app}/{method}/queue", queue)
+	rt.handle(http.MethodDelete, "/{app}/{method}/queue", queue)
+	rt.handle(http.MethodPost, "/{app}/{method}/queue/claim", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleQueueClaim(w, r, p["app"], p["method"])
+	})
+	rt.handle(http.MethodPost, "/{app}/{method}/queue/ack/{receipt}", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleQueueSettle(w, r, p["app"], p["method"], p["receipt"], true)
+	})
+	rt.handle(http.MethodPost, "/{app}/{method}/queue/nack/{receipt}", func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleQueueSettle(w, r, p["app"], p["method"], p["receipt"], false)
+	})
+	deadLetters := func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleQueueDeadLetters(w, r, p["app"], p["method"])
 	}
+	replays := func(w http.ResponseWriter, r *http.Request, p params) {
+		s.handleReplays(w, r, p["app"], p["method"])
+	}
+	rt.handle(http.MethodGet, "/{app}/{method}/replay", replays)
+	rt.handle(http.MethodPost, "/{app}/{method}/replay", replays)
+	rt.handle(http.MethodDelete, "/{app}/{method}/replay", replays)
 
-	appName := parts[0]
-	methodName := parts[1]
+	rt.handle(http.MethodGet, "/{app}/{method}/queue/dlq", deadLetters)
+	rt.handle(http.MethodDelete, "/{app}/{method}/queue/dlq", deadLetters)
 
-	if appName == "system" {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	return rt
+}
+
+func (s *Server) Start() error {
+	server := &http.Server{
+		Addr:              ":" + s.port,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       s.readTimeout,
+		WriteTimeout:      s.writeTimeout,
+		IdleTimeout:       s.idleTimeout,
+		ConnContext:       connContext,
 	}
 
-	if methodName == "init" {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed for init", http.StatusMethodNotAllowed)
-			return
+	var listeners []net.Listener
+	if !s.tcpDisabled {
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			return err
 		}
-		s.handleCustomInit(w, r, appName)
-		return
+		listeners = append(listeners, listener)
 	}
-
-	if len(parts) == 3 && parts[2] == "history" {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
+	if s.socketPath != "" {
+		listener, err := listenUnix(s.socketPath, s.socketMode)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
 		}
-		s.handleCustomHistory(w, r, appName, methodName)
-		return
+		defer os.Remove(s.socketPath)
+		listeners = append(listeners, listener)
 	}
+	s.registry.startReaper()
+	s.ready.Store(true)
+	defer s.ready.Store(false)
 
-	if len(parts) == 2 {
-		if r.Method == http.MethodGet || r.Method == http.MethodPost || r.Method == http.MethodDelete {
-			s.handleCustomMethod(w, r, appName, methodName)
-			return
-		}
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	return serveListeners(server, listeners)
+}
+
+type BatteryResponse struct {
+	Response
+	AppName string `json:"app_name"`
+	Battery int    `json:"battery"`
+	Time    string `json:"time"`
+}
+
+func (s *Server) handleBattery(w http.ResponseWriter, r *http.Request) {
+	battery, err := GetBatteryPercentage()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to get battery info")
 		return
 	}
 
-	http.Error(w, "Not found", http.StatusNotFound)
-}
\ No newline at end of file
+	writeJSON(w, r, http.StatusOK, &BatteryResponse{
+		AppName: "freeport",
+		Battery: battery,
+		Time:    time.Now().Format(time.RFC3339),
+	})
+}
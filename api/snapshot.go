@@ -0,0 +1,521 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const SnapshotVersion = 1
+
+const (
+	RestoreMerge   = "merge"
+	RestoreReplace = "replace"
+)
+
+// Snapshot is everything a registry stores: the protocol definitions,
+// passkeys included, and every method's latest value and history, and those
+// of its keys. Queues and consumer group positions are not part of it.
+type Snapshot struct {
+	Version  int              `json:"version"`
+	Taken    time.Time        `json:"taken"`
+	Node     string           `json:"node,omitempty"`
+	Manifest *Manifest        `json:"manifest"`
+	Methods  []SnapshotMethod `json:"methods"`
+}
+
+type SnapshotMethod struct {
+	App     string          `json:"app"`
+	Method  string          `json:"method"`
+	Offset  int64           `json:"offset"`
+	Latest  *SnapshotValue  `json:"latest,omitempty"`
+	History []SnapshotEntry `json:"history"`
+	Keys    []SnapshotKey   `json:"keys,omitempty"`
+}
+
+type SnapshotKey struct {
+	Key     string          `json:"key"`
+	Offset  int64           `json:"offset"`
+	Latest  SnapshotValue   `json:"latest"`
+	History []SnapshotEntry `json:"history"`
+}
+
+type SnapshotValue struct {
+	Time    time.Time       `json:"time"`
+	Node    string          `json:"node,omitempty"`
+	Expires *time.Time      `json:"expires,omitempty"`
+	Payload SnapshotPayload `json:"payload"`
+}
+
+type SnapshotEntry struct {
+	Offset    int64           `json:"offset"`
+	Timestamp time.Time       `json:"timestamp"`
+	Source    string          `json:"source"`
+	Payload   SnapshotPayload `json:"payload"`
+}
+
+// SnapshotPayload holds exactly one of a JSON value or a blob, whose bytes
+// are base64 encoded in the archive.
+type SnapshotPayload struct {
+	JSON json.RawMessage `json:"json,omitempty"`
+	Blob *SnapshotBlob   `json:"blob,omitempty"`
+}
+
+type SnapshotBlob struct {
+	ContentType string `json:"content_type"`
+	Filename    string `json:"filename,omitempty"`
+	Data        []byte `json:"data"`
+}
+
+type RestoreStats struct {
+	Mode      string `json:"mode"`
+	Protocols int    `json:"protocols"`
+	Methods   int    `json:"methods"`
+	Entries   int    `json:"entries"`
+}
+
+func snapshotPayload(data interface{}) SnapshotPayload {
+	switch v := data.(type) {
+	case *Blob:
+		return SnapshotPayload{Blob: &SnapshotBlob{ContentType: v.ContentType, Filename: v.Filename, Data: v.Bytes}}
+	case json.RawMessage:
+		return SnapshotPayload{JSON: v}
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		raw = json.RawMessage("null")
+	}
+	return SnapshotPayload{JSON: raw}
+}
+
+func (p SnapshotPayload) value() interface{} {
+	if p.Blob != nil {
+		return newBlob(p.Blob.ContentType, p.Blob.Filename, p.Blob.Data)
+	}
+	if len(p.JSON) == 0 {
+		return json.RawMessage("null")
+	}
+	return p.JSON
+}
+
+// Snapshot captures the registry at one instant.
+func (reg *Registry) Snapshot() *Snapshot {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	manifest := reg.export(true)
+
+	s := &Snapshot{
+		Version:  SnapshotVersion,
+		Taken:    time.Now().UTC(),
+		Node:     reg.node,
+		Manifest: manifest,
+		Methods:  []SnapshotMethod{},
+	}
+	for _, declared := range manifest.Protocols {
+		protocol, exists := reg.protocols[declared.Name]
+		if !exists {
+			continue
+		}
+		for _, methodName := range sortedKeys(protocol.Methods) {
+			history := protocol.History[methodName]
+			data, hasData := protocol.Data[methodName]
+			if !hasData && len(history) == 0 && len(protocol.Keys[methodName]) == 0 {
+				continue
+			}
+
+			method := SnapshotMethod{
+				App:    declared.Name,
+				Method: methodName,
+				Offset: protocol.Offsets[methodName],
+			}
+			if hasData {
+				stamp := protocol.Stamps[methodName]
+				method.Latest = &SnapshotValue{Time: stamp.Time, Node: stamp.Node, Payload: snapshotPayload(data)}
+				if expires, ok := protocol.Expires[methodName]; ok {
+					method.Latest.Expires = &expires
+				}
+			}
+			method.History = snapshotHistory(history)
+			for _, name := range sortedKeys(protocol.Keys[methodName]) {
+				k := protocol.Keys[methodName][name]
+				key := SnapshotKey{
+					Key:     name,
+					Offset:  k.offset,
+					Latest:  SnapshotValue{Time: k.stamp.Time, Node: k.stamp.Node, Payload: snapshotPayload(k.data)},
+					History: snapshotHistory(k.history),
+				}
+				if !k.expires.IsZero() {
+					expires := k.expires
+					key.Latest.Expires = &expires
+				}
+				method.Keys = append(method.Keys, key)
+			}
+			s.Methods = append(s.Methods, method)
+		}
+	}
+	return s
+}
+
+func snapshotHistory(history []DataEntry) []SnapshotEntry {
+	entries := make([]SnapshotEntry, 0, len(history))
+	for _, entry := range history {
+		entries = append(entries, SnapshotEntry{
+			Offset:    entry.Offset,
+			Timestamp: entry.Timestamp,
+			Source:    entry.Source,
+			Payload:   snapshotPayload(entry.Data),
+		})
+	}
+	return entries
+}
+
+// Restore loads a snapshot. RestoreReplace makes the registry exactly what
+// was captured, offsets included. RestoreMerge keeps what is already here:
+// it adds missing protocols and methods, appends history entries it does
+// not have yet with fresh offsets, and only takes a latest value that is
+// newer than the current one.
+func (reg *Registry) Restore(s *Snapshot, mode string) (RestoreStats, error) {
+	stats := RestoreStats{Mode: mode}
+	if mode != RestoreMerge && mode != RestoreReplace {
+		return stats, fmt.Errorf("unknown restore mode %q", mode)
+	}
+	if s.Version != SnapshotVersion {
+		return stats, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	if s.Manifest == nil {
+		return stats, fmt.Errorf("snapshot has no protocols")
+	}
+	if err := s.Manifest.Validate(); err != nil {
+		return stats, err
+	}
+
+	reg.mu.Lock()
+	if err := checkDerivations(reg.restoredDerivations(s.Manifest, mode)); err != nil {
+		reg.mu.Unlock()
+		return stats, err
+	}
+	if mode == RestoreReplace {
+		for appName := range reg.protocols {
+			reg.stopGenerators(appName)
+			reg.stopReplays(appName)
+		}
+		reg.protocols = make(map[string]*CustomProtocol)
+	}
+
+	for _, declared := range s.Manifest.Protocols {
+		protocol, exists := reg.protocols[declared.Name]
+		if !exists {
+			protocol = reg.newProtocol(declared.Name, declared.Passkey, declared.Description)
+			protocol.Retention = retentionOf(declared.Retention)
+			reg.protocols[declared.Name] = protocol
+			stats.Protocols++
+		}
+		for _, method := range declared.Methods {
+			if _, exists := protocol.Methods[method.Name]; exists {
+				continue
+			}
+			protocol.Methods[method.Name] = method.Description
+			if method.Schema != nil {
+				protocol.Schemas[method.Name] = method.Schema
+			}
+			if method.Retention != nil {
+				protocol.MethodRetention[method.Name] = *method.Retention
+			}
+			if method.Derive != nil {
+				protocol.Derived[method.Name], _ = method.Derive.compile(declared.Name)
+			}
+		}
+	}
+
+	for _, method := range s.Methods {
+		protocol, exists := reg.protocols[method.App]
+		if !exists {
+			continue
+		}
+		if _, exists := protocol.Methods[method.Method]; !exists {
+			continue
+		}
+		stats.Methods++
+
+		if mode == RestoreReplace {
+			stats.Entries += restoreMethod(protocol, method)
+		} else {
+			stats.Entries += mergeMethod(protocol, method)
+		}
+	}
+	reg.mu.Unlock()
+
+	reg.RecordAudit(AuditSnapshotRestored, "", "", fmt.Sprintf("%s: %d protocols, %d entries", mode, stats.Protocols, stats.Entries), "")
+	return stats, nil
+}
+
+// restoredDerivations is the derivation graph the registry would have after
+// restoring m. A merge keeps the methods that already exist as they are. The
+// caller holds reg.mu.
+func (reg *Registry) restoredDerivations(m *Manifest, mode string) map[methodRef][]methodRef {
+	graph := map[methodRef][]methodRef{}
+	if mode == RestoreMerge {
+		graph = reg.derivationGraph()
+	}
+	for _, declared := range m.Protocols {
+		for _, method := range declared.Methods {
+			ref := methodRef{declared.Name, method.Name}
+			if _, exists := graph[ref]; exists || method.Derive == nil {
+				continue
+			}
+			if mode == RestoreMerge {
+				if protocol, exists := reg.protocols[declared.Name]; exists {
+					if _, exists := protocol.Methods[method.Name]; exists {
+						continue
+					}
+				}
+			}
+			d, _ := method.Derive.compile(declared.Name)
+			graph[ref] = d.sources()
+		}
+	}
+	return graph
+}
+
+func restoreMethod(protocol *CustomProtocol, method SnapshotMethod) int {
+	history := restoreHistory(method.History)
+	protocol.History[method.Method] = history
+	protocol.Offsets[method.Method] = method.Offset
+	if method.Latest != nil {
+		protocol.Data[method.Method] = method.Latest.Payload.value()
+		protocol.Stamps[method.Method] = Stamp{Time: method.Latest.Time, Node: method.Latest.Node}
+		method.Latest.restoreExpiry(protocol, method.Method)
+	}
+
+	restored := len(history)
+	delete(protocol.Keys, method.Method)
+	for _, key := range method.Keys {
+		protocol.keys(method.Method)[key.Key] = restoreKey(key)
+		restored += len(key.History)
+	}
+	return restored
+}
+
+func restoreKey(key SnapshotKey) *keyed {
+	k := &keyed{
+		data:    key.Latest.Payload.value(),
+		stamp:   Stamp{Time: key.Latest.Time, Node: key.Latest.Node},
+		offset:  key.Offset,
+		history: restoreHistory(key.History),
+	}
+	if key.Latest.Expires != nil {
+		k.expires = *key.Latest.Expires
+	}
+	return k
+}
+
+func restoreHistory(entries []SnapshotEntry) []DataEntry {
+	history := make([]DataEntry, 0, len(entries))
+	for _, entry := range entries {
+		history = append(history, DataEntry{
+			Offset:    entry.Offset,
+			Data:      entry.Payload.value(),
+			Timestamp: entry.Timestamp,
+			Source:    entry.Source,
+		})
+	}
+	return history
+}
+
+func mergeMethod(protocol *CustomProtocol, method SnapshotMethod) int {
+	offset := protocol.Offsets[method.Method]
+	history, added := mergeHistory(protocol.History[method.Method], &offset, method.History, protocol.historyLimit(method.Method))
+	protocol.History[method.Method] = history
+	protocol.Offsets[method.Method] = offset
+
+	if method.Latest != nil {
+		stamp := Stamp{Time: method.Latest.Time, Node: method.Latest.Node}
+		if current, ok := protocol.Stamps[method.Method]; !ok || stamp.After(current) {
+			protocol.Data[method.Method] = method.Latest.Payload.value()
+			protocol.Stamps[method.Method] = stamp
+			method.Latest.restoreExpiry(protocol, method.Method)
+		}
+	}
+
+	for _, key := range method.Keys {
+		k, exists := protocol.keys(method.Method)[key.Key]
+		if !exists {
+			protocol.keys(method.Method)[key.Key] = restoreKey(key)
+			added += len(key.History)
+			continue
+		}
+		var merged int
+		k.history, merged = mergeHistory(k.history, &k.offset, key.History, protocol.historyLimit(method.Method))
+		added += merged
+		if latest := restoreKey(key); latest.stamp.After(k.stamp) {
+			k.data, k.stamp, k.expires = latest.data, latest.stamp, latest.expires
+		}
+	}
+	return added
+}
+
+// mergeHistory appends the entries history does not have yet, in time
+// order and with fresh offsets counted from *offset, and trims the result
+// to limit. It returns how many it appended.
+func mergeHistory(history []DataEntry, offset *int64, entries []SnapshotEntry, limit int) ([]DataEntry, int) {
+	type key struct {
+		at     time.Time
+		source string
+	}
+	seen := map[key]bool{}
+	for _, entry := range history {
+		seen[key{entry.Timestamp.UTC(), entry.Source}] = true
+	}
+
+	entries = append([]SnapshotEntry(nil), entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	added := 0
+	for _, entry := range entries {
+		if seen[key{entry.Timestamp.UTC(), entry.Source}] {
+			continue
+		}
+		*offset++
+		history = append(history, DataEntry{
+			Offset:    *offset,
+			Data:      entry.Payload.value(),
+			Timestamp: entry.Timestamp,
+			Source:    entry.Source,
+		})
+		added++
+	}
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	return history, added
+}
+
+func (v *SnapshotValue) restoreExpiry(protocol *CustomProtocol, methodName string) {
+	if v.Expires != nil {
+		protocol.Expires[methodName] = *v.Expires
+	} else {
+		delete(protocol.Expires, methodName)
+	}
+}
+
+// WriteSnapshot writes s as a gzip-compressed JSON archive.
+func WriteSnapshot(w io.Writer, s *Snapshot) error {
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(s); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// maxSnapshotBytes bounds the JSON an archive may decompress to, so a small
+// gzip bomb cannot exhaust memory.
+const maxSnapshotBytes = 256 << 20
+
+var ErrSnapshotTooLarge = errors.New("snapshot: larger than 256 MiB when decompressed")
+
+// ReadSnapshot reads an archive written by WriteSnapshot. Plain JSON is
+// accepted too, so a snapshot can be edited by hand. It fails with
+// ErrSnapshotTooLarge past maxSnapshotBytes of JSON.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	var reader io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	var s Snapshot
+	capped := &cappedReader{r: reader, left: maxSnapshotBytes}
+	if err := json.NewDecoder(capped).Decode(&s); err != nil {
+		if errors.Is(err, ErrSnapshotTooLarge) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	return &s, nil
+}
+
+// cappedReader reads r until left bytes have gone by, then fails with
+// ErrSnapshotTooLarge if there is more.
+type cappedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > c.left+1 {
+		p = p[:c.left+1]
+	}
+	n, err := c.r.Read(p)
+	if int64(n) > c.left {
+		c.left = 0
+		return n - 1, ErrSnapshotTooLarge
+	}
+	c.left -= int64(n)
+	return n, err
+}
+
+type RestoreResponse struct {
+	Response
+	RestoreStats
+}
+
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		name := "freeport-" + time.Now().UTC().Format("20060102-150405") + ".json.gz"
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		WriteSnapshot(w, s.registry.Snapshot())
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = RestoreMerge
+	}
+	if mode != RestoreMerge && mode != RestoreReplace {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "mode must be merge or replace")
+		return
+	}
+
+	s.limitBody(w, r, "system")
+	snapshot, err := ReadSnapshot(r.Body)
+	if errors.Is(err, ErrSnapshotTooLarge) {
+		s.rejectTooLarge(w, r, "system", maxSnapshotBytes)
+		return
+	}
+	if err != nil {
+		if s.rejectedTooLarge(w, r, "system", err) {
+			return
+		}
+		writeErrorDetails(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid snapshot", map[string]interface{}{
+			"reason": err.Error(),
+		})
+		return
+	}
+
+	stats, err := s.registry.Restore(snapshot, mode)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusOK, &RestoreResponse{RestoreStats: stats})
+}
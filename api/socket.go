@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const DefaultSocketMode os.FileMode = 0600
+
+type peerUIDKey struct{}
+
+type inProcessKey struct{}
+
+// SetUnixSocket makes Start also serve on a Unix domain socket at path,
+// created with the given permissions. An empty path disables the socket.
+func (s *Server) SetUnixSocket(path string, mode os.FileMode) {
+	if mode == 0 {
+		mode = DefaultSocketMode
+	}
+	s.socketPath = path
+	s.socketMode = mode
+}
+
+// SetTCPEnabled turns the TCP listener off for socket-only setups.
+func (s *Server) SetTCPEnabled(enabled bool) {
+	s.tcpDisabled = !enabled
+}
+
+// SetTrustedUIDs lets processes running as these users call protocol
+// endpoints over the Unix socket without a passkey. The kernel reports the
+// peer's UID, so it cannot be spoofed the way a header can.
+func (s *Server) SetTrustedUIDs(uids []int) {
+	s.trustedUIDs = make(map[int]bool, len(uids))
+	for _, uid := range uids {
+		s.trustedUIDs[uid] = true
+	}
+}
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		// A socket left behind by a previous run; refuse to steal it from
+		// a bus that is still running.
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+
+	// Create the socket private to this user, so it is never reachable
+	// with default permissions before the Chmod to mode below.
+	restore := restrictUmask()
+	listener, err := net.Listen("unix", path)
+	restore()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// connContext records the peer UID of Unix socket connections so handlers
+// can authorize on it.
+func connContext(ctx context.Context, conn net.Conn) context.Context {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	if uid, ok := connPeerUID(unixConn); ok {
+		return context.WithValue(ctx, peerUIDKey{}, uid)
+	}
+	return ctx
+}
+
+func peerUID(r *http.Request) (int, bool) {
+	uid, ok := r.Context().Value(peerUIDKey{}).(int)
+	return uid, ok
+}
+
+// inProcess reports whether r came through InProcessHandler.
+func inProcess(r *http.Request) bool {
+	return r.Context().Value(inProcessKey{}) != nil
+}
+
+func (s *Server) peerTrusted(r *http.Request) bool {
+	uid, ok := peerUID(r)
+	return ok && s.trustedUIDs[uid]
+}
+
+// remoteAddr names the caller for logs. Unix socket peers have no address,
+// so they are identified by UID instead.
+func remoteAddr(r *http.Request) string {
+	if inProcess(r) {
+		return "in-process"
+	}
+	if uid, ok := peerUID(r); ok {
+		return "unix:uid=" + strconv.Itoa(uid)
+	}
+	if r.RemoteAddr == "" || r.RemoteAddr == "@" {
+		return "unix"
+	}
+	return r.RemoteAddr
+}
+
+func serveListeners(server *http.Server, listeners []net.Listener) error {
+	if len(listeners) == 0 {
+		return errors.New("no listeners configured")
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			errs <- server.Serve(listener)
+		}(listener)
+	}
+	err := <-errs
+	server.Close()
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package api
+
+// restrictUmask does nothing where there is no umask.
+func restrictUmask() func() {
+	return func() {}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package api
+
+import "syscall"
+
+// restrictUmask makes files created from now on private to their owner,
+// until the returned func puts the old umask back. The umask is process
+// wide, so the window should be kept as short as a single call.
+func restrictUmask() func() {
+	old := syscall.Umask(0177)
+	return func() {
+		syscall.Umask(old)
+	}
+}
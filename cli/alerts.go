@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+func runAlerts(o *options, args []string) error {
+	history := o.flags.Bool("history", false, "list past alerts instead of the rules")
+	state := o.flags.String("state", "", "with --history, only alerts that are firing or resolved")
+	if _, err := o.parse(args, 0); err != nil {
+		return err
+	}
+
+	result, err := o.client("").Alerts(context.Background(), *state)
+	if err != nil {
+		return err
+	}
+
+	if *history {
+		rows := make([][]string, 0, len(result.Alerts))
+		for _, alert := range result.Alerts {
+			rows = append(rows, []string{
+				alert.Time.Format(time.RFC3339),
+				alert.Rule,
+				alert.State,
+				alert.Message,
+			})
+		}
+		return o.print(result.Alerts, []string{"TIME", "RULE", "STATE", "MESSAGE"}, rows)
+	}
+
+	rows := make([][]string, 0, len(result.Rules))
+	for _, rule := range result.Rules {
+		check := rule.Condition
+		if rule.Stale != "" {
+			check = "stale " + rule.Stale
+		} else if rule.For != "" {
+			check += " for " + rule.For
+		}
+		state := rule.State
+		if rule.Since != nil {
+			state += " since " + rule.Since.Format(time.RFC3339)
+		}
+		if rule.LastError != "" {
+			state += ": " + rule.LastError
+		}
+		value := "-"
+		if rule.Value != nil {
+			encoded, _ := json.Marshal(rule.Value)
+			value = truncate(string(encoded), 30)
+		}
+		rows = append(rows, []string{rule.Name, rule.Source, check, value, state})
+	}
+	return o.print(result.Rules, []string{"RULE", "SOURCE", "CHECK", "VALUE", "STATE"}, rows)
+}
@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"freeport/client"
+	"freeport/config"
+)
+
+type command struct {
+	usage   string
+	summary string
+	run     func(o *options, args []string) error
+}
+
+var commands = map[string]command{
+	"alerts": {
+		usage:   "alerts [--history] [--state firing|resolved]",
+		summary: "list alert rules, or past alerts, with the admin token",
+		run:     runAlerts,
+	},
+	"apply": {
+		usage:   "apply -f <manifest.yaml|manifest.json|-> [--prune] [--dry-run]",
+		summary: "make the bus's protocols match a manifest",
+		run:     runApply,
+	},
+	"export": {
+		usage:   "export [-f file] [--format yaml|json] [--passkeys]",
+		summary: "write the bus's protocols out as a manifest",
+		run:     runExport,
+	},
+	"replay": {
+		usage:   "replay start <app> <method> [--from method] [--since t] [--until t] [--speed x] [--loop] | list <app> <method> | stop <app> <method> <id>",
+		summary: "re-emit recorded history into a method at its original pace",
+		run:     runReplay,
+	},
+	"restore": {
+		usage:   "restore -f <archive> [--mode merge|replace]",
+		summary: "load a snapshot archive into the bus",
+		run:     runRestore,
+	},
+	"send": {
+		usage:   "send <app> <method> --data <json|@file|@-> [--key k] [--ttl duration] [--if-match rev|*] [--if-none-match *]",
+		summary: "store a payload on a method",
+		run:     runSend,
+	},
+	"get": {
+		usage:   "get <app> <method> [--key k] [--raw] [--stale]",
+		summary: "print the latest payload on a method",
+		run:     runGet,
+	},
+	"keys": {
+		usage:   "keys <app> <method> [--prefix p] [--after k] [--limit n] [--all]",
+		summary: "list the keys stored under a method",
+		run:     runKeys,
+	},
+	"derived": {
+		usage:   "derived",
+		summary: "list methods computed from other methods, with the admin token",
+		run:     runDerived,
+	},
+	"generate": {
+		usage:   "generate start <app> <method> (--template t | --values v | --schema) [--interval d] [--count n] | rate <app> <method> <interval> | stop <app> <method> | list",
+		summary: "post synthetic payloads on a method with the admin token",
+		run:     runGenerate,
+	},
+	"history": {
+		usage:   "history <app> <method> [--key k]",
+		summary: "print the recent payloads on a method",
+		run:     runHistory,
+	},
+	"snapshot": {
+		usage:   "snapshot [-f archive]",
+		summary: "save all stored data and protocols to an archive",
+		run:     runSnapshot,
+	},
+	"watch": {
+		usage:   "watch <app> <method> [--group name]",
+		summary: "stream payloads as they arrive, until interrupted",
+		run:     runWatch,
+	},
+	"battery": {
+		usage:   "battery",
+		summary: "print the host battery level",
+		run:     runBattery,
+	},
+	"protocols": {
+		usage:   "protocols list | create <app> --passkey <key> [--method name[:description]]... | delete <app>",
+		summary: "manage protocols with the admin token",
+		run:     runProtocols,
+	},
+}
+
+// errUsage is returned by a command whose arguments are wrong; Run prints the
+// command's usage line for it.
+var errUsage = errors.New("usage")
+
+type options struct {
+	flags      *flag.FlagSet
+	url        string
+	passkey    string
+	adminToken string
+	output     string
+	timeout    time.Duration
+	retries    int
+	stdout     io.Writer
+}
+
+// Run executes the subcommand in args and returns the process exit code.
+func Run(args []string, cfg *config.Config) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "freeport: unknown command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	o := newOptions(args[0], cfg)
+	err := cmd.run(o, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		fmt.Fprintf(os.Stderr, "usage: freeport %s\n\nflags:\n", cmd.usage)
+		o.flags.SetOutput(os.Stderr)
+		o.flags.PrintDefaults()
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "freeport %s: %v\n", args[0], err)
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			if problems, ok := apiErr.Details["problems"].([]interface{}); ok {
+				for _, problem := range problems {
+					fmt.Fprintf(os.Stderr, "  %v\n", problem)
+				}
+			}
+		}
+		return 1
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: freeport [command] [flags]")
+	fmt.Fprintln(w, "\nWith no command, freeport starts the bus and its terminal UI.")
+	fmt.Fprintln(w, "\ncommands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range sortedNames() {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, commands[name].summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nCredentials can be passed as flags or through FREEPORT_URL, FREEPORT_PASSKEY,")
+	fmt.Fprintln(w, "FREEPORT_ADMIN_TOKEN and FREEPORT_OUTPUT. Run 'freeport <command> -h' for flags.")
+}
+
+func sortedNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newOptions(name string, cfg *config.Config) *options {
+	o := &options{
+		flags:  flag.NewFlagSet(name, flag.ContinueOnError),
+		stdout: os.Stdout,
+	}
+	o.flags.SetOutput(io.Discard)
+
+	baseURL := client.DefaultBaseURL
+	adminToken := env("FREEPORT_ADMIN_TOKEN", "")
+	if cfg != nil {
+		baseURL = cfg.BusURL()
+		if adminToken == "" {
+			adminToken = cfg.AdminToken
+		}
+	}
+
+	o.flags.StringVar(&o.url, "url", env("FREEPORT_URL", baseURL), "bus base URL, or unix:///path for the socket")
+	o.flags.StringVar(&o.passkey, "passkey", env("FREEPORT_PASSKEY", ""), "protocol passkey")
+	o.flags.StringVar(&o.adminToken, "admin-token", adminToken, "admin token for protocol management")
+	o.flags.StringVar(&o.output, "output", env("FREEPORT_OUTPUT", "table"), "output format: table or json")
+	o.flags.DurationVar(&o.timeout, "timeout", client.DefaultTimeout, "per-request timeout")
+	o.flags.IntVar(&o.retries, "retries", 2, "retries for failed requests")
+	return o
+}
+
+func env(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// parse parses flags wherever they appear among the arguments, so that
+// "send app method --data x" works as well as "send --data x app method".
+func (o *options) parse(args []string, want int) ([]string, error) {
+	var positional []string
+	for {
+		if err := o.flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = o.flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) != want {
+		return nil, errUsage
+	}
+	if o.output != "table" && o.output != "json" {
+		return nil, fmt.Errorf("unknown output format %q", o.output)
+	}
+	return positional, nil
+}
+
+func (o *options) client(appName string) *client.Client {
+	c := client.New(o.url)
+	c.SetTimeout(o.timeout)
+	c.SetRetries(o.retries, 200*time.Millisecond)
+	c.SetCredentials(appName, o.passkey)
+	c.SetAdminToken(o.adminToken)
+	return c
+}
+
+// print writes v as indented JSON, or rows as an aligned table under header.
+func (o *options) print(v interface{}, header []string, rows [][]string) error {
+	if o.output == "json" {
+		encoder := json.NewEncoder(o.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(o.stdout, 0, 4, 2, ' ', 0)
+	if header != nil {
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func truncate(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len([]rune(text)) > n {
+		return string([]rune(text)[:n]) + "…"
+	}
+	return text
+}
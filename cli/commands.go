@@ -0,0 +1,325 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"freeport/client"
+)
+
+func runSend(o *options, args []string) error {
+	data := o.flags.String("data", "", "payload: inline JSON, @file, or @- for stdin")
+	contentType := o.flags.String("content-type", "application/json", "content type of the payload")
+	ttl := o.flags.Duration("ttl", 0, "how long the value stays current, instead of the method's TTL")
+	ifMatch := o.flags.String("if-match", "", "store only over this revision of the current value, or * for any")
+	ifNoneMatch := o.flags.String("if-none-match", "", "* to store only when the method has no current value")
+	key := o.flags.String("key", "", "store under this key of the method instead of as its value")
+	positional, err := o.parse(args, 2)
+	if err != nil {
+		return err
+	}
+	if *data == "" {
+		return errUsage
+	}
+
+	body, err := readData(*data)
+	if err != nil {
+		return err
+	}
+
+	c := o.client(positional[0])
+	cond := client.Precondition{IfMatch: *ifMatch, IfNoneMatch: *ifNoneMatch}
+	var result *client.StoreResult
+	if *key != "" {
+		result, err = c.PutKeyRaw(context.Background(), positional[1], *key, *contentType, body, *ttl, cond)
+	} else {
+		result, err = c.PostRawIf(context.Background(), positional[1], *contentType, body, *ttl, cond)
+	}
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{
+		{"App", result.AppName},
+		{"Method", result.Method},
+	}
+	if result.Key != "" {
+		rows = append(rows, []string{"Key", result.Key})
+	}
+	rows = append(rows, [][]string{
+		{"Stored", result.Timestamp.Format(time.RFC3339)},
+		{"Revision", result.Revision},
+	}...)
+	if !result.Expires.IsZero() {
+		rows = append(rows, []string{"Expires", result.Expires.Format(time.RFC3339)})
+	}
+	if result.SHA256 != "" {
+		rows = append(rows,
+			[]string{"Content-Type", result.ContentType},
+			[]string{"Size", strconv.FormatInt(result.Size, 10)},
+			[]string{"SHA-256", result.SHA256},
+		)
+	}
+	return o.print(result, nil, rows)
+}
+
+// readData resolves a --data value: "@-" reads stdin, "@path" reads a file,
+// anything else is the payload itself.
+func readData(value string) ([]byte, error) {
+	switch {
+	case value == "@-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(value, "@"):
+		return os.ReadFile(value[1:])
+	default:
+		return []byte(value), nil
+	}
+}
+
+func runGet(o *options, args []string) error {
+	raw := o.flags.Bool("raw", false, "write the payload exactly as stored, e.g. for blobs")
+	stale := o.flags.Bool("stale", false, "print a value past its TTL instead of failing")
+	key := o.flags.String("key", "", "print the value under this key of the method")
+	positional, err := o.parse(args, 2)
+	if err != nil {
+		return err
+	}
+	if *key != "" && *stale {
+		return errUsage
+	}
+	c := o.client(positional[0])
+
+	if *raw {
+		getRaw := c.GetRaw
+		if *key != "" {
+			getRaw = func(ctx context.Context, method string) (*client.Raw, error) {
+				return c.GetKeyRaw(ctx, method, *key)
+			}
+		}
+		payload, err := getRaw(context.Background(), positional[1])
+		if err != nil {
+			return err
+		}
+		_, err = o.stdout.Write(payload.Body)
+		return err
+	}
+
+	get := c.Get
+	switch {
+	case *stale:
+		get = c.GetStale
+	case *key != "":
+		get = func(ctx context.Context, method string) (*client.Value, error) {
+			return c.GetKey(ctx, method, *key)
+		}
+	}
+	value, err := get(context.Background(), positional[1])
+	if err != nil {
+		return err
+	}
+	rows := [][]string{
+		{"App", value.AppName},
+		{"Method", value.Method},
+	}
+	if value.Key != "" {
+		rows = append(rows, []string{"Key", value.Key})
+	}
+	rows = append(rows, [][]string{
+		{"Time", value.Time.Format(time.RFC3339)},
+		{"Stored", value.Stored.Format(time.RFC3339)},
+		{"Revision", value.Revision},
+		{"Age", (time.Duration(value.AgeSeconds) * time.Second).String()},
+	}...)
+	if !value.Expires.IsZero() {
+		expires := value.Expires.Format(time.RFC3339)
+		if value.Stale {
+			expires += " (stale)"
+		}
+		rows = append(rows, []string{"Expires", expires})
+	}
+	return o.print(value, nil, append(rows, []string{"Data", string(value.Data)}))
+}
+
+func runHistory(o *options, args []string) error {
+	key := o.flags.String("key", "", "print the history of this key of the method")
+	positional, err := o.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	c := o.client(positional[0])
+	var entries []client.Entry
+	if *key != "" {
+		entries, err = c.KeyHistory(context.Background(), positional[1], *key)
+	} else {
+		entries, err = c.History(context.Background(), positional[1])
+	}
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, entryRow(entry))
+	}
+	return o.print(entries, []string{"OFFSET", "TIMESTAMP", "SOURCE", "DATA"}, rows)
+}
+
+func entryRow(entry client.Entry) []string {
+	return []string{
+		strconv.FormatInt(entry.Offset, 10),
+		entry.Timestamp.Format(time.RFC3339),
+		entry.Source,
+		truncate(string(entry.Data), 60),
+	}
+}
+
+func runWatch(o *options, args []string) error {
+	group := o.flags.String("group", "", "consumer group to read as, resuming where it left off (default: tail new entries)")
+	interval := o.flags.Duration("interval", time.Second, "how often to poll when idle")
+	positional, err := o.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	c := o.client(positional[0])
+	c.SetPollInterval(*interval)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	encoder := json.NewEncoder(o.stdout)
+	show := func(entry client.Entry) error {
+		if o.output == "json" {
+			return encoder.Encode(entry)
+		}
+		_, err := fmt.Fprintln(o.stdout, strings.Join(entryRow(entry), "  "))
+		return err
+	}
+	gap := func(skipped int64) {
+		fmt.Fprintf(os.Stderr, "%d entries were trimmed from history before they could be read\n", skipped)
+	}
+
+	if *group == "" {
+		err = c.Tail(ctx, positional[1], show, gap)
+	} else {
+		err = c.Subscribe(ctx, positional[1], *group, show, gap)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func runBattery(o *options, args []string) error {
+	if _, err := o.parse(args, 0); err != nil {
+		return err
+	}
+
+	battery, err := o.client("").Battery(context.Background())
+	if err != nil {
+		return err
+	}
+	return o.print(battery, nil, [][]string{
+		{"Battery", strconv.Itoa(battery.Battery) + "%"},
+		{"Time", battery.Time.Format(time.RFC3339)},
+	})
+}
+
+func runProtocols(o *options, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return runProtocolsList(o, args[1:])
+	case "create":
+		return runProtocolsCreate(o, args[1:])
+	case "delete":
+		return runProtocolsDelete(o, args[1:])
+	}
+	return errUsage
+}
+
+func runProtocolsList(o *options, args []string) error {
+	if _, err := o.parse(args, 0); err != nil {
+		return err
+	}
+
+	protocols, err := o.client("").ListProtocols(context.Background())
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(protocols))
+	for _, protocol := range protocols {
+		names := make([]string, 0, len(protocol.Methods))
+		for _, method := range protocol.Methods {
+			names = append(names, method.Name)
+		}
+		rows = append(rows, []string{protocol.AppName, strings.Join(names, ","), protocol.Description})
+	}
+	return o.print(protocols, []string{"APP", "METHODS", "DESCRIPTION"}, rows)
+}
+
+// methodFlags collects repeated --method name[:description] flags.
+type methodFlags []client.Method
+
+func (m *methodFlags) String() string {
+	return ""
+}
+
+func (m *methodFlags) Set(value string) error {
+	name, description, _ := strings.Cut(value, ":")
+	if name == "" {
+		return fmt.Errorf("empty method name")
+	}
+	*m = append(*m, client.Method{Name: name, Description: description})
+	return nil
+}
+
+func runProtocolsCreate(o *options, args []string) error {
+	description := o.flags.String("description", "", "protocol description")
+	var methods methodFlags
+	o.flags.Var(&methods, "method", "method to register as name[:description]; repeatable")
+	positional, err := o.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	if o.passkey == "" {
+		return fmt.Errorf("a passkey is required (--passkey or FREEPORT_PASSKEY)")
+	}
+
+	protocol, err := o.client("").CreateProtocol(context.Background(), positional[0], o.passkey, *description, methods)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"App", protocol.AppName}, {"Description", protocol.Description}}
+	for _, method := range protocol.Methods {
+		rows = append(rows, []string{"Method", method.Name + "  " + method.Description})
+	}
+	return o.print(protocol, nil, rows)
+}
+
+func runProtocolsDelete(o *options, args []string) error {
+	positional, err := o.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	if err := o.client("").DeleteProtocol(context.Background(), positional[0]); err != nil {
+		return err
+	}
+	return o.print(map[string]string{"app_name": positional[0], "status": "deleted"}, nil, [][]string{
+		{"Deleted", positional[0]},
+	})
+}
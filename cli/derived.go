@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func runDerived(o *options, args []string) error {
+	if _, err := o.parse(args, 0); err != nil {
+		return err
+	}
+
+	derived, err := o.client("").Derived(context.Background())
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(derived))
+	for _, d := range derived {
+		sources := make([]string, 0, len(d.Sources))
+		for name, source := range d.Sources {
+			sources = append(sources, name+"="+source)
+		}
+		sort.Strings(sources)
+
+		updated := "-"
+		if d.Updated != nil {
+			updated = d.Updated.Format(time.RFC3339)
+		}
+		state := "ok"
+		if d.LastError != "" {
+			state = d.LastError
+		}
+		rows = append(rows, []string{
+			d.AppName + "/" + d.Method,
+			strings.Join(sources, ","),
+			d.Expr,
+			strconv.FormatInt(d.Evaluations, 10),
+			updated,
+			state,
+		})
+	}
+	return o.print(derived, []string{"TARGET", "SOURCES", "EXPR", "EVALUATIONS", "UPDATED", "STATE"}, rows)
+}
@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"freeport/client"
+)
+
+func runGenerate(o *options, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "start":
+		return runGenerateStart(o, args[1:])
+	case "rate":
+		return runGenerateRate(o, args[1:])
+	case "stop":
+		return runGenerateStop(o, args[1:])
+	case "list":
+		return runGenerateList(o, args[1:])
+	}
+	return errUsage
+}
+
+func runGenerateStart(o *options, args []string) error {
+	template := o.flags.String("template", "", "JSON template with {{placeholders}}: inline, @file, or @- for stdin")
+	values := o.flags.String("values", "", "JSON array of payloads to post in turn: inline, @file, or @-")
+	schema := o.flags.Bool("schema", false, "make up payloads that match the method's schema")
+	interval := o.flags.Duration("interval", time.Second, "time between payloads")
+	count := o.flags.Int64("count", 0, "stop after this many stored payloads; 0 runs until stopped")
+	positional, err := o.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	settings := client.GeneratorSettings{Interval: *interval, Count: *count}
+	modes := 0
+	if *template != "" {
+		modes++
+		settings.Mode = "template"
+		if settings.Template, err = readData(*template); err != nil {
+			return err
+		}
+	}
+	if *values != "" {
+		modes++
+		settings.Mode = "list"
+		data, err := readData(*values)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &settings.Values); err != nil {
+			return fmt.Errorf("--values must be a JSON array: %w", err)
+		}
+	}
+	if *schema {
+		modes++
+		settings.Mode = "schema"
+	}
+	if modes != 1 {
+		return fmt.Errorf("give exactly one of --template, --values or --schema")
+	}
+
+	g, err := o.client("").StartGenerator(context.Background(), positional[0], positional[1], settings)
+	if err != nil {
+		return err
+	}
+	return o.print(g, nil, generatorRows(g))
+}
+
+func runGenerateRate(o *options, args []string) error {
+	positional, err := o.parse(args, 3)
+	if err != nil {
+		return err
+	}
+	interval, err := time.ParseDuration(positional[2])
+	if err != nil {
+		return fmt.Errorf("invalid interval %q", positional[2])
+	}
+
+	g, err := o.client("").SetGeneratorInterval(context.Background(), positional[0], positional[1], interval)
+	if err != nil {
+		return err
+	}
+	return o.print(g, nil, generatorRows(g))
+}
+
+func runGenerateStop(o *options, args []string) error {
+	positional, err := o.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	if err := o.client("").StopGenerator(context.Background(), positional[0], positional[1]); err != nil {
+		return err
+	}
+	target := positional[0] + "/" + positional[1]
+	return o.print(map[string]string{"target": target, "status": "stopped"}, nil, [][]string{
+		{"Stopped", target},
+	})
+}
+
+func runGenerateList(o *options, args []string) error {
+	if _, err := o.parse(args, 0); err != nil {
+		return err
+	}
+
+	generators, err := o.client("").Generators(context.Background())
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(generators))
+	for _, g := range generators {
+		state := "running"
+		if !g.Running {
+			state = "stopped"
+		}
+		if g.LastError != "" {
+			state += ": " + g.LastError
+		}
+		rows = append(rows, []string{
+			g.AppName + "/" + g.Method,
+			g.Mode,
+			g.Interval,
+			strconv.FormatInt(g.Sent, 10),
+			strconv.FormatInt(g.Rejected, 10),
+			state,
+		})
+	}
+	return o.print(generators, []string{"TARGET", "MODE", "INTERVAL", "SENT", "REJECTED", "STATE"}, rows)
+}
+
+func generatorRows(g *client.Generator) [][]string {
+	rows := [][]string{
+		{"Target", g.AppName + "/" + g.Method},
+		{"Mode", g.Mode},
+		{"Interval", g.Interval},
+		{"Sent", strconv.FormatInt(g.Sent, 10)},
+	}
+	if g.Count > 0 {
+		rows = append(rows, []string{"Count", strconv.FormatInt(g.Count, 10)})
+	}
+	return rows
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"freeport/client"
+)
+
+func runKeys(o *options, args []string) error {
+	prefix := o.flags.String("prefix", "", "only list keys starting with this")
+	after := o.flags.String("after", "", "start after this key, as printed by the previous page")
+	limit := o.flags.Int("limit", 0, "keys per page; the bus's default when 0")
+	all := o.flags.Bool("all", false, "follow every page")
+	positional, err := o.parse(args, 2)
+	if err != nil {
+		return err
+	}
+	c := o.client(positional[0])
+
+	query := client.KeyQuery{Prefix: *prefix, After: *after, Limit: *limit}
+	var keys []client.KeyInfo
+	next := ""
+	for {
+		page, err := c.Keys(context.Background(), positional[1], query)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, page.Keys...)
+		next = page.Next
+		if !*all || next == "" {
+			break
+		}
+		query.After = next
+	}
+
+	rows := make([][]string, 0, len(keys)+1)
+	for _, key := range keys {
+		expires := "-"
+		if key.Expires != nil {
+			expires = key.Expires.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{
+			key.Key,
+			key.Revision,
+			key.Stored.Format(time.RFC3339),
+			expires,
+			strconv.Itoa(key.Entries),
+		})
+	}
+	if next != "" {
+		rows = append(rows, []string{"… more with --after " + next})
+	}
+	return o.print(client.KeyPage{Keys: keys, Next: next}, []string{"KEY", "REVISION", "STORED", "EXPIRES", "ENTRIES"}, rows)
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"freeport/api"
+	"freeport/manifest"
+)
+
+func runApply(o *options, args []string) error {
+	file := o.flags.String("f", "", "manifest file, or - for standard input")
+	prune := o.flags.Bool("prune", false, "delete protocols and methods the manifest does not list")
+	dryRun := o.flags.Bool("dry-run", false, "show the changes without making them")
+	if _, err := o.parse(args, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errUsage
+	}
+
+	// Parsing locally catches YAML and schema mistakes with line numbers
+	// before anything is sent.
+	m, err := manifest.Load(*file)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	changes, err := o.client("").ApplyManifest(context.Background(), body, *prune, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if o.output == "table" && len(changes) == 0 {
+		fmt.Fprintln(o.stdout, "No changes; the bus already matches the manifest.")
+		return nil
+	}
+	rows := make([][]string, 0, len(changes))
+	for _, change := range changes {
+		rows = append(rows, []string{change.Action, change.Target, truncate(change.Detail, 50)})
+	}
+	header := []string{"ACTION", "TARGET", "DETAIL"}
+	if *dryRun {
+		header[0] = "WOULD"
+	}
+	return o.print(changes, header, rows)
+}
+
+func runExport(o *options, args []string) error {
+	file := o.flags.String("f", "", "write to this file instead of standard output")
+	format := o.flags.String("format", "", "yaml or json; defaults to the file extension, else yaml")
+	passkeys := o.flags.Bool("passkeys", false, "include protocol passkeys")
+	if _, err := o.parse(args, 0); err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = manifest.FormatFor(*file)
+	}
+
+	data, err := o.client("").ExportManifest(context.Background(), *passkeys)
+	if err != nil {
+		return err
+	}
+	var m api.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	out, err := manifest.Encode(&m, *format)
+	if err != nil {
+		return err
+	}
+
+	if *file == "" {
+		_, err = o.stdout.Write(out)
+		return err
+	}
+	mode := os.FileMode(0644)
+	if *passkeys {
+		mode = 0600
+	}
+	return os.WriteFile(*file, out, mode)
+}
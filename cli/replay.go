@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"freeport/client"
+)
+
+func runReplay(o *options, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "start":
+		return runReplayStart(o, args[1:])
+	case "list":
+		return runReplayList(o, args[1:])
+	case "stop":
+		return runReplayStop(o, args[1:])
+	}
+	return errUsage
+}
+
+// timeFlag takes an RFC 3339 time, or a duration meaning that long ago.
+type timeFlag struct {
+	t time.Time
+}
+
+func (f *timeFlag) String() string {
+	if f.t.IsZero() {
+		return ""
+	}
+	return f.t.Format(time.RFC3339)
+}
+
+func (f *timeFlag) Set(value string) error {
+	if d, err := time.ParseDuration(value); err == nil {
+		f.t = time.Now().Add(-d)
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("want an RFC 3339 time or a duration such as 10m")
+	}
+	f.t = t
+	return nil
+}
+
+func runReplayStart(o *options, args []string) error {
+	var since, until timeFlag
+	from := o.flags.String("from", "", "method whose history is replayed; defaults to the target")
+	speed := o.flags.Float64("speed", 1, "speed multiplier for the original timing")
+	loop := o.flags.Bool("loop", false, "start over after the last entry until stopped")
+	o.flags.Var(&since, "since", "first entry time, as RFC 3339 or a duration ago")
+	o.flags.Var(&until, "until", "last entry time, as RFC 3339 or a duration ago")
+	positional, err := o.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	r, err := o.client(positional[0]).StartReplay(context.Background(), positional[1], client.ReplayOptions{
+		From:  *from,
+		Since: since.t,
+		Until: until.t,
+		Speed: *speed,
+		Loop:  *loop,
+	})
+	if err != nil {
+		return err
+	}
+	return o.print(r, nil, [][]string{
+		{"Replay", r.ID},
+		{"Into", r.AppName + "/" + r.Method},
+		{"From", r.From},
+		{"Entries", strconv.Itoa(r.Entries)},
+		{"Speed", strconv.FormatFloat(r.Speed, 'g', -1, 64) + "x"},
+		{"Loop", strconv.FormatBool(r.Loop)},
+	})
+}
+
+func runReplayList(o *options, args []string) error {
+	positional, err := o.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	replays, err := o.client(positional[0]).Replays(context.Background(), positional[1])
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(replays))
+	for _, r := range replays {
+		state := r.State
+		if r.Error != "" {
+			state += ": " + r.Error
+		}
+		rows = append(rows, []string{
+			r.ID,
+			r.From,
+			fmt.Sprintf("%d/%d", r.Sent, r.Entries),
+			strconv.Itoa(r.Loops),
+			strconv.FormatFloat(r.Speed, 'g', -1, 64) + "x",
+			r.Started.Format(time.RFC3339),
+			state,
+		})
+	}
+	return o.print(replays, []string{"ID", "FROM", "SENT", "LOOPS", "SPEED", "STARTED", "STATE"}, rows)
+}
+
+func runReplayStop(o *options, args []string) error {
+	positional, err := o.parse(args, 3)
+	if err != nil {
+		return err
+	}
+
+	if err := o.client(positional[0]).StopReplay(context.Background(), positional[1], positional[2]); err != nil {
+		return err
+	}
+	return o.print(map[string]string{"id": positional[2], "status": "stopped"}, nil, [][]string{
+		{"Stopped", positional[2]},
+	})
+}
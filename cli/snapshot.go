@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+func runSnapshot(o *options, args []string) error {
+	file := o.flags.String("f", "", "archive to write; defaults to freeport-<time>.json.gz")
+	if _, err := o.parse(args, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		*file = "freeport-" + time.Now().Format("20060102-150405") + ".json.gz"
+	}
+
+	archive, err := o.client("").Snapshot(context.Background())
+	if err != nil {
+		return err
+	}
+	// The archive holds passkeys, so keep it private.
+	if err := os.WriteFile(*file, archive, 0600); err != nil {
+		return err
+	}
+	return o.print(map[string]interface{}{"file": *file, "bytes": len(archive)}, nil, [][]string{
+		{"Wrote", *file},
+		{"Size", fmt.Sprintf("%d bytes", len(archive))},
+	})
+}
+
+func runRestore(o *options, args []string) error {
+	file := o.flags.String("f", "", "archive written by freeport snapshot")
+	mode := o.flags.String("mode", "merge", "merge keeps existing data; replace discards it first")
+	if _, err := o.parse(args, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errUsage
+	}
+	if *mode != "merge" && *mode != "replace" {
+		return fmt.Errorf("unknown mode %q; use merge or replace", *mode)
+	}
+
+	archive, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	result, err := o.client("").Restore(context.Background(), archive, *mode)
+	if err != nil {
+		return err
+	}
+	return o.print(result, nil, [][]string{
+		{"Mode", result.Mode},
+		{"New protocols", fmt.Sprintf("%d", result.Protocols)},
+		{"Methods", fmt.Sprintf("%d", result.Methods)},
+		{"Entries", fmt.Sprintf("%d", result.Entries)},
+	})
+}
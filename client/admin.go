@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+type Method struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type Protocol struct {
+	AppName     string   `json:"app_name"`
+	Description string   `json:"description"`
+	Methods     []Method `json:"methods"`
+}
+
+// SetAdminToken sets the token sent with /system calls. The bus prints it in
+// the Settings screen and stores it in the config file.
+func (c *Client) SetAdminToken(token string) {
+	c.adminToken = token
+}
+
+func (c *Client) ListProtocols(ctx context.Context) ([]Protocol, error) {
+	var result struct {
+		Protocols []Protocol `json:"protocols"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/system/protocols", nil, "", &result); err != nil {
+		return nil, err
+	}
+	return result.Protocols, nil
+}
+
+func (c *Client) CreateProtocol(ctx context.Context, appName, passkey, description string, methods []Method) (*Protocol, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"app_name":    appName,
+		"passkey":     passkey,
+		"description": description,
+		"methods":     methods,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var protocol Protocol
+	if err := c.do(ctx, http.MethodPost, "/v1/system/protocols", body, "application/json", &protocol); err != nil {
+		return nil, err
+	}
+	return &protocol, nil
+}
+
+func (c *Client) DeleteProtocol(ctx context.Context, appName string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/system/protocols/"+url.PathEscape(appName), nil, "", nil)
+}
+
+// Change is one step the bus took, or would take, to apply a manifest.
+type Change struct {
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ApplyManifest asks the bus to reconcile its protocols with manifest, a
+// JSON-encoded manifest. With prune, protocols and methods it does not list
+// are deleted; with dryRun nothing is changed and the plan is returned.
+func (c *Client) ApplyManifest(ctx context.Context, manifest []byte, prune, dryRun bool) ([]Change, error) {
+	query := url.Values{}
+	if prune {
+		query.Set("prune", "true")
+	}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+	path := "/v1/system/manifest"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var result struct {
+		Changes []Change `json:"changes"`
+	}
+	if err := c.do(ctx, http.MethodPut, path, manifest, "application/json", &result); err != nil {
+		return nil, err
+	}
+	return result.Changes, nil
+}
+
+// ExportManifest returns the bus's protocols as a JSON-encoded manifest.
+// Passkeys are left out unless includePasskeys is set.
+func (c *Client) ExportManifest(ctx context.Context, includePasskeys bool) (json.RawMessage, error) {
+	path := "/v1/system/manifest"
+	if includePasskeys {
+		path += "?passkeys=true"
+	}
+
+	var result struct {
+		Manifest json.RawMessage `json:"manifest"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, "", &result); err != nil {
+		return nil, err
+	}
+	return result.Manifest, nil
+}
+
+type RestoreResult struct {
+	Mode      string `json:"mode"`
+	Protocols int    `json:"protocols"`
+	Methods   int    `json:"methods"`
+	Entries   int    `json:"entries"`
+}
+
+// Snapshot downloads everything the bus stores as a gzip-compressed archive.
+func (c *Client) Snapshot(ctx context.Context) ([]byte, error) {
+	var raw Raw
+	if err := c.do(ctx, http.MethodGet, "/v1/system/snapshot", nil, "", &raw); err != nil {
+		return nil, err
+	}
+	return raw.Body, nil
+}
+
+// Restore loads an archive from Snapshot. mode is "merge", which keeps what
+// the bus already has, or "replace", which discards it first.
+func (c *Client) Restore(ctx context.Context, archive []byte, mode string) (*RestoreResult, error) {
+	var result RestoreResult
+	path := "/v1/system/snapshot?mode=" + url.QueryEscape(mode)
+	if err := c.do(ctx, http.MethodPost, path, archive, "application/gzip", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
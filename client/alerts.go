@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type AlertRule struct {
+	Name      string      `json:"name"`
+	Source    string      `json:"source"`
+	Condition string      `json:"condition"`
+	For       string      `json:"for"`
+	Stale     string      `json:"stale"`
+	State     string      `json:"state"`
+	Since     *time.Time  `json:"since"`
+	Value     interface{} `json:"value"`
+	LastError string      `json:"last_error"`
+}
+
+// Alert is a rule starting ("firing") or stopping ("resolved") to fire.
+type Alert struct {
+	ID      int64       `json:"id"`
+	Rule    string      `json:"rule"`
+	Source  string      `json:"source"`
+	State   string      `json:"state"`
+	Message string      `json:"message"`
+	Value   interface{} `json:"value"`
+	Time    time.Time   `json:"time"`
+}
+
+type Alerts struct {
+	Firing int         `json:"firing"`
+	Rules  []AlertRule `json:"rules"`
+	Alerts []Alert     `json:"alerts"`
+}
+
+// Alerts reads the alert rules and past alerts, newest first, with the
+// admin token. A non-empty state keeps only the alerts in that state.
+func (c *Client) Alerts(ctx context.Context, state string) (*Alerts, error) {
+	path := "/v1/alerts"
+	if state != "" {
+		path += "?state=" + url.QueryEscape(state)
+	}
+	var result Alerts
+	if err := c.do(ctx, http.MethodGet, path, nil, "", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,484 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "http://localhost:6767"
+	DefaultTimeout = 10 * time.Second
+)
+
+// Client talks to a freeport bus over HTTP. Protocol calls need credentials
+// set with SetCredentials; Battery works without them.
+type Client struct {
+	baseURL    string
+	appName    string
+	passkey    string
+	adminToken string
+	http       *http.Client
+	retries    int
+	retryWait  time.Duration
+	pollPeriod time.Duration
+}
+
+// Error is a failed request, decoded from the bus's error envelope.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+	Details    map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("freeport: %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("freeport: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+type envelope struct {
+	Status    string `json:"status"`
+	RequestID string `json:"request_id"`
+	Error     *struct {
+		Code    string                 `json:"code"`
+		Message string                 `json:"message"`
+		Details map[string]interface{} `json:"details"`
+	} `json:"error"`
+}
+
+type InitResult struct {
+	AppName string    `json:"app_name"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+type StoreResult struct {
+	AppName     string    `json:"app_name"`
+	Method      string    `json:"method"`
+	Key         string    `json:"key"`
+	Message     string    `json:"message"`
+	Timestamp   time.Time `json:"timestamp"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	Revision    string    `json:"revision"`
+	Expires     time.Time `json:"expires"`
+}
+
+// Value is the latest payload stored on a method. Data holds the JSON as the
+// bus returned it; blob payloads arrive as their metadata. Expires is zero
+// for a value without a TTL, and Stale is only ever set by GetStale.
+type Value struct {
+	AppName    string          `json:"app_name"`
+	Method     string          `json:"method"`
+	Key        string          `json:"key"`
+	Data       json.RawMessage `json:"data"`
+	Time       time.Time       `json:"time"`
+	Stored     time.Time       `json:"stored"`
+	Revision   string          `json:"revision"`
+	AgeSeconds int64           `json:"age_seconds"`
+	Expires    time.Time       `json:"expires"`
+	Stale      bool            `json:"stale"`
+}
+
+func (v *Value) Decode(target interface{}) error {
+	return json.Unmarshal(v.Data, target)
+}
+
+// Raw is a stored payload exactly as it was posted. Stored and Revision
+// are when it was posted and which write it was, where the bus said so.
+type Raw struct {
+	ContentType string
+	Body        []byte
+	Stored      time.Time
+	Revision    string
+}
+
+type Entry struct {
+	Offset    int64           `json:"offset"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp time.Time       `json:"timestamp"`
+	Source    string          `json:"source"`
+}
+
+func (e *Entry) Decode(target interface{}) error {
+	return json.Unmarshal(e.Data, target)
+}
+
+type Battery struct {
+	AppName string    `json:"app_name"`
+	Battery int       `json:"battery"`
+	Time    time.Time `json:"time"`
+}
+
+// New returns a client for the bus at baseURL. A "unix:///path/to/socket"
+// URL connects through the bus's Unix domain socket instead of TCP.
+func New(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	httpClient := &http.Client{Timeout: DefaultTimeout}
+
+	if socket, ok := strings.CutPrefix(baseURL, "unix://"); ok {
+		httpClient.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+		baseURL = "http://unix"
+	}
+
+	return &Client{
+		baseURL:    baseURL,
+		http:       httpClient,
+		retryWait:  200 * time.Millisecond,
+		pollPeriod: time.Second,
+	}
+}
+
+// NewHandler returns a client that calls handler directly instead of
+// going over the network, for code running in the same process as the bus.
+func NewHandler(handler http.Handler) *Client {
+	c := New("http://in-process")
+	c.http.Transport = handlerTransport{handler: handler}
+	return c
+}
+
+// WithCredentials returns a copy of c that calls the bus as appName. The
+// copy shares c's connections, so it is cheap to make one per protocol.
+func (c *Client) WithCredentials(appName, passkey string) *Client {
+	copied := *c
+	copied.SetCredentials(appName, passkey)
+	return &copied
+}
+
+func (c *Client) SetCredentials(appName, passkey string) {
+	c.appName = appName
+	c.passkey = passkey
+}
+
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.http.Timeout = timeout
+}
+
+// SetRetries makes the client retry a request that failed with a network
+// error, 429 or 5xx up to retries more times, waiting wait, then twice as
+// long, between attempts. A Retry-After header overrides the wait.
+func (c *Client) SetRetries(retries int, wait time.Duration) {
+	c.retries = retries
+	c.retryWait = wait
+}
+
+func (c *Client) SetPollInterval(interval time.Duration) {
+	c.pollPeriod = interval
+}
+
+func (c *Client) Init(ctx context.Context) (*InitResult, error) {
+	var result InitResult
+	if err := c.do(ctx, http.MethodGet, c.path("init"), nil, "", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Get returns the latest value stored on method.
+func (c *Client) Get(ctx context.Context, method string) (*Value, error) {
+	var value Value
+	if err := c.do(ctx, http.MethodGet, c.path(method)+"?format=json", nil, "", &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// GetStale is Get, except that a value past its TTL is still returned,
+// with Stale set, until the bus reaps it.
+func (c *Client) GetStale(ctx context.Context, method string) (*Value, error) {
+	var value Value
+	if err := c.do(ctx, http.MethodGet, c.path(method)+"?format=json&stale=true", nil, "", &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// GetRaw returns the latest payload on method byte for byte: the original
+// JSON text, or the blob with its content type.
+func (c *Client) GetRaw(ctx context.Context, method string) (*Raw, error) {
+	var raw Raw
+	if err := c.do(ctx, http.MethodGet, c.path(method)+"?format=raw", nil, "", &raw); err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+// Post stores payload on method, encoded as JSON.
+func (c *Client) Post(ctx context.Context, method string, payload interface{}) (*StoreResult, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.PostRaw(ctx, method, "application/json", body)
+}
+
+// PostRaw stores body on method as-is. Anything other than JSON is kept by
+// the bus as a blob.
+func (c *Client) PostRaw(ctx context.Context, method, contentType string, body []byte) (*StoreResult, error) {
+	return c.PostRawTTL(ctx, method, contentType, body, 0)
+}
+
+// PostTTL is Post for a value that expires after ttl instead of the
+// method's own TTL.
+func (c *Client) PostTTL(ctx context.Context, method string, payload interface{}, ttl time.Duration) (*StoreResult, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.PostRawTTL(ctx, method, "application/json", body, ttl)
+}
+
+// PostRawTTL is PostRaw for a value that expires after ttl. A ttl of 0
+// keeps the method's own TTL.
+func (c *Client) PostRawTTL(ctx context.Context, method, contentType string, body []byte, ttl time.Duration) (*StoreResult, error) {
+	return c.PostRawIf(ctx, method, contentType, body, ttl, Precondition{})
+}
+
+// Precondition makes a post conditional on the revision of the method's
+// current value. IfMatch stores only over that revision, or over any value
+// for "*"; IfNoneMatch "*" stores only when there is no current value. A
+// post whose condition fails returns an error for which
+// IsPreconditionFailed is true.
+type Precondition struct {
+	IfMatch     string
+	IfNoneMatch string
+}
+
+// PostIf stores payload only if the method's current value is still at
+// revision, as returned by Get or an earlier post. It is the
+// compare-and-swap step of a read-modify-write loop.
+func (c *Client) PostIf(ctx context.Context, method string, payload interface{}, revision string) (*StoreResult, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.PostRawIf(ctx, method, "application/json", body, 0, Precondition{IfMatch: revision})
+}
+
+// PostRawIf is PostRawTTL with a precondition.
+func (c *Client) PostRawIf(ctx context.Context, method, contentType string, body []byte, ttl time.Duration, cond Precondition) (*StoreResult, error) {
+	path := c.path(method)
+	if ttl > 0 {
+		path += "?ttl=" + url.QueryEscape(ttl.String())
+	}
+	var result StoreResult
+	if err := c.doHeader(ctx, http.MethodPost, path, body, cond.header(contentType), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) Delete(ctx context.Context, method string) error {
+	return c.do(ctx, http.MethodDelete, c.path(method), nil, "", nil)
+}
+
+func (c *Client) History(ctx context.Context, method string) ([]Entry, error) {
+	var result struct {
+		History []Entry `json:"history"`
+	}
+	if err := c.do(ctx, http.MethodGet, c.path(method, "history"), nil, "", &result); err != nil {
+		return nil, err
+	}
+	return result.History, nil
+}
+
+func (c *Client) Battery(ctx context.Context) (*Battery, error) {
+	var battery Battery
+	if err := c.do(ctx, http.MethodGet, "/v1/system/battery", nil, "", &battery); err != nil {
+		return nil, err
+	}
+	return &battery, nil
+}
+
+func (c *Client) path(segments ...string) string {
+	path := "/v1/" + url.PathEscape(c.appName)
+	for _, segment := range segments {
+		path += "/" + url.PathEscape(segment)
+	}
+	return path
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body []byte, contentType string, out interface{}) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return c.doHeader(ctx, method, path, body, header, out)
+}
+
+func (c *Client) doHeader(ctx context.Context, method, path string, body []byte, header http.Header, out interface{}) error {
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := c.attempt(ctx, method, path, body, header, out)
+		if err == nil || attempt >= c.retries || ctx.Err() != nil || !retryable(method, err) {
+			return err
+		}
+
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte, header http.Header, out interface{}) (time.Duration, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if c.appName != "" {
+		req.Header.Set("X-App-Name", c.appName)
+		req.Header.Set("X-Passkey", c.passkey)
+	}
+	if c.adminToken != "" {
+		req.Header.Set("X-Admin-Token", c.adminToken)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode >= 300 {
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(seconds) * time.Second, decodeError(resp, data)
+	}
+
+	switch out := out.(type) {
+	case nil:
+		return 0, nil
+	case *Raw:
+		out.ContentType = resp.Header.Get("Content-Type")
+		out.Body = data
+		out.Stored, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+		out.Revision = strings.Trim(resp.Header.Get("ETag"), `"`)
+		return 0, nil
+	}
+	return 0, json.Unmarshal(data, out)
+}
+
+func decodeError(resp *http.Response, data []byte) error {
+	apiErr := &Error{
+		StatusCode: resp.StatusCode,
+		Message:    http.StatusText(resp.StatusCode),
+		RequestID:  resp.Header.Get("X-Request-ID"),
+	}
+
+	var env envelope
+	if json.Unmarshal(data, &env) == nil && env.Error != nil {
+		apiErr.Code = env.Error.Code
+		apiErr.Message = env.Error.Message
+		apiErr.Details = env.Error.Details
+		if env.RequestID != "" {
+			apiErr.RequestID = env.RequestID
+		}
+	}
+	return apiErr
+}
+
+// retryable reports whether a failed request is worth sending again. A POST
+// that never got a response may already have been stored, so only an
+// explicit rejection from the bus is retried for it.
+func retryable(method string, err error) bool {
+	apiErr, ok := err.(*Error)
+	if !ok {
+		return method != http.MethodPost
+	}
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout, http.StatusInternalServerError:
+		return method != http.MethodPost
+	}
+	return false
+}
+
+// IsNotFound reports whether err means there is nothing stored yet, or the
+// method does not exist.
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+func isConflict(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusConflict
+}
+
+// IsPreconditionFailed reports whether err means a conditional post found
+// a different value than it expected.
+func IsPreconditionFailed(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusPreconditionFailed
+}
+
+// header is the request header of a write of contentType under p.
+func (p Precondition) header(contentType string) http.Header {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if p.IfMatch != "" {
+		header.Set("If-Match", quoteETag(p.IfMatch))
+	}
+	if p.IfNoneMatch != "" {
+		header.Set("If-None-Match", quoteETag(p.IfNoneMatch))
+	}
+	return header
+}
+
+func quoteETag(revision string) string {
+	if revision == "*" {
+		return revision
+	}
+	return `"` + revision + `"`
+}
+
+// IsExpired reports whether err means the latest value on a method has
+// passed its TTL. IsNotFound is true for such errors too.
+func IsExpired(err error) bool {
+	apiErr, ok := err.(*Error)
+	if !ok || apiErr.StatusCode != http.StatusNotFound {
+		return false
+	}
+	_, expired := apiErr.Details["expired_at"]
+	return expired
+}
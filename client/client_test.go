@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"freeport/api"
+)
+
+// flaky fails the first failures requests with status, then answers 200.
+func flaky(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestRetryBacksOff(t *testing.T) {
+	server, calls := flaky(t, 2, http.StatusServiceUnavailable)
+	c := New(server.URL)
+	c.SetRetries(2, 20*time.Millisecond)
+
+	start := time.Now()
+	if err := c.Delete(context.Background(), "m"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+	// 20ms, then twice that.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("retried after %v, want at least 60ms of backoff", elapsed)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	server, calls := flaky(t, 10, http.StatusTooManyRequests)
+	c := New(server.URL)
+	c.SetRetries(1, time.Millisecond)
+
+	err := c.Delete(context.Background(), "m")
+	if apiErr, ok := err.(*Error); !ok || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("error = %v, want a 429", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d attempts, want 2", n)
+	}
+}
+
+func TestRetrySkipsUnsafePosts(t *testing.T) {
+	tests := []struct {
+		status int
+		want   int32
+	}{
+		{http.StatusBadGateway, 1},
+		{http.StatusServiceUnavailable, 2},
+		{http.StatusBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server, calls := flaky(t, 1, tt.status)
+			c := New(server.URL)
+			c.SetRetries(3, time.Millisecond)
+			c.Post(context.Background(), "m", 1)
+			if n := calls.Load(); n != tt.want {
+				t.Errorf("%d attempts, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bus.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Battery{AppName: "freeport", Battery: 42})
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	battery, err := New("unix://"+path).Battery(context.Background())
+	if err != nil {
+		t.Fatalf("Battery: %v", err)
+	}
+	if battery.Battery != 42 {
+		t.Errorf("battery = %d, want 42", battery.Battery)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Error
+	}{
+		{
+			"envelope",
+			`{"status":"error","request_id":"body-id","error":{"code":"method_not_found","message":"Method not found","details":{"method":"m"}}}`,
+			Error{StatusCode: 404, Code: "method_not_found", Message: "Method not found", RequestID: "body-id", Details: map[string]interface{}{"method": "m"}},
+		},
+		{
+			"envelope without a request ID",
+			`{"status":"error","error":{"code":"no_data","message":"No data"}}`,
+			Error{StatusCode: 404, Code: "no_data", Message: "No data", RequestID: "header-id"},
+		},
+		{
+			"plain text",
+			"404 page not found",
+			Error{StatusCode: 404, Message: "Not Found", RequestID: "header-id"},
+		},
+		{
+			"JSON without an error",
+			`{"status":"success"}`,
+			Error{StatusCode: 404, Message: "Not Found", RequestID: "header-id"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: 404, Header: http.Header{"X-Request-Id": {"header-id"}}}
+			err := decodeError(resp, []byte(tt.body)).(*Error)
+			if err.StatusCode != tt.want.StatusCode || err.Code != tt.want.Code || err.Message != tt.want.Message ||
+				err.RequestID != tt.want.RequestID || len(err.Details) != len(tt.want.Details) {
+				t.Errorf("got %+v, want %+v", *err, tt.want)
+			}
+			if !IsNotFound(err) {
+				t.Error("IsNotFound = false")
+			}
+		})
+	}
+}
+
+func TestInProcess(t *testing.T) {
+	registry := api.NewRegistry()
+	registry.RegisterProtocol("app", "secret", "")
+	registry.RegisterMethod("app", "m", "")
+	server := api.NewServer("0")
+	server.SetRegistry(registry)
+
+	c := NewHandler(server.InProcessHandler()).WithCredentials("app", "")
+	if _, err := c.Post(context.Background(), "m", 7); err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	value, err := c.Get(context.Background(), "m")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(value.Data) != "7" {
+		t.Errorf("value = %s, want 7", value.Data)
+	}
+	if entries := registry.RecentAccessLog(10); len(entries) != 0 {
+		t.Errorf("access log = %+v, want in-process calls left out", entries)
+	}
+
+	if _, err := NewHandler(server.Handler()).WithCredentials("app", "").Get(context.Background(), "m"); err == nil {
+		t.Error("Get through the public handler worked without a passkey")
+	}
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Derived is a method whose value the bus computes from other methods.
+type Derived struct {
+	AppName     string            `json:"app_name"`
+	Method      string            `json:"method"`
+	Sources     map[string]string `json:"sources"`
+	Expr        string            `json:"expr"`
+	Evaluations int64             `json:"evaluations"`
+	Failures    int64             `json:"failures"`
+	LastError   string            `json:"last_error"`
+	Updated     *time.Time        `json:"updated"`
+}
+
+// Derived lists every derived method on the bus with the admin token.
+func (c *Client) Derived(ctx context.Context) ([]Derived, error) {
+	var result struct {
+		Derived []Derived `json:"derived"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/system/derived", nil, "", &result); err != nil {
+		return nil, err
+	}
+	return result.Derived, nil
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// KeyInfo is one key of a method, as listed by Keys.
+type KeyInfo struct {
+	Key      string     `json:"key"`
+	Revision string     `json:"revision"`
+	Stored   time.Time  `json:"stored"`
+	Expires  *time.Time `json:"expires"`
+	Entries  int        `json:"entries"`
+}
+
+// KeyPage is one page of a key listing. Next is the After to ask for the
+// following page, or empty on the last one.
+type KeyPage struct {
+	Keys []KeyInfo `json:"keys"`
+	Next string    `json:"next"`
+}
+
+// KeyQuery selects the keys Keys lists: those starting with Prefix, in
+// order, after the key After, at most Limit of them. A Limit of 0 leaves
+// the page size to the bus.
+type KeyQuery struct {
+	Prefix string
+	After  string
+	Limit  int
+}
+
+// Keys lists one page of the keys stored under method.
+func (c *Client) Keys(ctx context.Context, method string, q KeyQuery) (*KeyPage, error) {
+	query := url.Values{}
+	if q.Prefix != "" {
+		query.Set("prefix", q.Prefix)
+	}
+	if q.After != "" {
+		query.Set("after", q.After)
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	path := c.path(method, "keys")
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var page KeyPage
+	if err := c.do(ctx, http.MethodGet, path, nil, "", &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetKey returns the value stored under key on method.
+func (c *Client) GetKey(ctx context.Context, method, key string) (*Value, error) {
+	var value Value
+	if err := c.do(ctx, http.MethodGet, c.path(method, "keys", key)+"?format=json", nil, "", &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// GetKeyRaw returns the payload under key on method byte for byte.
+func (c *Client) GetKeyRaw(ctx context.Context, method, key string) (*Raw, error) {
+	var raw Raw
+	if err := c.do(ctx, http.MethodGet, c.path(method, "keys", key)+"?format=raw", nil, "", &raw); err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+// PutKey stores payload under key on method, encoded as JSON.
+func (c *Client) PutKey(ctx context.Context, method, key string, payload interface{}) (*StoreResult, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.PutKeyRaw(ctx, method, key, "application/json", body, 0, Precondition{})
+}
+
+// PutKeyRaw stores body under key on method as-is, with an optional TTL
+// and precondition on the key's current value.
+func (c *Client) PutKeyRaw(ctx context.Context, method, key, contentType string, body []byte, ttl time.Duration, cond Precondition) (*StoreResult, error) {
+	path := c.path(method, "keys", key)
+	if ttl > 0 {
+		path += "?ttl=" + url.QueryEscape(ttl.String())
+	}
+	var result StoreResult
+	if err := c.doHeader(ctx, http.MethodPut, path, body, cond.header(contentType), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteKey removes key and its history from method. A non-empty revision
+// makes the delete conditional on the key still being at it.
+func (c *Client) DeleteKey(ctx context.Context, method, key, revision string) error {
+	return c.doHeader(ctx, http.MethodDelete, c.path(method, "keys", key), nil, Precondition{IfMatch: revision}.header(""), nil)
+}
+
+// KeyHistory returns the most recent values stored under key.
+func (c *Client) KeyHistory(ctx context.Context, method, key string) ([]Entry, error) {
+	var result struct {
+		History []Entry `json:"history"`
+	}
+	if err := c.do(ctx, http.MethodGet, c.path(method, "keys", key, "history"), nil, "", &result); err != nil {
+		return nil, err
+	}
+	return result.History, nil
+}
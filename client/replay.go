@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ReplayOptions choose what a replay re-emits. From is the method whose
+// history is read, the target itself if empty. Zero Since and Until leave
+// the range open. Speed scales the original timing; 0 means real time.
+type ReplayOptions struct {
+	From  string
+	Since time.Time
+	Until time.Time
+	Speed float64
+	Loop  bool
+}
+
+type Replay struct {
+	ID      string    `json:"id"`
+	AppName string    `json:"app_name"`
+	Method  string    `json:"method"`
+	From    string    `json:"from"`
+	Speed   float64   `json:"speed"`
+	Loop    bool      `json:"loop"`
+	State   string    `json:"state"`
+	Entries int       `json:"entries"`
+	Sent    int64     `json:"sent"`
+	Loops   int       `json:"loops"`
+	Started time.Time `json:"started"`
+	Error   string    `json:"error"`
+}
+
+// StartReplay re-emits recorded history into method at its original pace.
+// Replayed entries carry a "replay:" prefix on their source.
+func (c *Client) StartReplay(ctx context.Context, method string, options ReplayOptions) (*Replay, error) {
+	request := map[string]interface{}{"loop": options.Loop}
+	if options.From != "" {
+		request["from"] = options.From
+	}
+	if !options.Since.IsZero() {
+		request["since"] = options.Since
+	}
+	if !options.Until.IsZero() {
+		request["until"] = options.Until
+	}
+	if options.Speed != 0 {
+		request["speed"] = options.Speed
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Replay Replay `json:"replay"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.path(method, "replay"), body, "application/json", &result); err != nil {
+		return nil, err
+	}
+	return &result.Replay, nil
+}
+
+// Replays lists the running and recently ended replays into method.
+func (c *Client) Replays(ctx context.Context, method string) ([]Replay, error) {
+	var result struct {
+		Replays []Replay `json:"replays"`
+	}
+	if err := c.do(ctx, http.MethodGet, c.path(method, "replay"), nil, "", &result); err != nil {
+		return nil, err
+	}
+	return result.Replays, nil
+}
+
+func (c *Client) StopReplay(ctx context.Context, method, id string) error {
+	query := url.Values{"id": {id}}
+	return c.do(ctx, http.MethodDelete, c.path(method, "replay")+"?"+query.Encode(), nil, "", nil)
+}
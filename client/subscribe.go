@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Batch is what a consumer group read returns. Skipped counts the entries
+// that were trimmed from history before the group got to them.
+type Batch struct {
+	Entries []Entry `json:"entries"`
+	Skipped int64   `json:"skipped"`
+	Latest  int64   `json:"latest"`
+}
+
+// CreateGroup starts a consumer group on method, at the beginning of the
+// stream or, with fromLatest, after everything stored so far. It fails
+// with a 409 if the group already exists.
+func (c *Client) CreateGroup(ctx context.Context, method, group string, fromLatest bool) error {
+	start := "earliest"
+	if fromLatest {
+		start = "latest"
+	}
+	body, err := json.Marshal(map[string]string{"group": group, "start": start})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, c.path(method, "groups"), body, "application/json", nil)
+}
+
+// Next reads up to max entries after the consumer group's committed offset
+// without committing them.
+func (c *Client) Next(ctx context.Context, method, group string, max int) (*Batch, error) {
+	query := url.Values{"group": {group}}
+	if max > 0 {
+		query.Set("max", strconv.Itoa(max))
+	}
+
+	var batch Batch
+	if err := c.do(ctx, http.MethodGet, c.path(method, "next")+"?"+query.Encode(), nil, "", &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// After reads up to max entries stored on method after offset, without a
+// consumer group.
+func (c *Client) After(ctx context.Context, method string, offset int64, max int) (*Batch, error) {
+	query := url.Values{"after": {strconv.FormatInt(offset, 10)}}
+	if max > 0 {
+		query.Set("max", strconv.Itoa(max))
+	}
+
+	var batch Batch
+	if err := c.do(ctx, http.MethodGet, c.path(method, "next")+"?"+query.Encode(), nil, "", &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func (c *Client) Commit(ctx context.Context, method, group string, offset int64) error {
+	query := url.Values{
+		"group":  {group},
+		"offset": {strconv.FormatInt(offset, 10)},
+	}
+	return c.do(ctx, http.MethodPost, c.path(method, "commit")+"?"+query.Encode(), nil, "", nil)
+}
+
+// Subscribe delivers every entry stored on method to fn, in order, as a
+// member of the consumer group, creating the group if it is new. Each
+// entry is committed once fn returns nil, so a subscriber that stops and
+// restarts picks up where it left off. Entries trimmed from history before
+// the group read them are counted to gap, if it is not nil, ahead of the
+// entries that follow them. It polls until ctx is cancelled or fn returns
+// an error.
+func (c *Client) Subscribe(ctx context.Context, method, group string, fn func(Entry) error, gap func(skipped int64)) error {
+	if err := c.CreateGroup(ctx, method, group, false); err != nil && !isConflict(err) {
+		return err
+	}
+
+	for {
+		batch, err := c.Next(ctx, method, group, 0)
+		if err != nil {
+			return err
+		}
+		if batch.Skipped > 0 && gap != nil {
+			gap(batch.Skipped)
+		}
+
+		for _, entry := range batch.Entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+			if err := c.Commit(ctx, method, group, entry.Offset); err != nil {
+				return err
+			}
+		}
+
+		if len(batch.Entries) > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.pollPeriod):
+		}
+	}
+}
+
+// Tail delivers the entries stored on method from now on to fn, in order.
+// It keeps its position itself rather than in a consumer group, so it
+// leaves nothing behind on the bus and tails run side by side each see
+// every entry. Entries trimmed before Tail read them are counted to gap as
+// in Subscribe. It polls until ctx is cancelled or fn returns an error.
+func (c *Client) Tail(ctx context.Context, method string, fn func(Entry) error, gap func(skipped int64)) error {
+	start, err := c.After(ctx, method, 0, 1)
+	if err != nil {
+		return err
+	}
+	offset := start.Latest
+
+	for {
+		batch, err := c.After(ctx, method, offset, 0)
+		if err != nil {
+			return err
+		}
+		if batch.Skipped > 0 && gap != nil {
+			gap(batch.Skipped)
+		}
+
+		for _, entry := range batch.Entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+			offset = entry.Offset
+		}
+
+		if len(batch.Entries) > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.pollPeriod):
+		}
+	}
+}
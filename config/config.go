@@ -8,6 +8,81 @@ import (
 
 type Config struct {
 	WelcomeMessage string `json:"welcome_message"`
+	AdminToken string `json:"admin_token"`
+	Server ServerConfig `json:"server"`
+	ProtocolLimits map[string]LimitsConfig `json:"protocol_limits,omitempty"`
+	Logging LoggingConfig `json:"logging"`
+	Discovery DiscoveryConfig `json:"discovery"`
+	Federation FederationConfig `json:"federation"`
+	Alerts AlertsConfig `json:"alerts"`
+}
+
+// AlertsConfig lists the alert rules checked every Interval. A rule's
+// Source is "app/method" or "system/battery", and For and Stale are
+// durations such as "5m".
+type AlertsConfig struct {
+	Interval string `json:"interval"`
+	Rules []AlertRuleConfig `json:"rules,omitempty"`
+}
+
+type AlertRuleConfig struct {
+	Name string `json:"name"`
+	Source string `json:"source"`
+	Condition string `json:"condition,omitempty"`
+	For string `json:"for,omitempty"`
+	Stale string `json:"stale,omitempty"`
+	Notify string `json:"notify,omitempty"`
+	Webhook string `json:"webhook,omitempty"`
+}
+
+type FederationConfig struct {
+	Node string `json:"node"`
+	Token string `json:"token"`
+	Links []LinkConfig `json:"links,omitempty"`
+}
+
+// LinkConfig mirrors protocols to another instance. Mirror entries are
+// "app" or "app/method"; Token is the peer's federation token.
+type LinkConfig struct {
+	Name string `json:"name"`
+	URL string `json:"url"`
+	Token string `json:"token"`
+	Mirror []string `json:"mirror"`
+}
+
+type DiscoveryConfig struct {
+	Advertise bool `json:"advertise"`
+	Browse bool `json:"browse"`
+	Address string `json:"address"`
+	Interval string `json:"interval"`
+}
+
+type LoggingConfig struct {
+	Dir string `json:"dir"`
+	MaxBytes int64 `json:"max_bytes"`
+	MaxBackups int `json:"max_backups"`
+}
+
+type ServerConfig struct {
+	ReadTimeout string `json:"read_timeout"`
+	WriteTimeout string `json:"write_timeout"`
+	IdleTimeout string `json:"idle_timeout"`
+	Limits LimitsConfig `json:"limits"`
+	Socket SocketConfig `json:"socket"`
+}
+
+type SocketConfig struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	DisableTCP bool `json:"disable_tcp"`
+	TrustedUIDs []int `json:"trusted_uids,omitempty"`
+}
+
+type LimitsConfig struct {
+	MaxPayloadBytes int64 `json:"max_payload_bytes"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst int `json:"burst"`
+	MaxKeys int `json:"max_keys,omitempty"`
 }
 
 func getConfigPath() string {
@@ -19,25 +94,118 @@ func getConfigPath() string {
 	return filepath.Join(home, ".freeport_config.json")
 }
 
+func getLogDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".freeport", "logs")
+	}
+
+	return filepath.Join(home, ".freeport", "logs")
+}
+
+// ManifestPath is where the TUI exports the protocol manifest.
+func ManifestPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".freeport", "manifest.yaml")
+	}
+
+	return filepath.Join(home, ".freeport", "manifest.yaml")
+}
+
+// SnapshotDir is where the TUI keeps snapshot archives.
+func SnapshotDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".freeport", "snapshots")
+	}
+
+	return filepath.Join(home, ".freeport", "snapshots")
+}
+
 func Load() *Config {
 	cfg := &Config{
 		WelcomeMessage: "Welcome to Freeport!",
+		Server: ServerConfig{
+			ReadTimeout: "30s",
+			WriteTimeout: "30s",
+			IdleTimeout: "2m",
+			Limits: LimitsConfig{
+				MaxPayloadBytes: 10 << 20,
+				RequestsPerSecond: 50,
+				Burst: 100,
+				MaxKeys: 10000,
+			},
+			Socket: SocketConfig{
+				Mode: "0600",
+			},
+		},
+		Logging: LoggingConfig{
+			Dir: getLogDir(),
+			MaxBytes: 5 << 20,
+			MaxBackups: 3,
+		},
+		Discovery: DiscoveryConfig{
+			Address: "224.0.0.251:5353",
+			Interval: "10s",
+		},
+		Alerts: AlertsConfig{
+			Interval: "5s",
+		},
 	}
 
-	data, err := os.ReadFile(getConfigPath())
+	path := getConfigPath()
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return cfg
 	}
 
+	// The file holds the admin and federation tokens; older versions wrote
+	// it readable by everyone.
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+		os.Chmod(path, 0600)
+	}
+
 	json.Unmarshal(data, cfg)
 	return cfg
 }
 
+// Save writes the config readable by its owner only, since it holds the
+// admin and federation tokens. It writes a temporary file and renames it
+// into place, so the file is never seen half written or with wider
+// permissions.
 func (c *Config) Save() error {
 	data, err := json.MarshalIndent(c, "", " ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(getConfigPath(), data, 0644)
-}
\ No newline at end of file
+	path := getConfigPath()
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".freeport_config-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// BusURL is the address local clients should use: the Unix socket when one
+// is configured, otherwise the TCP port.
+func (c *Config) BusURL() string {
+	if c.Server.Socket.Path != "" {
+		return "unix://" + c.Server.Socket.Path
+	}
+	return "http://localhost:6767"
+}
@@ -0,0 +1,210 @@
+package discovery
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultBrowseInterval = 10 * time.Second
+
+// Peer is a discovered instance and when it was last heard from.
+type Peer struct {
+	Instance
+	Self     bool
+	LastSeen time.Time
+	expires  time.Time
+}
+
+// URL is the address clients should use to reach the peer's bus.
+func (p Peer) URL() string {
+	host := strings.TrimSuffix(p.Host, ".")
+	if len(p.Addrs) > 0 {
+		host = p.Addrs[0].String()
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(p.Port))
+}
+
+// Browser periodically asks for freeport instances and keeps the answers
+// until their records expire.
+type Browser struct {
+	addr     string
+	interval time.Duration
+	self     string
+	conn     *net.UDPConn
+	dest     *net.UDPAddr
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	peers map[string]*Peer
+}
+
+func NewBrowser(addr string, interval time.Duration) *Browser {
+	if addr == "" {
+		addr = DefaultAddress
+	}
+	if interval <= 0 {
+		interval = DefaultBrowseInterval
+	}
+	return &Browser{
+		addr:     addr,
+		interval: interval,
+		done:     make(chan struct{}),
+		peers:    make(map[string]*Peer),
+	}
+}
+
+// SetSelf names this process's own instance so it can be told apart from
+// the others in Peers.
+func (b *Browser) SetSelf(name string) {
+	b.self = serviceName(name)
+}
+
+func (b *Browser) Start() error {
+	dest, err := net.ResolveUDPAddr("udp4", b.addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return err
+	}
+	b.conn = conn
+	b.dest = dest
+
+	b.wg.Add(2)
+	go b.read()
+	go b.query()
+	return nil
+}
+
+func (b *Browser) Close() {
+	if b.conn == nil {
+		return
+	}
+	close(b.done)
+	b.conn.Close()
+	b.wg.Wait()
+}
+
+// Refresh sends a query now instead of waiting for the next interval.
+func (b *Browser) Refresh() {
+	if b.conn == nil {
+		return
+	}
+	query := &message{questions: []question{
+		{name: ServiceType, qtype: typePTR, class: classIN | unicastResponse},
+	}}
+	if packet, err := query.pack(); err == nil {
+		b.conn.WriteToUDP(packet, b.dest)
+	}
+}
+
+func (b *Browser) Peers() []Peer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	peers := make([]Peer, 0, len(b.peers))
+	for name, peer := range b.peers {
+		if now.After(peer.expires) {
+			delete(b.peers, name)
+			continue
+		}
+		peers = append(peers, *peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Name < peers[j].Name
+	})
+	return peers
+}
+
+func (b *Browser) query() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	b.Refresh()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.Refresh()
+		}
+	}
+}
+
+func (b *Browser) read() {
+	defer b.wg.Done()
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := b.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if reply, err := unpack(buf[:n]); err == nil && reply.isResponse() {
+			b.record(reply, from)
+		}
+	}
+}
+
+func (b *Browser) record(reply *message, from *net.UDPAddr) {
+	srv := map[string]record{}
+	txt := map[string][]string{}
+	addrs := map[string][]net.IP{}
+	var instances []record
+
+	for _, rr := range append(reply.answers, reply.extra...) {
+		name := strings.ToLower(rr.name)
+		switch rr.rtype {
+		case typePTR:
+			if name == ServiceType {
+				instances = append(instances, rr)
+			}
+		case typeSRV:
+			srv[name] = rr
+		case typeTXT:
+			txt[name] = rr.txt
+		case typeA:
+			addrs[name] = append(addrs[name], rr.ip)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	for _, ptr := range instances {
+		key := strings.ToLower(ptr.ptr)
+		if ptr.ttl == 0 {
+			delete(b.peers, key)
+			continue
+		}
+		service, ok := srv[key]
+		if !ok {
+			continue
+		}
+
+		instance := Instance{
+			Name:  strings.TrimSuffix(ptr.ptr, "."+ServiceType),
+			Host:  service.target,
+			Port:  int(service.port),
+			Addrs: addrs[strings.ToLower(service.target)],
+		}
+		if len(instance.Addrs) == 0 {
+			instance.Addrs = []net.IP{from.IP}
+		}
+		parseTXT(&instance, txt[key])
+
+		b.peers[key] = &Peer{
+			Instance: instance,
+			Self:     key == strings.ToLower(b.self),
+			LastSeen: now,
+			expires:  now.Add(time.Duration(ptr.ttl) * time.Second),
+		}
+	}
+}
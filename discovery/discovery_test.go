@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBrowseLoopback(t *testing.T) {
+	instance := Instance{
+		Name:      "test-9000",
+		Host:      "test.local.",
+		Port:      9000,
+		Addrs:     []net.IP{net.IPv4(127, 0, 0, 1).To4()},
+		Version:   "dev",
+		Protocols: []string{"weather"},
+	}
+	responder := NewResponder("127.0.0.1:0", func() Instance { return instance })
+	if err := responder.Start(); err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	defer responder.Close()
+
+	browser := NewBrowser(responder.conn.LocalAddr().String(), 50*time.Millisecond)
+	browser.SetSelf("other-1")
+	if err := browser.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer browser.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var peers []Peer
+	for time.Now().Before(deadline) {
+		if peers = browser.Peers(); len(peers) > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(peers) != 1 {
+		t.Fatalf("Peers() = %+v, want one peer", peers)
+	}
+
+	peer := peers[0]
+	if peer.Name != instance.Name || peer.Port != instance.Port || peer.Version != instance.Version {
+		t.Errorf("peer = %+v, want %+v", peer.Instance, instance)
+	}
+	if !reflect.DeepEqual(peer.Protocols, instance.Protocols) {
+		t.Errorf("protocols = %v, want %v", peer.Protocols, instance.Protocols)
+	}
+	if peer.Self {
+		t.Error("peer marked as self")
+	}
+	if got, want := peer.URL(), "http://127.0.0.1:9000"; got != want {
+		t.Errorf("URL() = %q, want %q", got, want)
+	}
+}
+
+func TestBrowserForgetsGoodbye(t *testing.T) {
+	browser := NewBrowser("127.0.0.1:1", time.Second)
+	from := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	records := instanceRecords(Instance{Name: "gone-1", Host: "gone.local.", Port: 1})
+
+	browser.record(&message{flags: flagResponse, answers: records}, from)
+	if len(browser.Peers()) != 1 {
+		t.Fatal("announced instance not recorded")
+	}
+
+	goodbye := records[0]
+	goodbye.ttl = 0
+	browser.record(&message{flags: flagResponse, answers: []record{goodbye}}, from)
+	if peers := browser.Peers(); len(peers) != 0 {
+		t.Errorf("Peers() = %+v after goodbye, want none", peers)
+	}
+}
+
+func TestResponderIgnoresOtherNames(t *testing.T) {
+	responder := NewResponder("", func() Instance {
+		return Instance{Name: "a-1", Host: "a.local.", Port: 1}
+	})
+	query := &message{questions: []question{{name: "_http._tcp.local.", qtype: typePTR, class: classIN}}}
+	if reply := responder.answer(query); reply != nil {
+		t.Errorf("answer = %+v, want nil", reply)
+	}
+
+	query.questions[0] = question{name: "A-1." + ServiceType, qtype: typeSRV, class: classIN}
+	reply := responder.answer(query)
+	if reply == nil || len(reply.answers) != 1 || reply.answers[0].port != 1 {
+		t.Errorf("SRV answer = %+v, want one record for port 1", reply)
+	}
+}
@@ -0,0 +1,265 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+const (
+	typeA   uint16 = 1
+	typePTR uint16 = 12
+	typeTXT uint16 = 16
+	typeSRV uint16 = 33
+	typeANY uint16 = 255
+
+	classIN uint16 = 1
+	// cacheFlush is the top bit of an mDNS record class; unicastResponse is
+	// the same bit on a question.
+	cacheFlush      uint16 = 1 << 15
+	unicastResponse uint16 = 1 << 15
+
+	flagResponse      uint16 = 1 << 15
+	flagAuthoritative uint16 = 1 << 10
+)
+
+var errMalformed = errors.New("discovery: malformed DNS message")
+
+type question struct {
+	name  string
+	qtype uint16
+	class uint16
+}
+
+type record struct {
+	name  string
+	rtype uint16
+	class uint16
+	ttl   uint32
+
+	ptr    string   // PTR
+	target string   // SRV
+	port   uint16   // SRV
+	txt    []string // TXT
+	ip     net.IP   // A
+}
+
+type message struct {
+	id        uint16
+	flags     uint16
+	questions []question
+	answers   []record
+	extra     []record
+}
+
+func (m *message) isResponse() bool {
+	return m.flags&flagResponse != 0
+}
+
+// pack encodes the message without name compression; freeport's records are
+// few and short enough that it is not worth the bookkeeping.
+func (m *message) pack() ([]byte, error) {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.id)
+	binary.BigEndian.PutUint16(b[2:], m.flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.answers)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.extra)))
+
+	var err error
+	for _, q := range m.questions {
+		if b, err = appendName(b, q.name); err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint16(b, q.qtype)
+		b = binary.BigEndian.AppendUint16(b, q.class)
+	}
+	for _, rr := range append(m.answers, m.extra...) {
+		if b, err = appendRecord(b, rr); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendName(b []byte, name string) ([]byte, error) {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		if len(label) > 63 {
+			return nil, errors.New("discovery: DNS label too long: " + label)
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0), nil
+}
+
+func appendRecord(b []byte, rr record) ([]byte, error) {
+	var err error
+	if b, err = appendName(b, rr.name); err != nil {
+		return nil, err
+	}
+	b = binary.BigEndian.AppendUint16(b, rr.rtype)
+	b = binary.BigEndian.AppendUint16(b, rr.class)
+	b = binary.BigEndian.AppendUint32(b, rr.ttl)
+
+	var rdata []byte
+	switch rr.rtype {
+	case typeA:
+		rdata = rr.ip.To4()
+	case typePTR:
+		rdata, err = appendName(nil, rr.ptr)
+	case typeSRV:
+		rdata = make([]byte, 6)
+		binary.BigEndian.PutUint16(rdata[4:], rr.port)
+		rdata, err = appendName(rdata, rr.target)
+	case typeTXT:
+		for _, s := range rr.txt {
+			if len(s) > 255 {
+				return nil, errors.New("discovery: TXT string too long")
+			}
+			rdata = append(rdata, byte(len(s)))
+			rdata = append(rdata, s...)
+		}
+		if len(rdata) == 0 {
+			rdata = []byte{0}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rdata)))
+	return append(b, rdata...), nil
+}
+
+func unpack(b []byte) (*message, error) {
+	if len(b) < 12 {
+		return nil, errMalformed
+	}
+	m := &message{
+		id:    binary.BigEndian.Uint16(b[0:]),
+		flags: binary.BigEndian.Uint16(b[2:]),
+	}
+	qd := int(binary.BigEndian.Uint16(b[4:]))
+	an := int(binary.BigEndian.Uint16(b[6:]))
+	ns := int(binary.BigEndian.Uint16(b[8:]))
+	ar := int(binary.BigEndian.Uint16(b[10:]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		name, next, err := readName(b, off)
+		if err != nil || next+4 > len(b) {
+			return nil, errMalformed
+		}
+		m.questions = append(m.questions, question{
+			name:  name,
+			qtype: binary.BigEndian.Uint16(b[next:]),
+			class: binary.BigEndian.Uint16(b[next+2:]),
+		})
+		off = next + 4
+	}
+
+	for i := 0; i < an+ns+ar; i++ {
+		rr, next, err := readRecord(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next
+		switch {
+		case i < an:
+			m.answers = append(m.answers, rr)
+		case i >= an+ns:
+			m.extra = append(m.extra, rr)
+		}
+	}
+	return m, nil
+}
+
+// readName decodes a possibly compressed name starting at off and returns
+// it with the offset just past it in the original position.
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return "", 0, errMalformed
+		}
+		length := int(b[off])
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case length&0xC0 == 0xC0:
+			if off+1 >= len(b) || jumps > 32 {
+				return "", 0, errMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3FFF)
+			jumps++
+		default:
+			if off+1+length > len(b) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(b[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+func readRecord(b []byte, off int) (record, int, error) {
+	name, off, err := readName(b, off)
+	if err != nil || off+10 > len(b) {
+		return record{}, 0, errMalformed
+	}
+	rr := record{
+		name:  name,
+		rtype: binary.BigEndian.Uint16(b[off:]),
+		class: binary.BigEndian.Uint16(b[off+2:]),
+		ttl:   binary.BigEndian.Uint32(b[off+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(b[off+8:]))
+	start := off + 10
+	end := start + length
+	if end > len(b) {
+		return record{}, 0, errMalformed
+	}
+
+	switch rr.rtype {
+	case typeA:
+		if length == 4 {
+			rr.ip = net.IP(append([]byte(nil), b[start:end]...))
+		}
+	case typePTR:
+		if rr.ptr, _, err = readName(b, start); err != nil {
+			return record{}, 0, err
+		}
+	case typeSRV:
+		if length < 7 {
+			return record{}, 0, errMalformed
+		}
+		rr.port = binary.BigEndian.Uint16(b[start+4:])
+		if rr.target, _, err = readName(b, start+6); err != nil {
+			return record{}, 0, err
+		}
+	case typeTXT:
+		for i := start; i < end; {
+			n := int(b[i])
+			if i+1+n > end {
+				return record{}, 0, errMalformed
+			}
+			if n > 0 {
+				rr.txt = append(rr.txt, string(b[i+1:i+1+n]))
+			}
+			i += 1 + n
+		}
+	}
+	return rr, end, nil
+}
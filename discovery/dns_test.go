@@ -0,0 +1,158 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestPackUnpackRoundTrip(t *testing.T) {
+	instance := Instance{
+		Name:      "laptop-8080",
+		Host:      "laptop.local.",
+		Port:      8080,
+		Addrs:     []net.IP{net.IPv4(192, 168, 1, 20).To4(), net.IPv4(10, 0, 0, 5).To4()},
+		Version:   "1.2.0",
+		Protocols: []string{"weather", "sensors"},
+	}
+	records := instanceRecords(instance)
+
+	tests := []struct {
+		name string
+		msg  message
+	}{
+		{
+			name: "query",
+			msg: message{
+				id:        7,
+				questions: []question{{name: ServiceType, qtype: typePTR, class: classIN | unicastResponse}},
+			},
+		},
+		{
+			name: "response",
+			msg: message{
+				flags:     flagResponse | flagAuthoritative,
+				questions: []question{{name: ServiceType, qtype: typePTR, class: classIN}},
+				answers:   records[:1],
+				extra:     records[1:],
+			},
+		},
+		{
+			name: "empty TXT",
+			msg: message{
+				flags:   flagResponse,
+				answers: []record{{name: "x." + ServiceType, rtype: typeTXT, class: classIN, ttl: 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := tt.msg.pack()
+			if err != nil {
+				t.Fatalf("pack: %v", err)
+			}
+			got, err := unpack(packet)
+			if err != nil {
+				t.Fatalf("unpack: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.msg) {
+				t.Errorf("round trip mismatch:\n got %+v\nwant %+v", *got, tt.msg)
+			}
+		})
+	}
+}
+
+func TestTXTRoundTrip(t *testing.T) {
+	var protocols []string
+	for i := 0; i < 60; i++ {
+		protocols = append(protocols, "protocol-"+string(rune('a'+i%26))+"-name")
+	}
+	instance := Instance{Version: "dev", Protocols: protocols}
+
+	txt := txtStrings(instance)
+	for _, s := range txt {
+		if len(s) > 255 {
+			t.Fatalf("TXT string of %d bytes", len(s))
+		}
+	}
+
+	var got Instance
+	parseTXT(&got, txt)
+	if got.Version != "dev" || !reflect.DeepEqual(got.Protocols, protocols) {
+		t.Errorf("parseTXT = %+v, want version dev and %d protocols", got, len(protocols))
+	}
+}
+
+func TestReadNameCompression(t *testing.T) {
+	// "local." at offset 0, then "host" followed by a pointer back to it.
+	b := []byte{5, 'l', 'o', 'c', 'a', 'l', 0, 4, 'h', 'o', 's', 't', 0xC0, 0x00}
+	name, next, err := readName(b, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "host.local." || next != len(b) {
+		t.Errorf("readName = %q, %d; want %q, %d", name, next, "host.local.", len(b))
+	}
+}
+
+func TestUnpackMalformed(t *testing.T) {
+	valid, err := (&message{
+		flags:   flagResponse,
+		answers: []record{{name: ServiceType, rtype: typePTR, class: classIN, ttl: 120, ptr: "a." + ServiceType}},
+	}).pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := func(qd, an uint16) []byte {
+		b := make([]byte, 12)
+		binary.BigEndian.PutUint16(b[4:], qd)
+		binary.BigEndian.PutUint16(b[6:], an)
+		return b
+	}
+	withRecord := func(rtype uint16, rdata []byte) []byte {
+		b := append(header(0, 1), 0)
+		b = binary.BigEndian.AppendUint16(b, rtype)
+		b = binary.BigEndian.AppendUint16(b, classIN)
+		b = binary.BigEndian.AppendUint32(b, 120)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(rdata)))
+		return append(b, rdata...)
+	}
+
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		{"empty", nil},
+		{"short header", make([]byte, 11)},
+		{"missing question", header(1, 0)},
+		{"truncated question", append(header(1, 0), 3, 'a', 'b', 'c', 0, 0)},
+		{"label past end", append(header(1, 0), 10, 'a')},
+		{"pointer past end", append(header(1, 0), 0xC0)},
+		{"pointer loop", append(header(1, 0), 0xC0, 12)},
+		{"missing answer", header(0, 1)},
+		{"truncated record", valid[:len(valid)-3]},
+		{"short SRV", withRecord(typeSRV, []byte{0, 0, 0, 0, 0})},
+		{"TXT past rdata", withRecord(typeTXT, []byte{5, 'a'})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := unpack(tt.packet); err == nil {
+				t.Errorf("unpack(%v) succeeded, want error", tt.packet)
+			}
+		})
+	}
+}
+
+func TestAppendNameRejectsLongLabel(t *testing.T) {
+	long := make([]byte, 64)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if _, err := appendName(nil, string(long)+".local."); err == nil {
+		t.Error("appendName accepted a 64-byte label")
+	}
+}
@@ -0,0 +1,222 @@
+package discovery
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ServiceType = "_freeport._tcp.local."
+	// DefaultAddress is the standard mDNS group. Any other address is used
+	// as plain unicast UDP, which is how discovery is exercised on loopback.
+	DefaultAddress = "224.0.0.251:5353"
+
+	recordTTL = 120
+)
+
+// Instance is one freeport bus as seen on the network.
+type Instance struct {
+	Name      string
+	Host      string
+	Port      int
+	Addrs     []net.IP
+	Version   string
+	Protocols []string
+}
+
+// Responder answers DNS-SD queries for this instance. The description is
+// rebuilt on every query so newly registered protocols show up at once.
+type Responder struct {
+	addr     string
+	describe func() Instance
+	conn     *net.UDPConn
+	wg       sync.WaitGroup
+}
+
+func NewResponder(addr string, describe func() Instance) *Responder {
+	if addr == "" {
+		addr = DefaultAddress
+	}
+	return &Responder{addr: addr, describe: describe}
+}
+
+// DefaultInstance describes a bus listening on port of this host.
+func DefaultInstance(port int) Instance {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "freeport"
+	}
+	host = strings.Split(host, ".")[0]
+	return Instance{
+		Name:  host + "-" + strconv.Itoa(port),
+		Host:  host + ".local.",
+		Port:  port,
+		Addrs: localAddrs(),
+	}
+}
+
+func localAddrs() []net.IP {
+	var loopback, addrs []net.IP
+	ifaceAddrs, _ := net.InterfaceAddrs()
+	for _, addr := range ifaceAddrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil {
+			continue
+		}
+		if ipNet.IP.IsLoopback() {
+			loopback = append(loopback, ipNet.IP.To4())
+		} else {
+			addrs = append(addrs, ipNet.IP.To4())
+		}
+	}
+	if len(addrs) == 0 {
+		return loopback
+	}
+	return addrs
+}
+
+func listen(addr string) (*net.UDPConn, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	if udpAddr.IP.IsMulticast() {
+		return net.ListenMulticastUDP("udp4", nil, udpAddr)
+	}
+	return net.ListenUDP("udp4", udpAddr)
+}
+
+func (r *Responder) Start() error {
+	conn, err := listen(r.addr)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+
+	r.wg.Add(1)
+	go r.serve()
+	return nil
+}
+
+func (r *Responder) Close() {
+	if r.conn != nil {
+		r.conn.Close()
+		r.wg.Wait()
+	}
+}
+
+func (r *Responder) serve() {
+	defer r.wg.Done()
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		query, err := unpack(buf[:n])
+		if err != nil || query.isResponse() {
+			continue
+		}
+
+		reply := r.answer(query)
+		if reply == nil {
+			continue
+		}
+		if packet, err := reply.pack(); err == nil {
+			// Every reply goes straight back to the asker, as for a legacy
+			// unicast query. Browsers therefore never need to bind 5353.
+			r.conn.WriteToUDP(packet, from)
+		}
+	}
+}
+
+func (r *Responder) answer(query *message) *message {
+	instance := r.describe()
+	records := instanceRecords(instance)
+	instanceName := serviceName(instance.Name)
+
+	reply := &message{id: query.id, flags: flagResponse | flagAuthoritative}
+	for _, q := range query.questions {
+		name := strings.ToLower(q.name)
+		switch {
+		case name == ServiceType && (q.qtype == typePTR || q.qtype == typeANY):
+			reply.answers = append(reply.answers, records[0])
+			reply.extra = append(reply.extra, records[1:]...)
+		case name == strings.ToLower(instanceName):
+			for _, rr := range records[1:3] {
+				if q.qtype == rr.rtype || q.qtype == typeANY {
+					reply.answers = append(reply.answers, rr)
+				}
+			}
+		case name == strings.ToLower(instance.Host) && (q.qtype == typeA || q.qtype == typeANY):
+			reply.answers = append(reply.answers, records[3:]...)
+		}
+		if len(reply.answers) > 0 {
+			reply.questions = append(reply.questions, question{name: q.name, qtype: q.qtype, class: classIN})
+		}
+	}
+
+	if len(reply.answers) == 0 {
+		return nil
+	}
+	return reply
+}
+
+func serviceName(instance string) string {
+	return strings.ReplaceAll(instance, ".", "-") + "." + ServiceType
+}
+
+// instanceRecords returns the PTR, SRV and TXT records for instance followed
+// by one A record per address.
+func instanceRecords(instance Instance) []record {
+	name := serviceName(instance.Name)
+	records := []record{
+		{name: ServiceType, rtype: typePTR, class: classIN, ttl: recordTTL, ptr: name},
+		{name: name, rtype: typeSRV, class: classIN | cacheFlush, ttl: recordTTL, target: instance.Host, port: uint16(instance.Port)},
+		{name: name, rtype: typeTXT, class: classIN | cacheFlush, ttl: recordTTL, txt: txtStrings(instance)},
+	}
+	for _, ip := range instance.Addrs {
+		records = append(records, record{name: instance.Host, rtype: typeA, class: classIN | cacheFlush, ttl: recordTTL, ip: ip})
+	}
+	return records
+}
+
+// txtStrings encodes the instance metadata. The protocol list is split over
+// as many protocols= strings as it takes to stay under 255 bytes each.
+func txtStrings(instance Instance) []string {
+	txt := []string{"txtvers=1", "api=v1"}
+	if instance.Version != "" {
+		txt = append(txt, "version="+instance.Version)
+	}
+
+	chunk := ""
+	for _, name := range instance.Protocols {
+		if len("protocols=")+len(chunk)+len(name)+1 > 255 && chunk != "" {
+			txt = append(txt, "protocols="+chunk)
+			chunk = ""
+		}
+		if chunk != "" {
+			chunk += ","
+		}
+		chunk += name
+	}
+	if chunk != "" {
+		txt = append(txt, "protocols="+chunk)
+	}
+	return txt
+}
+
+func parseTXT(instance *Instance, txt []string) {
+	for _, entry := range txt {
+		key, value, _ := strings.Cut(entry, "=")
+		switch key {
+		case "version":
+			instance.Version = value
+		case "protocols":
+			instance.Protocols = append(instance.Protocols, strings.Split(value, ",")...)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Eval runs the program against vars, whose values are decoded JSON: nil,
+// bool, float64 or json.Number, string, []interface{} and
+// map[string]interface{}. Numbers in the result are float64.
+//
+// Reading a missing field or index gives null rather than an error, so an
+// expression can test for it; doing arithmetic on null is an error.
+func (p *Program) Eval(vars map[string]interface{}) (interface{}, error) {
+	return p.root.eval(vars)
+}
+
+type node interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (n *literal) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type variable struct {
+	name string
+}
+
+func (n *variable) eval(vars map[string]interface{}) (interface{}, error) {
+	return normalize(vars[n.name]), nil
+}
+
+// normalize turns json.Number into float64 so the operators see one
+// numeric type.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return n
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = normalize(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = normalize(item)
+		}
+		return out
+	}
+	return value
+}
+
+type index struct {
+	target node
+	key    node
+	pos    int
+}
+
+func (n *index) eval(vars map[string]interface{}) (interface{}, error) {
+	target, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := target.(type) {
+	case map[string]interface{}:
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("at %d: an object is indexed by a string, not %s", n.pos+1, typeName(key))
+		}
+		return t[name], nil
+	case []interface{}:
+		i, ok := key.(float64)
+		if !ok || i != math.Trunc(i) {
+			return nil, fmt.Errorf("at %d: an array is indexed by a whole number, not %s", n.pos+1, typeName(key))
+		}
+		if i < 0 {
+			i += float64(len(t))
+		}
+		if i < 0 || int(i) >= len(t) {
+			return nil, nil
+		}
+		return t[int(i)], nil
+	}
+	return nil, nil
+}
+
+type unary struct {
+	op      string
+	pos     int
+	operand node
+}
+
+func (n *unary) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(value), nil
+	}
+	x, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("at %d: cannot negate %s", n.pos+1, typeName(value))
+	}
+	return -x, nil
+}
+
+type binary struct {
+	op          string
+	pos         int
+	left, right node
+}
+
+func (n *binary) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || only look at the right side when they need to.
+	switch n.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(vars)
+		return truthy(right), err
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(vars)
+		return truthy(right), err
+	}
+
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "+":
+		return n.add(left, right)
+	case "<", "<=", ">", ">=":
+		return n.compare(left, right)
+	}
+
+	x, xok := left.(float64)
+	y, yok := right.(float64)
+	if !xok || !yok {
+		return nil, fmt.Errorf("at %d: '%s' needs numbers, not %s and %s", n.pos+1, n.op, typeName(left), typeName(right))
+	}
+	switch n.op {
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, fmt.Errorf("at %d: division by zero", n.pos+1)
+		}
+		return x / y, nil
+	default:
+		if y == 0 {
+			return nil, fmt.Errorf("at %d: division by zero", n.pos+1)
+		}
+		return math.Mod(x, y), nil
+	}
+}
+
+// add sums numbers, joins strings and arrays, and merges objects with the
+// right side winning.
+func (n *binary) add(left, right interface{}) (interface{}, error) {
+	switch l := left.(type) {
+	case float64:
+		if r, ok := right.(float64); ok {
+			return l + r, nil
+		}
+		if r, ok := right.(string); ok {
+			return format(l) + r, nil
+		}
+	case string:
+		switch r := right.(type) {
+		case string:
+			return l + r, nil
+		case float64, bool:
+			return l + format(r), nil
+		}
+	case []interface{}:
+		if r, ok := right.([]interface{}); ok {
+			return append(append([]interface{}{}, l...), r...), nil
+		}
+	case map[string]interface{}:
+		if r, ok := right.(map[string]interface{}); ok {
+			return merge(l, r), nil
+		}
+	}
+	return nil, fmt.Errorf("at %d: cannot add %s and %s", n.pos+1, typeName(left), typeName(right))
+}
+
+func (n *binary) compare(left, right interface{}) (interface{}, error) {
+	var c int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("at %d: cannot compare %s with %s", n.pos+1, typeName(left), typeName(right))
+		}
+		c = compareFloats(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("at %d: cannot compare %s with %s", n.pos+1, typeName(left), typeName(right))
+		}
+		c = strings.Compare(l, r)
+	default:
+		return nil, fmt.Errorf("at %d: cannot compare %s", n.pos+1, typeName(left))
+	}
+
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+type conditional struct {
+	condition, then, otherwise node
+}
+
+func (n *conditional) eval(vars map[string]interface{}) (interface{}, error) {
+	condition, err := n.condition.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(condition) {
+		return n.then.eval(vars)
+	}
+	return n.otherwise.eval(vars)
+}
+
+type array struct {
+	items []node
+}
+
+func (n *array) eval(vars map[string]interface{}) (interface{}, error) {
+	out := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		value, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = value
+	}
+	return out, nil
+}
+
+type object struct {
+	keys   []string
+	values []node
+}
+
+func (n *object) eval(vars map[string]interface{}) (interface{}, error) {
+	out := make(map[string]interface{}, len(n.keys))
+	for i, key := range n.keys {
+		value, err := n.values[i].eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = value
+	}
+	return out, nil
+}
+
+type call struct {
+	name string
+	pos  int
+	fn   function
+	args []node
+}
+
+func (n *call) eval(vars map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	result, err := n.fn.run(args)
+	if err != nil {
+		return nil, fmt.Errorf("at %d: %s: %w", n.pos+1, n.name, err)
+	}
+	return result, nil
+}
+
+// truthy follows JSON-query languages: only false and null are false.
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func merge(objects ...map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, o := range objects {
+		for key, value := range o {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case nil:
+		return "null"
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// sortedKeys is used by keys() so its output does not depend on map order.
+func sortedKeys(o map[string]interface{}) []interface{} {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]interface{}, len(names))
+	for i, name := range names {
+		out[i] = name
+	}
+	return out
+}
@@ -0,0 +1,163 @@
+package expr
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func eval(t *testing.T, source string, vars map[string]interface{}) (interface{}, error) {
+	t.Helper()
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	program, err := Compile(source, names)
+	if err != nil {
+		t.Fatalf("Compile(%q): %v", source, err)
+	}
+	return program.Eval(vars)
+}
+
+func TestEval(t *testing.T) {
+	vars := map[string]interface{}{
+		"f": map[string]interface{}{
+			"temp":  json.Number("212"),
+			"room":  "lab",
+			"list":  []interface{}{json.Number("1"), json.Number("2.5"), json.Number("3")},
+			"empty": nil,
+		},
+		"n": json.Number("4"),
+	}
+
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		// Precedence and associativity.
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"2 * 3 % 4", 2.0},
+		{"-2 * 3", -6.0},
+		{"1 + 2 < 4", true},
+		{"1 < 2 == 2 < 3", true},
+		{"true || false && false", true},
+		{"!true || true", true},
+		{"false ? 1 : true ? 2 : 3", 2.0},
+		{"1 + 1 == 2 ? 'yes' : 'no'", "yes"},
+
+		// json.Number inputs act as plain numbers.
+		{"n * 2", 8.0},
+		{"n == 4", true},
+		{"round((f.temp - 32) * 5 / 9, 1)", 100.0},
+		{"sum(f.list)", 6.5},
+		{"f.list[1]", 2.5},
+		{"f.list[-1]", 3.0},
+		{"f", map[string]interface{}{
+			"temp": 212.0, "room": "lab", "list": []interface{}{1.0, 2.5, 3.0}, "empty": nil,
+		}},
+
+		// Missing fields and indexes read as null.
+		{"f.missing", nil},
+		{"f.missing.deeper", nil},
+		{"f.list[10]", nil},
+		{"n.field", nil},
+		{"f.missing == null", true},
+		{"coalesce(f.missing, f.empty, 'default')", "default"},
+		{"has(f, 'room') && !has(f, 'missing')", true},
+
+		// Other operators and functions.
+		{"'a' + 1", "a1"},
+		{"[1] + [2]", []interface{}{1.0, 2.0}},
+		{"{a: 1} + {a: 2, b: 3}", map[string]interface{}{"a": 2.0, "b": 3.0}},
+		{"len(f.room) > 2", true},
+		{"false && 1 / 0", false},
+		{"true || f.missing + 1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			got, err := eval(t, tt.source, vars)
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	vars := map[string]interface{}{
+		"f": map[string]interface{}{"temp": json.Number("20"), "room": "lab"},
+		"z": json.Number("0"),
+	}
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"1 / 0", "at 3: division by zero"},
+		{"f.temp / z", "division by zero"},
+		{"5 % 0", "division by zero"},
+		{"f.missing + 1", "cannot add null and a number"},
+		{"f.missing * 2", "needs numbers"},
+		{"-f.room", "cannot negate a string"},
+		{"f.room < 1", "cannot compare a string with a number"},
+		{"f[1]", "indexed by a string"},
+		{"[1, 2]['a']", "indexed by a whole number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := eval(t, tt.source, vars)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"x + 1", "unknown name x"},
+		{"nope(1)", "unknown function nope"},
+		{"round()", "round takes"},
+		{"1 +", "unexpected"},
+		{"(1 + 2", "expected"},
+		{"1 2", "unexpected"},
+		{"a.", "expected a field name"},
+		{"{1: 2}", "expected a key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := Compile(tt.source, []string{"a"})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	in := map[string]interface{}{
+		"n":    json.Number("1.5"),
+		"big":  json.Number("1e400"),
+		"list": []interface{}{json.Number("2"), "x"},
+	}
+	want := map[string]interface{}{
+		"n":    1.5,
+		"big":  "1e400",
+		"list": []interface{}{2.0, "x"},
+	}
+	if got := normalize(in); !reflect.DeepEqual(got, want) {
+		t.Errorf("normalize = %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,345 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// function is a built-in. max is -1 when it takes any number of arguments
+// from min up.
+type function struct {
+	min, max int
+	run      func(args []interface{}) (interface{}, error)
+}
+
+func (f function) arity() string {
+	switch {
+	case f.max < 0:
+		return fmt.Sprintf("at least %d argument%s", f.min, plural(f.min))
+	case f.min == f.max:
+		return fmt.Sprintf("%d argument%s", f.min, plural(f.min))
+	}
+	return fmt.Sprintf("%d to %d arguments", f.min, f.max)
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+var functions = map[string]function{
+	"round": {1, 2, fnRound},
+	"floor": {1, 1, numeric(math.Floor)},
+	"ceil":  {1, 1, numeric(math.Ceil)},
+	"abs":   {1, 1, numeric(math.Abs)},
+	"min":   {1, -1, extreme(-1)},
+	"max":   {1, -1, extreme(1)},
+	"sum":   {1, 1, fnSum},
+	"avg":   {1, 1, fnAvg},
+	"len":   {1, 1, fnLen},
+	"upper": {1, 1, text(strings.ToUpper)},
+	"lower": {1, 1, text(strings.ToLower)},
+	"trim":  {1, 1, text(strings.TrimSpace)},
+	"string": {1, 1, func(args []interface{}) (interface{}, error) {
+		return format(args[0]), nil
+	}},
+	"number":   {1, 1, fnNumber},
+	"has":      {2, 2, fnHas},
+	"keys":     {1, 1, fnKeys},
+	"pick":     {2, -1, fnPick},
+	"merge":    {1, -1, fnMerge},
+	"coalesce": {1, -1, fnCoalesce},
+	"contains": {2, 2, fnContains},
+	"join":     {2, 2, fnJoin},
+	"split":    {2, 2, fnSplit},
+	"pluck":    {2, 2, fnPluck},
+	"now": {0, 0, func([]interface{}) (interface{}, error) {
+		return time.Now().UTC().Format(time.RFC3339Nano), nil
+	}},
+}
+
+func number(value interface{}) (float64, error) {
+	n, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("expected a number, not %s", typeName(value))
+	}
+	return n, nil
+}
+
+func list(value interface{}) ([]interface{}, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array, not %s", typeName(value))
+	}
+	return items, nil
+}
+
+func numeric(fn func(float64) float64) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		x, err := number(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(x), nil
+	}
+}
+
+func text(fn func(string) string) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, not %s", typeName(args[0]))
+		}
+		return fn(s), nil
+	}
+}
+
+func fnRound(args []interface{}) (interface{}, error) {
+	x, err := number(args[0])
+	if err != nil {
+		return nil, err
+	}
+	digits := 0.0
+	if len(args) == 2 {
+		if digits, err = number(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	scale := math.Pow(10, math.Trunc(digits))
+	return math.Round(x*scale) / scale, nil
+}
+
+// numbers accepts either one array argument or the numbers themselves.
+func numbers(args []interface{}) ([]float64, error) {
+	if len(args) == 1 {
+		if items, ok := args[0].([]interface{}); ok {
+			args = items
+		}
+	}
+	out := make([]float64, len(args))
+	for i, arg := range args {
+		n, err := number(arg)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = n
+	}
+	return out, nil
+}
+
+func extreme(sign float64) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		values, err := numbers(args)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			return nil, nil
+		}
+		best := values[0]
+		for _, v := range values[1:] {
+			if (v-best)*sign > 0 {
+				best = v
+			}
+		}
+		return best, nil
+	}
+}
+
+func fnSum(args []interface{}) (interface{}, error) {
+	values, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total, nil
+}
+
+func fnAvg(args []interface{}) (interface{}, error) {
+	values, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values)), nil
+}
+
+func fnLen(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case string:
+		return float64(len([]rune(v))), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	case nil:
+		return 0.0, nil
+	}
+	return nil, fmt.Errorf("expected a string, array or object, not %s", typeName(args[0]))
+}
+
+func fnNumber(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", v)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to a number", typeName(args[0]))
+}
+
+func fnHas(args []interface{}) (interface{}, error) {
+	o, ok := args[0].(map[string]interface{})
+	if !ok {
+		return false, nil
+	}
+	key, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a key string, not %s", typeName(args[1]))
+	}
+	_, exists := o[key]
+	return exists, nil
+}
+
+func fnKeys(args []interface{}) (interface{}, error) {
+	o, ok := args[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object, not %s", typeName(args[0]))
+	}
+	return sortedKeys(o), nil
+}
+
+func fnPick(args []interface{}) (interface{}, error) {
+	o, ok := args[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object, not %s", typeName(args[0]))
+	}
+	out := map[string]interface{}{}
+	for _, arg := range args[1:] {
+		key, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a key string, not %s", typeName(arg))
+		}
+		if value, exists := o[key]; exists {
+			out[key] = value
+		}
+	}
+	return out, nil
+}
+
+func fnMerge(args []interface{}) (interface{}, error) {
+	objects := make([]map[string]interface{}, 0, len(args))
+	for _, arg := range args {
+		if arg == nil {
+			continue
+		}
+		o, ok := arg.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected objects, not %s", typeName(arg))
+		}
+		objects = append(objects, o)
+	}
+	return merge(objects...), nil
+}
+
+func fnCoalesce(args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+func fnContains(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case string:
+		sub, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string to look for, not %s", typeName(args[1]))
+		}
+		return strings.Contains(v, sub), nil
+	case []interface{}:
+		for _, item := range v {
+			if equal(item, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		return fnHas(args)
+	}
+	return nil, fmt.Errorf("expected a string, array or object, not %s", typeName(args[0]))
+}
+
+func fnJoin(args []interface{}) (interface{}, error) {
+	items, err := list(args[0])
+	if err != nil {
+		return nil, err
+	}
+	sep, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a separator string, not %s", typeName(args[1]))
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = format(item)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func fnSplit(args []interface{}) (interface{}, error) {
+	s, ok := args[0].(string)
+	sep, sepOK := args[1].(string)
+	if !ok || !sepOK {
+		return nil, fmt.Errorf("expected two strings, not %s and %s", typeName(args[0]), typeName(args[1]))
+	}
+	parts := strings.Split(s, sep)
+	out := make([]interface{}, len(parts))
+	for i, part := range parts {
+		out[i] = part
+	}
+	return out, nil
+}
+
+// pluck reads one field from every object in an array.
+func fnPluck(args []interface{}) (interface{}, error) {
+	items, err := list(args[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a key string, not %s", typeName(args[1]))
+	}
+	out := make([]interface{}, len(items))
+	for i, item := range items {
+		if o, ok := item.(map[string]interface{}); ok {
+			out[i] = o[key]
+		}
+	}
+	return out, nil
+}
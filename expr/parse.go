@@ -0,0 +1,435 @@
+// Package expr is the small expression language derived methods are
+// computed with. It has JSON values, arithmetic, comparisons, member access
+// and a fixed set of functions, and no way to loop or reach outside the
+// values it is given, so any expression finishes quickly.
+//
+//	{celsius: round((f.temp - 32) * 5 / 9, 1), room: f.room}
+//	a.total + b.total
+//	len(readings) > 0 ? avg(pluck(readings, "value")) : null
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Program is a compiled expression, safe for concurrent use.
+type Program struct {
+	source string
+	root   node
+}
+
+func (p *Program) String() string {
+	return p.source
+}
+
+// Compile parses source. Every name the expression reads must be listed in
+// names; anything else is reported now rather than when it is evaluated.
+func Compile(source string, names []string) (*Program, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[name] = true
+	}
+	p := &parser{tokens: tokens, names: known}
+
+	root, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return &Program{source: source, root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	num  float64
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// punctuation lists operators longest first so that "<=" wins over "<".
+var punctuation = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"+", "-", "*", "/", "%", "<", ">", "!", "?", ":",
+	".", ",", "(", ")", "[", "]", "{", "}",
+}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(source) {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.') {
+				i++
+			}
+			if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+				i++
+				if i < len(source) && (source[i] == '+' || source[i] == '-') {
+					i++
+				}
+				for i < len(source) && isDigit(source[i]) {
+					i++
+				}
+			}
+			n, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: invalid number %q", start+1, source[start:i])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], pos: start, num: n})
+
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var text strings.Builder
+			for {
+				if i >= len(source) {
+					return nil, fmt.Errorf("at %d: unterminated string", start+1)
+				}
+				if rune(source[i]) == c {
+					i++
+					break
+				}
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+					switch source[i] {
+					case 'n':
+						text.WriteByte('\n')
+					case 't':
+						text.WriteByte('\t')
+					default:
+						text.WriteByte(source[i])
+					}
+					i++
+					continue
+				}
+				text.WriteByte(source[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text.String(), pos: start})
+
+		case c == '_' || c == '$' || unicode.IsLetter(c):
+			start := i
+			for i < len(source) && (source[i] == '_' || source[i] == '$' || isDigit(source[i]) || unicode.IsLetter(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], pos: start})
+
+		default:
+			matched := false
+			for _, p := range punctuation {
+				if strings.HasPrefix(source[i:], p) {
+					tokens = append(tokens, token{kind: tokenPunct, text: p, pos: i})
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("at %d: unexpected character %q", i+1, c)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type parser struct {
+	tokens []token
+	at     int
+	names  map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.at]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.at]
+	if t.kind != tokenEOF {
+		p.at++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the punctuation text.
+func (p *parser) accept(text string) bool {
+	if t := p.peek(); t.kind == tokenPunct && t.text == text {
+		p.at++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return p.errorf(t, "expected '%s', found %s", text, t)
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("at %d: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expression() (node, error) {
+	condition, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return condition, nil
+	}
+
+	then, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &conditional{condition: condition, then: then, otherwise: otherwise}, nil
+}
+
+// precedence climbs from || at level 0 to the multiplicative operators.
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (node, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenPunct || !contains(precedence[level], t.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: t.text, pos: t.pos, left: left, right: right}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) unary() (node, error) {
+	t := p.peek()
+	if t.kind == tokenPunct && (t.text == "!" || t.text == "-") {
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{op: t.text, pos: t.pos, operand: operand}, nil
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (node, error) {
+	n, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case p.accept("."):
+			field := p.next()
+			if field.kind != tokenIdent {
+				return nil, p.errorf(field, "expected a field name after '.', found %s", field)
+			}
+			n = &index{target: n, key: &literal{value: field.text}, pos: t.pos}
+		case p.accept("["):
+			key, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &index{target: n, key: key, pos: t.pos}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return &literal{value: t.num}, nil
+	case tokenString:
+		return &literal{value: t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literal{value: true}, nil
+		case "false":
+			return &literal{value: false}, nil
+		case "null":
+			return &literal{value: nil}, nil
+		}
+		if p.accept("(") {
+			return p.call(t)
+		}
+		if !p.names[t.text] {
+			return nil, p.errorf(t, "unknown name %s", t.text)
+		}
+		return &variable{name: t.text}, nil
+	case tokenPunct:
+		switch t.text {
+		case "(":
+			n, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			return p.array()
+		case "{":
+			return p.object()
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", t)
+}
+
+func (p *parser) call(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function %s", name.text)
+	}
+
+	var args []node
+	if !p.accept(")") {
+		for {
+			arg, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.accept(")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(args) < fn.min || (fn.max >= 0 && len(args) > fn.max) {
+		return nil, p.errorf(name, "%s takes %s", name.text, fn.arity())
+	}
+	return &call{name: name.text, pos: name.pos, fn: fn, args: args}, nil
+}
+
+func (p *parser) array() (node, error) {
+	n := &array{}
+	if p.accept("]") {
+		return n, nil
+	}
+	for {
+		item, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+		if p.accept("]") {
+			return n, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) object() (node, error) {
+	n := &object{}
+	if p.accept("}") {
+		return n, nil
+	}
+	for {
+		key := p.next()
+		if key.kind != tokenIdent && key.kind != tokenString {
+			return nil, p.errorf(key, "expected a key, found %s", key)
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		n.keys = append(n.keys, key.text)
+		n.values = append(n.values, value)
+		if p.accept("}") {
+			return n, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package alerts is the notification area shown above every screen while
+// alert rules are firing or have just resolved.
+package alerts
+
+import (
+	"fmt"
+	"freeport/api"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// resolvedNotice is how long a resolved alert stays in the area.
+const resolvedNotice = 10 * time.Second
+
+// AlertMsg carries an alert as it fires or resolves. The root model
+// forwards it here whichever screen is showing.
+type AlertMsg api.Alert
+
+type expireMsg struct{}
+
+type Model struct {
+	feed     <-chan api.Alert
+	firing   map[string]api.Alert
+	resolved []api.Alert
+}
+
+// NewModel follows the alerts of a, which may be nil when no rules are
+// configured.
+func NewModel(a *api.Alerts) *Model {
+	m := &Model{firing: make(map[string]api.Alert)}
+	if a == nil {
+		return m
+	}
+
+	m.feed, _ = a.Subscribe(32)
+	// Rules that fired before the TUI subscribed. Recent is newest first,
+	// so the first alert seen for a rule is its current one.
+	seen := map[string]bool{}
+	for _, alert := range a.Recent() {
+		if !seen[alert.Rule] && alert.State == api.AlertFiring {
+			m.firing[alert.Rule] = alert
+		}
+		seen[alert.Rule] = true
+	}
+	return m
+}
+
+func (m *Model) Init() tea.Cmd {
+	return m.waitForAlert()
+}
+
+func (m *Model) waitForAlert() tea.Cmd {
+	feed := m.feed
+	if feed == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		alert, ok := <-feed
+		if !ok {
+			return nil
+		}
+		return AlertMsg(alert)
+	}
+}
+
+func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case AlertMsg:
+		alert := api.Alert(msg)
+		if alert.State == api.AlertFiring {
+			m.firing[alert.Rule] = alert
+			return m, m.waitForAlert()
+		}
+		delete(m.firing, alert.Rule)
+		m.resolved = append(m.resolved, alert)
+		expire := tea.Tick(resolvedNotice, func(time.Time) tea.Msg {
+			return expireMsg{}
+		})
+		return m, tea.Batch(m.waitForAlert(), expire)
+
+	case expireMsg:
+		kept := m.resolved[:0]
+		for _, alert := range m.resolved {
+			if time.Since(alert.Time) < resolvedNotice {
+				kept = append(kept, alert)
+			}
+		}
+		m.resolved = kept
+	}
+	return m, nil
+}
+
+// Handles reports whether msg belongs to the notification area.
+func Handles(msg tea.Msg) bool {
+	switch msg.(type) {
+	case AlertMsg, expireMsg:
+		return true
+	}
+	return false
+}
+
+// View renders the area, or nothing when there is nothing to show.
+func (m Model) View(width int) string {
+	if len(m.firing) == 0 && len(m.resolved) == 0 {
+		return ""
+	}
+
+	firing := make([]api.Alert, 0, len(m.firing))
+	for _, alert := range m.firing {
+		firing = append(firing, alert)
+	}
+	sort.Slice(firing, func(i, j int) bool { return firing[i].Time.Before(firing[j].Time) })
+
+	firingStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("196")).
+		Bold(true)
+	resolvedStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("42"))
+
+	lines := ""
+	for _, alert := range firing {
+		lines += firingStyle.Render(fmt.Sprintf("● %s", alert.Rule)) +
+			fmt.Sprintf(" %s (since %s)\n", alert.Message, alert.Time.Format("15:04:05"))
+	}
+	for _, alert := range m.resolved {
+		lines += resolvedStyle.Render(fmt.Sprintf("✓ %s", alert.Rule)) +
+			fmt.Sprintf(" %s\n", alert.Message)
+	}
+
+	boxWidth := width - 6
+	if boxWidth < 20 {
+		boxWidth = 20
+	}
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("196")).
+		Padding(0, 1).
+		Margin(0, 2).
+		Width(boxWidth).
+		Render(strings.TrimSuffix(lines, "\n"))
+}
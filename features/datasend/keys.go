@@ -0,0 +1,305 @@
+package datasend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"freeport/client"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// keyPageSize is how many keys the browser shows at once.
+const keyPageSize = 15
+
+var browseKeys = keyMap{
+	Filter: key.NewBinding(
+		key.WithKeys("/"),
+		key.WithHelp("/", "filter by prefix"),
+	),
+	NextPage: key.NewBinding(
+		key.WithKeys("right", "l", "pgdown"),
+		key.WithHelp("→/l", "next page"),
+	),
+	PrevPage: key.NewBinding(
+		key.WithKeys("left", "h", "pgup"),
+		key.WithHelp("←/h", "previous page"),
+	),
+	Delete: key.NewBinding(
+		key.WithKeys("d"),
+		key.WithHelp("d", "delete key"),
+	),
+	Back: key.NewBinding(
+		key.WithKeys("esc", "b"),
+		key.WithHelp("esc/b", "back"),
+	),
+	Quit: key.NewBinding(
+		key.WithKeys("ctrl+c"),
+		key.WithHelp("ctrl+c", "quit"),
+	),
+}
+
+// keyBrowser is the state of the keys screen of one method.
+type keyBrowser struct {
+	method   string
+	prefix   textinput.Model
+	keys     []client.KeyInfo
+	cursor   int
+	pages    []string // after cursors of the pages before this one
+	after    string
+	next     string
+	selected string
+	value    string
+	err      string
+}
+
+type keysMsg struct {
+	method string
+	page   *client.KeyPage
+	err    error
+}
+
+type keyValueMsg struct {
+	method, key string
+	value       string
+	err         error
+}
+
+func newKeyBrowser(method string) *keyBrowser {
+	prefix := textinput.New()
+	prefix.Placeholder = "prefix"
+	prefix.CharLimit = 100
+	prefix.Width = 30
+	return &keyBrowser{method: method, prefix: prefix}
+}
+
+// protocolClient talks to the bus as the protocol being managed.
+func (m *Model) protocolClient() *client.Client {
+	return m.bus.WithCredentials(m.currentProtocol.AppName, m.currentProtocol.Passkey)
+}
+
+func (m *Model) openKeys() tea.Cmd {
+	_, methodName, ok := m.selectedMethod()
+	if !ok {
+		return nil
+	}
+	if methodName == "init" {
+		m.statusMsg = "The init method has no keys"
+		return nil
+	}
+	m.browser = newKeyBrowser(methodName)
+	m.Mode = KeysMode
+	m.keys = browseKeys
+	return m.fetchKeys()
+}
+
+func (m *Model) fetchKeys() tea.Cmd {
+	c := m.protocolClient()
+	b := m.browser
+	method, query := b.method, client.KeyQuery{Prefix: b.prefix.Value(), After: b.after, Limit: keyPageSize}
+	return func() tea.Msg {
+		page, err := c.Keys(context.Background(), method, query)
+		return keysMsg{method: method, page: page, err: err}
+	}
+}
+
+func (m *Model) fetchKeyValue() tea.Cmd {
+	b := m.browser
+	if b.cursor >= len(b.keys) {
+		return nil
+	}
+	c := m.protocolClient()
+	method, name := b.method, b.keys[b.cursor].Key
+	b.selected = name
+	return func() tea.Msg {
+		value, err := c.GetKey(context.Background(), method, name)
+		if err != nil {
+			return keyValueMsg{method: method, key: name, err: err}
+		}
+		var indented bytes.Buffer
+		if json.Indent(&indented, value.Data, "", "  ") != nil {
+			indented.Write(value.Data)
+		}
+		return keyValueMsg{method: method, key: name, value: indented.String()}
+	}
+}
+
+func (m *Model) deleteKey() tea.Cmd {
+	b := m.browser
+	if b.cursor >= len(b.keys) {
+		return nil
+	}
+	c := m.protocolClient()
+	method, info := b.method, b.keys[b.cursor]
+	query := client.KeyQuery{Prefix: b.prefix.Value(), After: b.after, Limit: keyPageSize}
+	return func() tea.Msg {
+		if err := c.DeleteKey(context.Background(), method, info.Key, info.Revision); err != nil {
+			return keysMsg{method: method, err: err}
+		}
+		page, err := c.Keys(context.Background(), method, query)
+		return keysMsg{method: method, page: page, err: err}
+	}
+}
+
+func (m *Model) updateKeys(msg tea.Msg) (*Model, tea.Cmd) {
+	b := m.browser
+	switch msg := msg.(type) {
+	case tickMsg:
+		return m, tick()
+
+	case keysMsg:
+		if msg.method != b.method {
+			return m, nil
+		}
+		if msg.err != nil {
+			b.err = msg.err.Error()
+			return m, nil
+		}
+		b.err = ""
+		b.keys, b.next = msg.page.Keys, msg.page.Next
+		b.cursor = min(b.cursor, max(len(b.keys)-1, 0))
+		b.value = ""
+		return m, m.fetchKeyValue()
+
+	case keyValueMsg:
+		if msg.method != b.method || msg.key != b.selected {
+			return m, nil
+		}
+		switch {
+		case client.IsExpired(msg.err):
+			b.value = "(expired)"
+		case msg.err != nil:
+			b.value = msg.err.Error()
+		default:
+			b.value = msg.value
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		if b.prefix.Focused() {
+			switch msg.String() {
+			case "enter":
+				b.prefix.Blur()
+				b.pages, b.after, b.cursor = nil, "", 0
+				return m, m.fetchKeys()
+			case "esc":
+				b.prefix.Blur()
+				return m, nil
+			}
+			var cmd tea.Cmd
+			b.prefix, cmd = b.prefix.Update(msg)
+			return m, cmd
+		}
+
+		switch msg.String() {
+		case "ctrl+c":
+			return m, tea.Quit
+		case "esc", "b":
+			m.Mode = ManageMode
+			m.keys = manageKeys
+			m.browser = nil
+			return m, nil
+		case "/":
+			b.prefix.Focus()
+			return m, textinput.Blink
+		case "down", "j":
+			if b.cursor < len(b.keys)-1 {
+				b.cursor++
+				b.value = ""
+				return m, m.fetchKeyValue()
+			}
+		case "up", "k":
+			if b.cursor > 0 {
+				b.cursor--
+				b.value = ""
+				return m, m.fetchKeyValue()
+			}
+		case "right", "l", "pgdown":
+			if b.next != "" {
+				b.pages = append(b.pages, b.after)
+				b.after, b.cursor = b.next, 0
+				return m, m.fetchKeys()
+			}
+		case "left", "h", "pgup":
+			if len(b.pages) > 0 {
+				b.after = b.pages[len(b.pages)-1]
+				b.pages, b.cursor = b.pages[:len(b.pages)-1], 0
+				return m, m.fetchKeys()
+			}
+		case "d":
+			return m, m.deleteKey()
+		}
+	}
+	return m, nil
+}
+
+func (m Model) viewKeys() string {
+	b := m.browser
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("170")).
+		Padding(1, 0)
+	dimStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("243"))
+
+	title := titleStyle.Render(fmt.Sprintf("Keys of %s/%s", m.currentProtocol.AppName, b.method))
+	filter := dimStyle.Render("Prefix: ") + b.prefix.View() + "\n"
+	page := dimStyle.Render(fmt.Sprintf("Page %d", len(b.pages)+1))
+	if b.next != "" {
+		page += dimStyle.Render(" · more →")
+	}
+
+	list := ""
+	if len(b.keys) == 0 {
+		list = dimStyle.Render("\n  No keys stored\n")
+	}
+	now := time.Now()
+	for i, info := range b.keys {
+		prefix := "  "
+		style := lipgloss.NewStyle().Foreground(lipgloss.Color("green"))
+		if i == b.cursor {
+			prefix = "> "
+			style = style.Bold(true)
+		}
+		line := style.Render(prefix + info.Key)
+		detail := fmt.Sprintf("  rev %s · %s · %d entries", info.Revision, formatAge(now.Sub(info.Stored)), info.Entries)
+		if info.Expires != nil {
+			if now.Before(*info.Expires) {
+				detail += " · expires in " + info.Expires.Sub(now).Round(time.Second).String()
+			} else {
+				detail += " · expired"
+			}
+		}
+		list += "\n" + line + dimStyle.Render(detail)
+	}
+
+	value := ""
+	if b.value != "" {
+		lines := strings.Split(b.value, "\n")
+		if len(lines) > 12 {
+			lines = append(lines[:12], "…")
+		}
+		value = "\n\n" + lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("240")).
+			Padding(0, 1).
+			Render(strings.Join(lines, "\n"))
+	}
+
+	errLine := ""
+	if b.err != "" {
+		errLine = "\n" + lipgloss.NewStyle().Foreground(lipgloss.Color("red")).Render(b.err)
+	}
+
+	helpView := m.help.View(m.keys)
+
+	return lipgloss.NewStyle().
+		Padding(1, 2).
+		Render(title + "\n" + filter + page + "\n" + list + value + errLine + "\n\n" + helpView)
+}
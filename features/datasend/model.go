@@ -1,7 +1,18 @@
 package datasend
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"freeport/api"
+	"freeport/client"
+	"freeport/manifest"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
@@ -18,6 +29,7 @@ const (
 	SuccessMode
 	ManageMode
 	CreateMethodMode
+	KeysMode
 )
 
 type Field int
@@ -43,15 +55,24 @@ const (
 )
 
 type keyMap struct {
-	Create key.Binding
-	Submit key.Binding
-	Back   key.Binding
-	Quit   key.Binding
-	Next   key.Binding
-	Prev   key.Binding
-	Select key.Binding
-	Left   key.Binding
-	Right  key.Binding
+	Create   key.Binding
+	Submit   key.Binding
+	Back     key.Binding
+	Quit     key.Binding
+	Next     key.Binding
+	Prev     key.Binding
+	Select   key.Binding
+	Left     key.Binding
+	Right    key.Binding
+	Queue    key.Binding
+	Export   key.Binding
+	Generate key.Binding
+	Faster   key.Binding
+	Slower   key.Binding
+	Filter   key.Binding
+	NextPage key.Binding
+	PrevPage key.Binding
+	Delete   key.Binding
 }
 
 var menuKeys = keyMap{
@@ -59,6 +80,10 @@ var menuKeys = keyMap{
 		key.WithKeys("c"),
 		key.WithHelp("c", "create protocol"),
 	),
+	Export: key.NewBinding(
+		key.WithKeys("x"),
+		key.WithHelp("x", "export manifest"),
+	),
 	Select: key.NewBinding(
 		key.WithKeys("enter"),
 		key.WithHelp("enter", "select"),
@@ -120,6 +145,26 @@ var manageKeys = keyMap{
 		key.WithKeys("n"),
 		key.WithHelp("n", "new method"),
 	),
+	Queue: key.NewBinding(
+		key.WithKeys("u"),
+		key.WithHelp("u", "toggle queue mode"),
+	),
+	Generate: key.NewBinding(
+		key.WithKeys("g"),
+		key.WithHelp("g", "toggle generator"),
+	),
+	Faster: key.NewBinding(
+		key.WithKeys("+", "="),
+		key.WithHelp("+", "generate faster"),
+	),
+	Slower: key.NewBinding(
+		key.WithKeys("-"),
+		key.WithHelp("-", "generate slower"),
+	),
+	Select: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "browse keys"),
+	),
 	Back: key.NewBinding(
 		key.WithKeys("esc", "b"),
 		key.WithHelp("esc/b", "back"),
@@ -131,6 +176,15 @@ var manageKeys = keyMap{
 }
 
 func (k keyMap) ShortHelp() []key.Binding {
+	if k.Filter.Enabled() {
+		return []key.Binding{k.Filter, k.NextPage, k.PrevPage, k.Delete, k.Back}
+	}
+	if k.Queue.Enabled() {
+		return []key.Binding{k.Create, k.Queue, k.Generate, k.Select, k.Back, k.Quit}
+	}
+	if k.Export.Enabled() {
+		return []key.Binding{k.Create, k.Export, k.Back, k.Quit}
+	}
 	if k.Create.Enabled() {
 		return []key.Binding{k.Create, k.Back, k.Quit}
 	}
@@ -144,6 +198,26 @@ func (k keyMap) ShortHelp() []key.Binding {
 }
 
 func (k keyMap) FullHelp() [][]key.Binding {
+	if k.Filter.Enabled() {
+		return [][]key.Binding{
+			{k.Filter, k.Delete},
+			{k.NextPage, k.PrevPage},
+			{k.Back, k.Quit},
+		}
+	}
+	if k.Queue.Enabled() {
+		return [][]key.Binding{
+			{k.Create, k.Queue, k.Generate},
+			{k.Faster, k.Slower, k.Select},
+			{k.Back, k.Quit},
+		}
+	}
+	if k.Export.Enabled() {
+		return [][]key.Binding{
+			{k.Create, k.Export},
+			{k.Back, k.Quit},
+		}
+	}
 	if k.Create.Enabled() {
 		return [][]key.Binding{
 			{k.Create, k.Back, k.Quit},
@@ -191,6 +265,24 @@ type Model struct {
 	keys                  keyMap
 	focusedButton         FocusButton
 	selectedProtocolIndex int
+	selectedMethodIndex   int
+	latest                map[string]string
+	browser               *keyBrowser
+	bus                   *client.Client
+	exportPath            string
+}
+
+type tickMsg time.Time
+
+type latestMsg struct {
+	appName string
+	latest  map[string]string
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
 }
 
 func NewModel() *Model {
@@ -199,6 +291,7 @@ func NewModel() *Model {
 		help:      help.New(),
 		keys:      menuKeys,
 		protocols: []Protocol{},
+		bus:       client.New(client.DefaultBaseURL),
 	}
 
 	m.inputs = make([]textinput.Model, 3)
@@ -241,6 +334,63 @@ func (m *Model) SetProtocolCreatedCallback(fn func(Protocol)) {
 	m.onProtocolCreated = fn
 }
 
+// SetBaseURL points the screen at the bus, e.g. its Unix socket.
+func (m *Model) SetBaseURL(baseURL string) {
+	m.bus = client.New(baseURL)
+}
+
+// SetInProcess makes the screen call handler, the bus's InProcessHandler,
+// directly. It then needs no passkeys, and its polling stays out of the
+// Monitor, the logs and the rate limits.
+func (m *Model) SetInProcess(handler http.Handler) {
+	m.bus = client.NewHandler(handler)
+}
+
+// SetExportPath sets where the x key writes the manifest.
+func (m *Model) SetExportPath(path string) {
+	m.exportPath = path
+}
+
+// Refresh reloads the protocol list from the bus, picking up protocols
+// created by a manifest or through the admin API.
+func (m *Model) Refresh() {
+	passkeys := make(map[string]string, len(m.protocols))
+	for _, p := range m.protocols {
+		passkeys[p.AppName] = p.Passkey
+	}
+
+	infos := api.ListProtocols()
+	m.protocols = make([]Protocol, 0, len(infos))
+	for _, info := range infos {
+		protocol := Protocol{
+			AppName:     info.AppName,
+			Passkey:     passkeys[info.AppName],
+			Description: info.Description,
+		}
+		for _, method := range info.Methods {
+			protocol.Methods = append(protocol.Methods, CustomMethod{Name: method.Name, Description: method.Description})
+		}
+		m.protocols = append(m.protocols, protocol)
+	}
+	if m.selectedProtocolIndex >= len(m.protocols) {
+		m.selectedProtocolIndex = 0
+	}
+}
+
+func (m *Model) exportManifest() {
+	data, err := manifest.Encode(api.ExportManifest(false), manifest.FormatFor(m.exportPath))
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(m.exportPath), 0755); err == nil {
+			err = os.WriteFile(m.exportPath, data, 0644)
+		}
+	}
+	if err != nil {
+		m.statusMsg = fmt.Sprintf("Export failed: %v", err)
+		return
+	}
+	m.statusMsg = fmt.Sprintf("✓ Exported %d protocols to %s", len(m.protocols), m.exportPath)
+}
+
 func (m *Model) SetMethodCreatedCallback(fn func(string, string, string)) {
 	m.onMethodCreated = fn
 }
@@ -257,15 +407,24 @@ func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
 		return m.updateManage(msg)
 	case CreateMethodMode:
 		return m.updateCreateMethod(msg)
+	case KeysMode:
+		return m.updateKeys(msg)
 	}
 
 	return m, nil
 }
 
 func (m *Model) updateMenu(msg tea.Msg) (*Model, tea.Cmd) {
+	m.Refresh()
+
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
+		case "x":
+			if m.exportPath != "" {
+				m.exportManifest()
+			}
+			return m, nil
 		case "c":
 			m.Mode = CreateMode
 			m.keys = createKeys
@@ -278,7 +437,8 @@ func (m *Model) updateMenu(msg tea.Msg) (*Model, tea.Cmd) {
 				m.currentProtocol = &m.protocols[m.selectedProtocolIndex]
 				m.Mode = ManageMode
 				m.keys = manageKeys
-				return m, nil
+				m.selectedMethodIndex = 0
+				return m, tick()
 			}
 		case "down", "j":
 			if m.selectedProtocolIndex < len(m.protocols)-1 {
@@ -362,6 +522,8 @@ func (m *Model) updateSuccess(msg tea.Msg) (*Model, tea.Cmd) {
 			if m.focusedButton == OkButton {
 				m.Mode = ManageMode
 				m.keys = manageKeys
+				m.selectedMethodIndex = 0
+				return m, tick()
 			} else {
 				m.Mode = MenuMode
 				m.keys = menuKeys
@@ -375,6 +537,12 @@ func (m *Model) updateSuccess(msg tea.Msg) (*Model, tea.Cmd) {
 
 func (m *Model) updateManage(msg tea.Msg) (*Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tickMsg:
+		return m, tea.Batch(tick(), m.fetchLatest())
+	case latestMsg:
+		if m.currentProtocol != nil && msg.appName == m.currentProtocol.AppName {
+			m.latest = msg.latest
+		}
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c":
@@ -383,6 +551,7 @@ func (m *Model) updateManage(msg tea.Msg) (*Model, tea.Cmd) {
 			m.Mode = MenuMode
 			m.keys = menuKeys
 			m.currentProtocol = nil
+			m.latest = nil
 			return m, nil
 		case "n":
 			m.Mode = CreateMethodMode
@@ -390,11 +559,110 @@ func (m *Model) updateManage(msg tea.Msg) (*Model, tea.Cmd) {
 			m.focusIndex = 0
 			m.methodInputs[0].Focus()
 			return m, nil
+		case "down", "j":
+			if m.currentProtocol != nil && m.selectedMethodIndex < len(m.currentProtocol.Methods)-1 {
+				m.selectedMethodIndex++
+			}
+		case "up", "k":
+			if m.selectedMethodIndex > 0 {
+				m.selectedMethodIndex--
+			}
+		case "u":
+			if m.currentProtocol == nil || m.selectedMethodIndex >= len(m.currentProtocol.Methods) {
+				return m, nil
+			}
+			appName := m.currentProtocol.AppName
+			method := m.currentProtocol.Methods[m.selectedMethodIndex]
+			if method.Name == "init" {
+				m.statusMsg = "The init method cannot be queued"
+				return m, nil
+			}
+			if api.QueueEnabled(appName, method.Name) {
+				api.DisableQueue(appName, method.Name)
+				m.statusMsg = fmt.Sprintf("Queue mode disabled for '%s'", method.Name)
+			} else {
+				api.EnableQueue(appName, method.Name, api.DefaultVisibilityTimeout, api.DefaultMaxDeliveries, api.DefaultMaxDepth)
+				m.statusMsg = fmt.Sprintf("✓ Queue mode enabled for '%s'", method.Name)
+			}
+			return m, nil
+		case "enter":
+			return m, m.openKeys()
+		case "g":
+			m.toggleGenerator()
+			return m, nil
+		case "+", "=":
+			m.scaleGenerator(0.5)
+			return m, nil
+		case "-":
+			m.scaleGenerator(2)
+			return m, nil
 		}
 	}
 	return m, nil
 }
 
+// defaultTemplate is what g posts on a method without a schema.
+const defaultTemplate = `{"seq": "{{seq}}", "value": "{{random 0 100}}", "time": "{{now}}"}`
+
+func (m *Model) selectedMethod() (string, string, bool) {
+	if m.currentProtocol == nil || m.selectedMethodIndex >= len(m.currentProtocol.Methods) {
+		return "", "", false
+	}
+	return m.currentProtocol.AppName, m.currentProtocol.Methods[m.selectedMethodIndex].Name, true
+}
+
+// toggleGenerator stops the selected method's generator, or starts one that
+// follows the method's schema if it has one and a sample template if not.
+func (m *Model) toggleGenerator() {
+	appName, methodName, ok := m.selectedMethod()
+	if !ok {
+		return
+	}
+	if methodName == "init" {
+		m.statusMsg = "The init method cannot have a generator"
+		return
+	}
+
+	if status, exists := api.GetGenerator(appName, methodName); exists && status.Running {
+		api.StopGenerator(appName, methodName)
+		m.statusMsg = fmt.Sprintf("Generator stopped for '%s'", methodName)
+		return
+	}
+
+	config := api.GeneratorConfig{Mode: api.GenerateTemplate, Template: json.RawMessage(defaultTemplate)}
+	if api.MethodSchema(appName, methodName) != nil {
+		config = api.GeneratorConfig{Mode: api.GenerateSchema}
+	}
+	if _, err := api.StartGenerator(appName, methodName, config); err != nil {
+		m.statusMsg = fmt.Sprintf("Generator failed: %v", err)
+		return
+	}
+	m.statusMsg = fmt.Sprintf("✓ Generating %s payloads on '%s'", config.Mode, methodName)
+}
+
+// scaleGenerator multiplies the selected generator's interval by factor.
+func (m *Model) scaleGenerator(factor float64) {
+	appName, methodName, ok := m.selectedMethod()
+	if !ok {
+		return
+	}
+	status, exists := api.GetGenerator(appName, methodName)
+	if !exists || !status.Running {
+		return
+	}
+
+	current, _ := time.ParseDuration(status.Interval)
+	interval := time.Duration(float64(current) * factor)
+	if interval < api.MinGeneratorInterval {
+		interval = api.MinGeneratorInterval
+	}
+	if _, err := api.SetGeneratorInterval(appName, methodName, interval); err != nil {
+		m.statusMsg = fmt.Sprintf("Generator failed: %v", err)
+		return
+	}
+	m.statusMsg = fmt.Sprintf("Generating on '%s' every %s", methodName, interval)
+}
+
 func (m *Model) updateCreateMethod(msg tea.Msg) (*Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -526,6 +794,8 @@ func (m Model) View(width, height int) string {
 		return m.viewManage()
 	case CreateMethodMode:
 		return m.viewCreateMethod()
+	case KeysMode:
+		return m.viewKeys()
 	}
 	return ""
 }
@@ -617,7 +887,7 @@ func (m Model) viewCreate() string {
 		Foreground(lipgloss.Color("yellow")).
 		Italic(true)
 
-	note := noteStyle.Render("Note: Your protocol will be available at:\nGET http://localhost:6767/{app_name}/init\nHeaders: X-App-Name, X-Passkey")
+	note := noteStyle.Render("Note: Your protocol will be available at:\nGET http://localhost:6767/v1/{app_name}/init\nHeaders: X-App-Name, X-Passkey")
 
 	status := ""
 	if m.statusMsg != "" {
@@ -674,8 +944,8 @@ func (m Model) viewSuccess() string {
 	usage := usageStyle.Render("Usage:\n") +
 		lipgloss.NewStyle().
 			Foreground(lipgloss.Color("yellow")).
-			Render(fmt.Sprintf("curl -H \"X-App-Name: %s\" -H \"X-Passkey: [your-passkey]\" \\\n  http://localhost:6767/%s/init\n\n",
-				m.currentProtocol.AppName, m.currentProtocol.AppName))
+			Render(fmt.Sprintf("FREEPORT_PASSKEY=[your-passkey] freeport get %s <method>\n\n",
+				m.currentProtocol.AppName))
 
 	okStyle := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("0")).
@@ -737,6 +1007,11 @@ func (m Model) viewManage() string {
 
 	desc := descStyle.Render(m.currentProtocol.Description + "\n")
 
+	rejections := api.GetRejections(m.currentProtocol.AppName)
+	rejected := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("243")).
+		Render(fmt.Sprintf("Rejected: %d too large, %d rate limited\n", rejections.PayloadTooLarge, rejections.RateLimited))
+
 	headerStyle := lipgloss.NewStyle().
 		Bold(true).
 		Foreground(lipgloss.Color("229")).
@@ -745,17 +1020,55 @@ func (m Model) viewManage() string {
 	header := headerStyle.Render("API Methods")
 
 	methodsView := ""
-	for _, method := range m.currentProtocol.Methods {
+	for i, method := range m.currentProtocol.Methods {
+		prefix := "• "
+		if i == m.selectedMethodIndex {
+			prefix = "> "
+		}
 		methodsView += lipgloss.NewStyle().
 			Foreground(lipgloss.Color("green")).
 			Bold(true).
-			Render(fmt.Sprintf("\n• %s\n", method.Name))
+			Render(fmt.Sprintf("\n%s%s\n", prefix, method.Name))
 		methodsView += lipgloss.NewStyle().
 			Foreground(lipgloss.Color("243")).
 			Render(fmt.Sprintf("  %s\n", method.Description))
 		methodsView += lipgloss.NewStyle().
 			Foreground(lipgloss.Color("yellow")).
-			Render(fmt.Sprintf("  GET http://localhost:6767/%s/%s\n", m.currentProtocol.AppName, method.Name))
+			Render(fmt.Sprintf("  GET http://localhost:6767/v1/%s/%s\n", m.currentProtocol.AppName, method.Name))
+		if latest := m.latest[method.Name]; latest != "" {
+			methodsView += lipgloss.NewStyle().
+				Foreground(lipgloss.Color("243")).
+				Render(fmt.Sprintf("  Latest: %s\n", latest))
+		}
+		if stats, ok := api.GetQueueStats(m.currentProtocol.AppName, method.Name); ok {
+			methodsView += lipgloss.NewStyle().
+				Foreground(lipgloss.Color("229")).
+				Render(fmt.Sprintf("  Queue: %d ready, %d in flight, %d dead-lettered\n", stats.Depth, stats.InFlight, stats.DeadLetters))
+		}
+		if derived, ok := api.GetDerivation(m.currentProtocol.AppName, method.Name); ok {
+			line := fmt.Sprintf("  Derived: %s", derived.Expr)
+			if derived.LastError != "" {
+				line += " · " + derived.LastError
+			}
+			methodsView += lipgloss.NewStyle().
+				Foreground(lipgloss.Color("117")).
+				Render(line + "\n")
+		}
+		if generator, ok := api.GetGenerator(m.currentProtocol.AppName, method.Name); ok {
+			line := fmt.Sprintf("  Generator: %s every %s, %d sent", generator.Mode, generator.Interval, generator.Sent)
+			if generator.Rejected > 0 {
+				line += fmt.Sprintf(", %d rejected", generator.Rejected)
+			}
+			if !generator.Running {
+				line += " (stopped)"
+			}
+			if generator.LastError != "" {
+				line += " · " + generator.LastError
+			}
+			methodsView += lipgloss.NewStyle().
+				Foreground(lipgloss.Color("213")).
+				Render(line + "\n")
+		}
 	}
 
 	status := ""
@@ -769,7 +1082,76 @@ func (m Model) viewManage() string {
 
 	return lipgloss.NewStyle().
 		Padding(1, 2).
-		Render(title + "\n" + desc + "\n" + header + methodsView + status + "\n\n" + helpView)
+		Render(title + "\n" + desc + rejected + "\n" + header + methodsView + status + "\n\n" + helpView)
+}
+
+// fetchLatest reads the latest value of every method through the bus, the
+// same way the protocol's own clients would see it.
+func (m *Model) fetchLatest() tea.Cmd {
+	if m.currentProtocol == nil {
+		return nil
+	}
+	protocol := *m.currentProtocol
+	c := m.protocolClient()
+
+	return func() tea.Msg {
+		latest := make(map[string]string)
+		for _, method := range protocol.Methods {
+			if method.Name == "init" {
+				continue
+			}
+			raw, err := c.GetRaw(context.Background(), method.Name)
+			if client.IsExpired(err) {
+				latest[method.Name] = "expired"
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			latest[method.Name] = describeLatest(raw)
+			if !raw.Stored.IsZero() {
+				latest[method.Name] += " · " + formatAge(time.Since(raw.Stored))
+			}
+		}
+		return latestMsg{appName: protocol.AppName, latest: latest}
+	}
+}
+
+// formatAge reads like "12s ago", in the largest unit that fits.
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds ago", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+}
+
+func describeLatest(raw *client.Raw) string {
+	size := api.FormatSize(int64(len(raw.Body)))
+
+	mediaType, _, _ := mime.ParseMediaType(raw.ContentType)
+	if mediaType != "application/json" {
+		blob := &api.Blob{ContentType: raw.ContentType, Bytes: raw.Body}
+		desc := fmt.Sprintf("%s %s", size, raw.ContentType)
+		if preview := blob.Preview(40); preview != "" {
+			desc += " · " + preview
+		}
+		return desc
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw.Body); err != nil {
+		return size
+	}
+	preview := compact.String()
+	if len(preview) > 40 {
+		preview = preview[:40] + "…"
+	}
+	return fmt.Sprintf("%s · %s", size, preview)
 }
 
 func (m Model) viewCreateMethod() string {
@@ -807,7 +1189,7 @@ func (m Model) viewCreateMethod() string {
 		Foreground(lipgloss.Color("yellow")).
 		Italic(true)
 
-	note := noteStyle.Render(fmt.Sprintf("Your method will be available at:\nGET http://localhost:6767/%s/{method_name}", m.currentProtocol.AppName))
+	note := noteStyle.Render(fmt.Sprintf("Your method will be available at:\nGET http://localhost:6767/v1/%s/{method_name}", m.currentProtocol.AppName))
 
 	status := ""
 	if m.statusMsg != "" {
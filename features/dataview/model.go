@@ -1,12 +1,13 @@
 package dataview
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
+	"strconv"
 	"time"
 
+	"freeport/client"
+
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/table"
@@ -65,6 +66,7 @@ type Model struct {
 	loading     bool
 	lastQueried string
 	errorMsg    string
+	client      *client.Client
 }
 
 func NewModel() *Model {
@@ -107,30 +109,25 @@ func NewModel() *Model {
 		Keys:    keys,
 		Input:   ti,
 		loading: false,
+		client:  client.New(client.DefaultBaseURL),
 	}
 }
 
-func queryBatteryData() tea.Msg {
-	resp, err := http.Get("http://localhost:6767/system/battery")
-	if err != nil {
-		return batteryDataMsg{err: err}
-	}
-	defer resp.Body.Close()
+// SetBaseURL points the screen at the bus, e.g. its Unix socket.
+func (m *Model) SetBaseURL(baseURL string) {
+	m.client = client.New(baseURL)
+}
 
-	body, err := io.ReadAll(resp.Body)
+func (m *Model) queryBatteryData() tea.Msg {
+	data, err := m.client.Battery(context.Background())
 	if err != nil {
 		return batteryDataMsg{err: err}
 	}
 
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return batteryDataMsg{err: err}
-	}
-
 	return batteryDataMsg{
-		time:    data["time"].(string),
-		battery: fmt.Sprintf("%.0f%%", data["battery"].(float64)),
-		appName: data["app_name"].(string),
+		time:    data.Time.Format(time.RFC3339),
+		battery: strconv.Itoa(data.Battery) + "%",
+		appName: data.AppName,
 		err:     nil,
 	}
 }
@@ -141,7 +138,7 @@ func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
 		if msg.String() == "enter" && !m.loading {
 			m.loading = true
 			m.errorMsg = ""
-			return m, queryBatteryData
+			return m, m.queryBatteryData
 		}
 	case batteryDataMsg:
 		m.loading = false
@@ -0,0 +1,230 @@
+package logs
+
+import (
+	"fmt"
+	"freeport/api"
+	"time"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var baseStyle = lipgloss.NewStyle().
+	BorderStyle(lipgloss.NormalBorder()).
+	BorderForeground(lipgloss.Color("240"))
+
+type Tab int
+
+const (
+	AccessTab Tab = iota
+	AuditTab
+)
+
+type keyMap struct {
+	Switch key.Binding
+	Up     key.Binding
+	Down   key.Binding
+	Back   key.Binding
+	Quit   key.Binding
+}
+
+var keys = keyMap{
+	Switch: key.NewBinding(
+		key.WithKeys("tab"),
+		key.WithHelp("tab", "access/audit"),
+	),
+	Up: key.NewBinding(
+		key.WithKeys("up", "k"),
+		key.WithHelp("↑/k", "up"),
+	),
+	Down: key.NewBinding(
+		key.WithKeys("down", "j"),
+		key.WithHelp("↓/j", "down"),
+	),
+	Back: key.NewBinding(
+		key.WithKeys("esc", "b"),
+		key.WithHelp("esc/b", "back"),
+	),
+	Quit: key.NewBinding(
+		key.WithKeys("ctrl+c"),
+		key.WithHelp("ctrl+c", "quit"),
+	),
+}
+
+func (k keyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Switch, k.Up, k.Down, k.Back, k.Quit}
+}
+
+func (k keyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Switch, k.Up, k.Down},
+		{k.Back, k.Quit},
+	}
+}
+
+type tickMsg time.Time
+
+func tick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
+}
+
+type Model struct {
+	Table table.Model
+	Help  help.Model
+	Keys  keyMap
+	Tab   Tab
+}
+
+func NewModel() *Model {
+	t := table.New(
+		table.WithFocused(true),
+		table.WithHeight(15),
+	)
+
+	s := table.DefaultStyles()
+	s.Header = s.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color("240")).
+		BorderBottom(true).
+		Bold(false)
+	s.Selected = s.Selected.
+		Foreground(lipgloss.Color("229")).
+		Background(lipgloss.Color("57")).
+		Bold(false)
+	t.SetStyles(s)
+
+	m := &Model{
+		Table: t,
+		Help:  help.New(),
+		Keys:  keys,
+		Tab:   AccessTab,
+	}
+	m.refresh()
+	return m
+}
+
+func (m *Model) Init() tea.Cmd {
+	m.refresh()
+	return tick()
+}
+
+func (m *Model) refresh() {
+	if m.Tab == AccessTab {
+		m.Table.SetRows(nil)
+		m.Table.SetColumns([]table.Column{
+			{Title: "Time", Width: 8},
+			{Title: "Method", Width: 7},
+			{Title: "Path", Width: 28},
+			{Title: "App", Width: 12},
+			{Title: "Status", Width: 6},
+			{Title: "Latency", Width: 9},
+			{Title: "Bytes", Width: 8},
+			{Title: "Source", Width: 21},
+		})
+
+		entries := api.RecentAccessLog(200)
+		rows := make([]table.Row, 0, len(entries))
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			rows = append(rows, table.Row{
+				e.Time.Format("15:04:05"),
+				e.Method,
+				e.Path,
+				e.App,
+				fmt.Sprintf("%d", e.Status),
+				fmt.Sprintf("%.1fms", e.LatencyMs),
+				api.FormatSize(e.Bytes),
+				e.Source,
+			})
+		}
+		m.Table.SetRows(rows)
+		return
+	}
+
+	m.Table.SetRows(nil)
+	m.Table.SetColumns([]table.Column{
+		{Title: "Time", Width: 8},
+		{Title: "Event", Width: 16},
+		{Title: "App", Width: 12},
+		{Title: "Method", Width: 12},
+		{Title: "Detail", Width: 30},
+		{Title: "Source", Width: 21},
+	})
+
+	events := api.RecentAuditLog(200)
+	rows := make([]table.Row, 0, len(events))
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		rows = append(rows, table.Row{
+			e.Time.Format("15:04:05"),
+			e.Kind,
+			e.App,
+			e.Method,
+			e.Detail,
+			e.Source,
+		})
+	}
+	m.Table.SetRows(rows)
+}
+
+func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tickMsg:
+		m.refresh()
+		return m, tick()
+	case tea.KeyMsg:
+		if msg.String() == "tab" {
+			if m.Tab == AccessTab {
+				m.Tab = AuditTab
+			} else {
+				m.Tab = AccessTab
+			}
+			m.refresh()
+			m.Table.GotoTop()
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.Table, cmd = m.Table.Update(msg)
+	return m, cmd
+}
+
+func (m Model) View(width, height int) string {
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("170")).
+		Padding(1, 0)
+
+	activeTab := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("229")).
+		Underline(true)
+
+	inactiveTab := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("243"))
+
+	title := titleStyle.Render("Logs")
+
+	var tabs string
+	if m.Tab == AccessTab {
+		tabs = activeTab.Render("Access Log") + "   " + inactiveTab.Render("Audit Trail")
+	} else {
+		tabs = inactiveTab.Render("Access Log") + "   " + activeTab.Render("Audit Trail")
+	}
+
+	info := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("243")).
+		Render(fmt.Sprintf("\n%d entries, newest first\n", len(m.Table.Rows())))
+
+	helpView := m.Help.View(m.Keys)
+
+	return lipgloss.NewStyle().
+		Padding(1, 2).
+		Render(title + "\n" + tabs + "\n" + info + "\n" + baseStyle.Render(m.Table.View()) + "\n\n" + helpView)
+}
@@ -0,0 +1,336 @@
+package monitor
+
+import (
+	"fmt"
+	"freeport/api"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const maxEvents = 500
+
+var baseStyle = lipgloss.NewStyle().
+	BorderStyle(lipgloss.NormalBorder()).
+	BorderForeground(lipgloss.Color("240"))
+
+type keyMap struct {
+	Pause  key.Binding
+	Filter key.Binding
+	Detail key.Binding
+	Clear  key.Binding
+	Back   key.Binding
+	Quit   key.Binding
+	Apply  key.Binding
+	Cancel key.Binding
+}
+
+var NormalKeys = keyMap{
+	Pause: key.NewBinding(
+		key.WithKeys("p", " "),
+		key.WithHelp("p/space", "pause"),
+	),
+	Filter: key.NewBinding(
+		key.WithKeys("f"),
+		key.WithHelp("f", "filter by app"),
+	),
+	Detail: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "details"),
+	),
+	Clear: key.NewBinding(
+		key.WithKeys("c"),
+		key.WithHelp("c", "clear"),
+	),
+	Back: key.NewBinding(
+		key.WithKeys("esc", "b"),
+		key.WithHelp("esc/b", "back"),
+	),
+	Quit: key.NewBinding(
+		key.WithKeys("ctrl+c"),
+		key.WithHelp("ctrl+c", "quit"),
+	),
+}
+
+var FilterKeys = keyMap{
+	Apply: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "apply"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "cancel"),
+	),
+	Quit: key.NewBinding(
+		key.WithKeys("ctrl+c"),
+		key.WithHelp("ctrl+c", "quit"),
+	),
+}
+
+func (k keyMap) ShortHelp() []key.Binding {
+	if k.Pause.Enabled() {
+		return []key.Binding{k.Pause, k.Filter, k.Detail, k.Clear, k.Back}
+	}
+	return []key.Binding{k.Apply, k.Cancel}
+}
+
+func (k keyMap) FullHelp() [][]key.Binding {
+	if k.Pause.Enabled() {
+		return [][]key.Binding{
+			{k.Pause, k.Filter, k.Detail},
+			{k.Clear, k.Back, k.Quit},
+		}
+	}
+	return [][]key.Binding{
+		{k.Apply, k.Cancel, k.Quit},
+	}
+}
+
+// EventMsg carries a request observed by the API server. The root model
+// forwards it here whichever screen is showing so the feed never stalls.
+type EventMsg api.TrafficEvent
+
+type Model struct {
+	Table      table.Model
+	Help       help.Model
+	Keys       keyMap
+	Input      textinput.Model
+	Filtering  bool
+	feed       <-chan api.TrafficEvent
+	events     []api.TrafficEvent
+	visible    []api.TrafficEvent
+	paused     bool
+	missed     int
+	filter     string
+	showDetail bool
+}
+
+func NewModel() *Model {
+	columns := []table.Column{
+		{Title: "Time", Width: 8},
+		{Title: "Verb", Width: 6},
+		{Title: "App", Width: 12},
+		{Title: "Method", Width: 14},
+		{Title: "Status", Width: 6},
+		{Title: "Latency", Width: 9},
+		{Title: "Payload", Width: 36},
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithFocused(true),
+		table.WithHeight(12),
+	)
+
+	s := table.DefaultStyles()
+	s.Header = s.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color("240")).
+		BorderBottom(true).
+		Bold(false)
+	s.Selected = s.Selected.
+		Foreground(lipgloss.Color("229")).
+		Background(lipgloss.Color("57")).
+		Bold(false)
+	t.SetStyles(s)
+
+	ti := textinput.New()
+	ti.Placeholder = "app name (empty for all)"
+	ti.CharLimit = 50
+	ti.Width = 30
+
+	feed, _ := api.SubscribeTraffic(256)
+
+	return &Model{
+		Table: t,
+		Help:  help.New(),
+		Keys:  NormalKeys,
+		Input: ti,
+		feed:  feed,
+	}
+}
+
+func (m *Model) Init() tea.Cmd {
+	return m.waitForEvent()
+}
+
+func (m *Model) waitForEvent() tea.Cmd {
+	feed := m.feed
+	return func() tea.Msg {
+		event, ok := <-feed
+		if !ok {
+			return nil
+		}
+		return EventMsg(event)
+	}
+}
+
+func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case EventMsg:
+		m.events = append(m.events, api.TrafficEvent(msg))
+		if len(m.events) > maxEvents {
+			m.events = m.events[1:]
+		}
+		if m.paused {
+			m.missed++
+		} else {
+			m.refresh()
+		}
+		return m, m.waitForEvent()
+
+	case tea.KeyMsg:
+		if m.Filtering {
+			switch msg.String() {
+			case "enter":
+				m.filter = strings.TrimSpace(m.Input.Value())
+				m.stopFiltering()
+				m.refresh()
+				return m, nil
+			case "esc":
+				m.stopFiltering()
+				return m, nil
+			}
+			var cmd tea.Cmd
+			m.Input, cmd = m.Input.Update(msg)
+			return m, cmd
+		}
+
+		switch msg.String() {
+		case "p", " ":
+			m.paused = !m.paused
+			if !m.paused {
+				m.missed = 0
+				m.refresh()
+			}
+			return m, nil
+		case "f":
+			m.Filtering = true
+			m.Keys = FilterKeys
+			m.Input.SetValue(m.filter)
+			return m, m.Input.Focus()
+		case "enter":
+			m.showDetail = !m.showDetail
+			return m, nil
+		case "c":
+			m.events = nil
+			m.missed = 0
+			m.refresh()
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.Table, cmd = m.Table.Update(msg)
+	return m, cmd
+}
+
+func (m *Model) stopFiltering() {
+	m.Filtering = false
+	m.Keys = NormalKeys
+	m.Input.Blur()
+}
+
+func (m *Model) refresh() {
+	m.visible = m.visible[:0]
+	rows := []table.Row{}
+	for i := len(m.events) - 1; i >= 0; i-- {
+		e := m.events[i]
+		if m.filter != "" && e.App != m.filter {
+			continue
+		}
+		payload := e.RequestPreview
+		if payload == "" {
+			payload = e.ResponsePreview
+		}
+		m.visible = append(m.visible, e)
+		rows = append(rows, table.Row{
+			e.Time.Format("15:04:05"),
+			e.Verb,
+			e.App,
+			e.Method,
+			fmt.Sprintf("%d", e.Status),
+			fmt.Sprintf("%.1fms", float64(e.Latency.Microseconds())/1000),
+			singleLine(payload, 36),
+		})
+	}
+	m.Table.SetRows(rows)
+}
+
+func singleLine(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len([]rune(s)) > n {
+		return string([]rune(s)[:n-1]) + "…"
+	}
+	return s
+}
+
+func (m Model) viewDetail() string {
+	cursor := m.Table.Cursor()
+	if cursor < 0 || cursor >= len(m.visible) {
+		return ""
+	}
+	e := m.visible[cursor]
+
+	labelStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("243"))
+
+	detail := fmt.Sprintf("%s %s → %d in %s\n", e.Verb, e.Path, e.Status, e.Latency)
+	if strings.HasPrefix(e.Source, api.ReplaySourcePrefix) {
+		detail = fmt.Sprintf("%s %s (replayed by the bus, not a request)\n", e.Verb, e.Path)
+	}
+	detail += labelStyle.Render(fmt.Sprintf("From %s at %s", e.Source, e.Time.Format("15:04:05.000"))) + "\n\n"
+	detail += labelStyle.Render(fmt.Sprintf("Request (%s):", api.FormatSize(e.RequestBytes))) + "\n"
+	detail += singleLine(e.RequestPreview, 200) + "\n\n"
+	detail += labelStyle.Render(fmt.Sprintf("Response (%s):", api.FormatSize(e.ResponseBytes))) + "\n"
+	detail += singleLine(e.ResponsePreview, 200)
+
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("240")).
+		Padding(0, 1).
+		Width(80).
+		Render(detail)
+}
+
+func (m Model) View(width, height int) string {
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("170")).
+		Padding(1, 0)
+
+	title := titleStyle.Render("Monitor - Live Traffic")
+
+	state := fmt.Sprintf("%d requests", len(m.visible))
+	if m.filter != "" {
+		state += fmt.Sprintf(" from '%s'", m.filter)
+	}
+	stateStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("243"))
+	if m.paused {
+		state += fmt.Sprintf(" — PAUSED (%d new)", m.missed)
+		stateStyle = stateStyle.Foreground(lipgloss.Color("yellow"))
+	}
+	status := stateStyle.Render(state) + "\n"
+
+	filter := ""
+	if m.Filtering {
+		filter = "\nFilter by app:\n" + m.Input.View() + "\n"
+	}
+
+	detail := ""
+	if m.showDetail {
+		detail = "\n" + m.viewDetail()
+	}
+
+	helpView := m.Help.View(m.Keys)
+
+	return lipgloss.NewStyle().
+		Padding(1, 2).
+		Render(title + "\n" + status + filter + "\n" + baseStyle.Render(m.Table.View()) + detail + "\n\n" + helpView)
+}
@@ -0,0 +1,313 @@
+package peers
+
+import (
+	"fmt"
+	"freeport/api"
+	"freeport/discovery"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var baseStyle = lipgloss.NewStyle().
+	BorderStyle(lipgloss.NormalBorder()).
+	BorderForeground(lipgloss.Color("240"))
+
+type Tab int
+
+const (
+	InstancesTab Tab = iota
+	LinksTab
+)
+
+type keyMap struct {
+	Switch  key.Binding
+	Refresh key.Binding
+	Up      key.Binding
+	Down    key.Binding
+	Back    key.Binding
+	Quit    key.Binding
+}
+
+var keys = keyMap{
+	Switch: key.NewBinding(
+		key.WithKeys("tab"),
+		key.WithHelp("tab", "instances/links"),
+	),
+	Refresh: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("r", "browse now"),
+	),
+	Up: key.NewBinding(
+		key.WithKeys("up", "k"),
+		key.WithHelp("↑/k", "up"),
+	),
+	Down: key.NewBinding(
+		key.WithKeys("down", "j"),
+		key.WithHelp("↓/j", "down"),
+	),
+	Back: key.NewBinding(
+		key.WithKeys("esc", "b"),
+		key.WithHelp("esc/b", "back"),
+	),
+	Quit: key.NewBinding(
+		key.WithKeys("ctrl+c"),
+		key.WithHelp("ctrl+c", "quit"),
+	),
+}
+
+func (k keyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Switch, k.Refresh, k.Up, k.Down, k.Back, k.Quit}
+}
+
+func (k keyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Switch, k.Refresh, k.Up, k.Down},
+		{k.Back, k.Quit},
+	}
+}
+
+type tickMsg time.Time
+
+func tick() tea.Cmd {
+	return tea.Tick(2*time.Second, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
+}
+
+type Model struct {
+	Table      table.Model
+	Help       help.Model
+	Keys       keyMap
+	Tab        Tab
+	browser    *discovery.Browser
+	federation *api.Federation
+	peers      []discovery.Peer
+	links      []api.LinkStatus
+}
+
+// NewModel shows the peers found by browser and the state of the links in
+// federation. Either may be nil when it is turned off in the config.
+func NewModel(browser *discovery.Browser, federation *api.Federation) *Model {
+	t := table.New(
+		table.WithFocused(true),
+		table.WithHeight(12),
+	)
+
+	s := table.DefaultStyles()
+	s.Header = s.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color("240")).
+		BorderBottom(true).
+		Bold(false)
+	s.Selected = s.Selected.
+		Foreground(lipgloss.Color("229")).
+		Background(lipgloss.Color("57")).
+		Bold(false)
+	t.SetStyles(s)
+
+	return &Model{
+		Table:      t,
+		Help:       help.New(),
+		Keys:       keys,
+		Tab:        InstancesTab,
+		browser:    browser,
+		federation: federation,
+	}
+}
+
+func (m *Model) Init() tea.Cmd {
+	m.refresh()
+	return tick()
+}
+
+func (m *Model) refresh() {
+	if m.Tab == LinksTab {
+		m.refreshLinks()
+		return
+	}
+
+	m.Table.SetRows(nil)
+	m.Table.SetColumns([]table.Column{
+		{Title: "Instance", Width: 20},
+		{Title: "Address", Width: 24},
+		{Title: "Version", Width: 9},
+		{Title: "Protocols", Width: 30},
+		{Title: "Seen", Width: 8},
+	})
+	if m.browser == nil {
+		return
+	}
+
+	m.peers = m.browser.Peers()
+	rows := make([]table.Row, 0, len(m.peers))
+	for _, peer := range m.peers {
+		name := peer.Name
+		if peer.Self {
+			name += " (this)"
+		}
+		rows = append(rows, table.Row{
+			name,
+			strings.TrimPrefix(peer.URL(), "http://"),
+			peer.Version,
+			strings.Join(peer.Protocols, ", "),
+			peer.LastSeen.Format("15:04:05"),
+		})
+	}
+	m.Table.SetRows(rows)
+}
+
+func (m *Model) refreshLinks() {
+	m.Table.SetRows(nil)
+	m.Table.SetColumns([]table.Column{
+		{Title: "Link", Width: 14},
+		{Title: "State", Width: 6},
+		{Title: "Mirror", Width: 24},
+		{Title: "Sent", Width: 7},
+		{Title: "Pending", Width: 7},
+		{Title: "Failed", Width: 7},
+		{Title: "Last Sent", Width: 9},
+	})
+	if m.federation == nil {
+		return
+	}
+
+	m.links = m.federation.Links()
+	rows := make([]table.Row, 0, len(m.links))
+	for _, link := range m.links {
+		lastSent := "-"
+		if !link.LastSent.IsZero() {
+			lastSent = link.LastSent.Format("15:04:05")
+		}
+		rows = append(rows, table.Row{
+			link.Name,
+			link.State,
+			strings.Join(link.Mirror, ", "),
+			fmt.Sprintf("%d", link.Sent),
+			fmt.Sprintf("%d", link.Pending),
+			fmt.Sprintf("%d", link.Failed+link.Dropped),
+			lastSent,
+		})
+	}
+	m.Table.SetRows(rows)
+}
+
+func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tickMsg:
+		m.refresh()
+		return m, tick()
+	case tea.KeyMsg:
+		if msg.String() == "tab" {
+			if m.Tab == InstancesTab {
+				m.Tab = LinksTab
+			} else {
+				m.Tab = InstancesTab
+			}
+			m.refresh()
+			m.Table.GotoTop()
+			return m, nil
+		}
+		if msg.String() == "r" && m.Tab == InstancesTab && m.browser != nil {
+			m.browser.Refresh()
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.Table, cmd = m.Table.Update(msg)
+	return m, cmd
+}
+
+func (m Model) View(width, height int) string {
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("170")).
+		Padding(1, 0)
+
+	activeTab := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("229")).
+		Underline(true)
+
+	inactiveTab := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("243"))
+
+	title := titleStyle.Render("Peers")
+
+	var tabs string
+	if m.Tab == InstancesTab {
+		tabs = activeTab.Render("Instances") + "   " + inactiveTab.Render("Links")
+	} else {
+		tabs = inactiveTab.Render("Instances") + "   " + activeTab.Render("Links")
+	}
+
+	infoStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("243"))
+
+	helpView := m.Help.View(m.Keys)
+
+	if m.Tab == LinksTab {
+		return m.viewLinks(title+"\n"+tabs, infoStyle, helpView)
+	}
+
+	if m.browser == nil {
+		info := infoStyle.Render("\nDiscovery is off. Set discovery.browse to true in the config file\nto look for other freeport instances on the network.\n")
+		return lipgloss.NewStyle().
+			Padding(1, 2).
+			Render(title + "\n" + tabs + "\n" + info + "\n" + helpView)
+	}
+
+	info := infoStyle.Render(fmt.Sprintf("\n%d freeport instances found via %s\n", len(m.peers), discovery.ServiceType))
+
+	detail := ""
+	if i := m.Table.Cursor(); i >= 0 && i < len(m.peers) {
+		detail = "\n" + lipgloss.NewStyle().
+			Foreground(lipgloss.Color("yellow")).
+			Render(fmt.Sprintf("freeport get <app> <method> --url %s", m.peers[i].URL()))
+	}
+
+	return lipgloss.NewStyle().
+		Padding(1, 2).
+		Render(title + "\n" + tabs + "\n" + info + "\n" + baseStyle.Render(m.Table.View()) + detail + "\n\n" + helpView)
+}
+
+func (m Model) viewLinks(header string, infoStyle lipgloss.Style, helpView string) string {
+	if m.federation == nil {
+		info := infoStyle.Render("\nFederation is off. Add federation.links to the config file to mirror\nprotocols to other instances, and federation.token to accept theirs.\n")
+		return lipgloss.NewStyle().
+			Padding(1, 2).
+			Render(header + "\n" + info + "\n" + helpView)
+	}
+
+	info := infoStyle.Render(fmt.Sprintf("\nThis node is %s with %d links\n", m.federation.Node(), len(m.links)))
+
+	detail := ""
+	if i := m.Table.Cursor(); i >= 0 && i < len(m.links) {
+		link := m.links[i]
+		text := link.URL
+		if link.Peer != "" {
+			text += " (" + link.Peer + ")"
+		}
+		if link.Looped > 0 || link.Dropped > 0 {
+			text += fmt.Sprintf("  looped %d, dropped %d", link.Looped, link.Dropped)
+		}
+		detail = "\n" + lipgloss.NewStyle().
+			Foreground(lipgloss.Color("yellow")).
+			Render(text)
+		if link.LastError != "" {
+			detail += "\n" + lipgloss.NewStyle().
+				Foreground(lipgloss.Color("196")).
+				Render(link.LastError)
+		}
+	}
+
+	return lipgloss.NewStyle().
+		Padding(1, 2).
+		Render(header + "\n" + info + "\n" + baseStyle.Render(m.Table.View()) + detail + "\n\n" + helpView)
+}
@@ -1,6 +1,8 @@
 package settings
 
 import (
+	"strings"
+
 	"freeport/config"
 
 	"github.com/charmbracelet/bubbles/help"
@@ -18,6 +20,7 @@ const (
 
 type keyMap struct {
 	Edit key.Binding
+	Reveal key.Binding
 	Back key.Binding
 	Quit key.Binding
 	Save key.Binding
@@ -29,6 +32,10 @@ var NormalKeys = keyMap{
 		key.WithKeys("e"),
 		key.WithHelp("e", "edit welcome message"),
 	),
+	Reveal: key.NewBinding(
+		key.WithKeys("t"),
+		key.WithHelp("t", "show/hide admin token"),
+	),
 	Back: key.NewBinding(
 		key.WithKeys("esc", "b"),
 		key.WithHelp("esc/b", "back"),
@@ -56,7 +63,7 @@ var EditKeys = keyMap{
 
 func (k keyMap) ShortHelp() []key.Binding {
 	if k.Edit.Enabled() {
-		return []key.Binding{k.Edit, k.Back, k.Quit}
+		return []key.Binding{k.Edit, k.Reveal, k.Back, k.Quit}
 	}
 	return []key.Binding{k.Save, k.Cancel}
 }
@@ -64,7 +71,7 @@ func (k keyMap) ShortHelp() []key.Binding {
 func (k keyMap) FullHelp() [][]key.Binding {
 	if k.Edit.Enabled() {
 		return [][]key.Binding{
-			{k.Edit, k.Back},
+			{k.Edit, k.Reveal, k.Back},
 			{k.Quit},
 		}
 	}
@@ -80,6 +87,7 @@ type Model struct {
 	Help help.Model
 	Keys keyMap
 	StatusMsg string
+	ShowToken bool
 }
 
 func NewModel(cfg *config.Config) *Model {
@@ -117,6 +125,18 @@ func (m Model) View(width, height int) string {
 			Foreground(lipgloss.Color("229")).
 			Render("\"" + m.Config.WelcomeMessage + "\""))
 
+	token := currentStyle.Render("Admin Token (X-Admin-Token):\n" +
+		lipgloss.NewStyle().
+			Foreground(lipgloss.Color("229")).
+			Render(m.token()))
+
+	if m.Config.Server.Socket.Path != "" {
+		token += currentStyle.Render("Unix Socket:\n" +
+			lipgloss.NewStyle().
+				Foreground(lipgloss.Color("229")).
+				Render(m.Config.Server.Socket.Path))
+	}
+
 	var content string
 	if m.Mode == EditMode {
 		editStyle := lipgloss.NewStyle().
@@ -138,5 +158,13 @@ func (m Model) View(width, height int) string {
 
 	return lipgloss.NewStyle().
 		Padding(1, 2).
-		Render(title + "\n" + current + content + status + "\n\n" + helpView)
-}
\ No newline at end of file
+		Render(title + "\n" + current + token + content + status + "\n\n" + helpView)
+}
+// token is the admin token as the screen shows it: hidden unless the user
+// has asked to see it.
+func (m Model) token() string {
+	if m.ShowToken || m.Config.AdminToken == "" {
+		return m.Config.AdminToken
+	}
+	return strings.Repeat("•", 12) + " (press t to show)"
+}
@@ -0,0 +1,301 @@
+package snapshots
+
+import (
+	"fmt"
+	"freeport/api"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var baseStyle = lipgloss.NewStyle().
+	BorderStyle(lipgloss.NormalBorder()).
+	BorderForeground(lipgloss.Color("240"))
+
+type keyMap struct {
+	Take    key.Binding
+	Merge   key.Binding
+	Replace key.Binding
+	Up      key.Binding
+	Down    key.Binding
+	Back    key.Binding
+	Quit    key.Binding
+}
+
+var keys = keyMap{
+	Take: key.NewBinding(
+		key.WithKeys("s"),
+		key.WithHelp("s", "take snapshot"),
+	),
+	Merge: key.NewBinding(
+		key.WithKeys("m"),
+		key.WithHelp("m", "merge into bus"),
+	),
+	Replace: key.NewBinding(
+		key.WithKeys("R"),
+		key.WithHelp("R", "replace bus"),
+	),
+	Up: key.NewBinding(
+		key.WithKeys("up", "k"),
+		key.WithHelp("↑/k", "up"),
+	),
+	Down: key.NewBinding(
+		key.WithKeys("down", "j"),
+		key.WithHelp("↓/j", "down"),
+	),
+	Back: key.NewBinding(
+		key.WithKeys("esc", "b"),
+		key.WithHelp("esc/b", "back"),
+	),
+	Quit: key.NewBinding(
+		key.WithKeys("ctrl+c"),
+		key.WithHelp("ctrl+c", "quit"),
+	),
+}
+
+func (k keyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Take, k.Merge, k.Replace, k.Up, k.Down, k.Back, k.Quit}
+}
+
+func (k keyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Take, k.Merge, k.Replace},
+		{k.Up, k.Down, k.Back, k.Quit},
+	}
+}
+
+type tickMsg time.Time
+
+func tick() tea.Cmd {
+	return tea.Tick(2*time.Second, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
+}
+
+type file struct {
+	name     string
+	size     int64
+	modified time.Time
+}
+
+type Model struct {
+	Table table.Model
+	Help  help.Model
+	Keys  keyMap
+	// Confirming is set while a replace waits for y/n, so esc cancels it
+	// instead of leaving the screen.
+	Confirming bool
+	dir        string
+	files      []file
+	statusMsg  string
+	isError    bool
+}
+
+// NewModel lists the snapshot archives in dir, which is created on the
+// first snapshot.
+func NewModel(dir string) *Model {
+	t := table.New(
+		table.WithColumns([]table.Column{
+			{Title: "Archive", Width: 34},
+			{Title: "Taken", Width: 19},
+			{Title: "Size", Width: 10},
+		}),
+		table.WithFocused(true),
+		table.WithHeight(12),
+	)
+
+	s := table.DefaultStyles()
+	s.Header = s.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color("240")).
+		BorderBottom(true).
+		Bold(false)
+	s.Selected = s.Selected.
+		Foreground(lipgloss.Color("229")).
+		Background(lipgloss.Color("57")).
+		Bold(false)
+	t.SetStyles(s)
+
+	return &Model{
+		Table: t,
+		Help:  help.New(),
+		Keys:  keys,
+		dir:   dir,
+	}
+}
+
+func (m *Model) Init() tea.Cmd {
+	m.refresh()
+	return tick()
+}
+
+func (m *Model) refresh() {
+	entries, _ := os.ReadDir(m.dir)
+	m.files = m.files[:0]
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json.gz") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		m.files = append(m.files, file{name: entry.Name(), size: info.Size(), modified: info.ModTime()})
+	}
+	sort.Slice(m.files, func(i, j int) bool {
+		return m.files[i].modified.After(m.files[j].modified)
+	})
+
+	rows := make([]table.Row, 0, len(m.files))
+	for _, f := range m.files {
+		rows = append(rows, table.Row{
+			f.name,
+			f.modified.Format("2006-01-02 15:04:05"),
+			formatSize(f.size),
+		})
+	}
+	m.Table.SetRows(rows)
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func (m *Model) selected() (string, bool) {
+	i := m.Table.Cursor()
+	if i < 0 || i >= len(m.files) {
+		return "", false
+	}
+	return filepath.Join(m.dir, m.files[i].name), true
+}
+
+func (m *Model) setStatus(err error, format string, args ...interface{}) {
+	if err != nil {
+		m.statusMsg = err.Error()
+		m.isError = true
+		return
+	}
+	m.statusMsg = fmt.Sprintf(format, args...)
+	m.isError = false
+}
+
+func (m *Model) take() {
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		m.setStatus(err, "")
+		return
+	}
+	name := "freeport-" + time.Now().Format("20060102-150405") + ".json.gz"
+	path := filepath.Join(m.dir, name)
+
+	// Snapshots hold passkeys, so only the owner may read them.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		m.setStatus(err, "")
+		return
+	}
+	err = api.WriteSnapshot(f, api.TakeSnapshot())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	m.setStatus(err, "Saved %s", name)
+	m.refresh()
+}
+
+func (m *Model) restore(mode string) {
+	path, ok := m.selected()
+	if !ok {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		m.setStatus(err, "")
+		return
+	}
+	defer f.Close()
+
+	snapshot, err := api.ReadSnapshot(f)
+	if err != nil {
+		m.setStatus(err, "")
+		return
+	}
+	stats, err := api.RestoreSnapshot(snapshot, mode)
+	m.setStatus(err, "Restored %s (%s): %d new protocols, %d methods, %d entries",
+		filepath.Base(path), stats.Mode, stats.Protocols, stats.Methods, stats.Entries)
+}
+
+func (m *Model) Update(msg tea.Msg) (*Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tickMsg:
+		m.refresh()
+		return m, tick()
+	case tea.KeyMsg:
+		if m.Confirming {
+			m.Confirming = false
+			if msg.String() == "y" {
+				m.restore(api.RestoreReplace)
+			} else {
+				m.statusMsg = ""
+			}
+			return m, nil
+		}
+		switch msg.String() {
+		case "s":
+			m.take()
+			return m, nil
+		case "m":
+			m.restore(api.RestoreMerge)
+			return m, nil
+		case "R":
+			if path, ok := m.selected(); ok {
+				m.Confirming = true
+				m.statusMsg = fmt.Sprintf("Replace everything on the bus with %s? (y/n)", filepath.Base(path))
+				m.isError = true
+			}
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.Table, cmd = m.Table.Update(msg)
+	return m, cmd
+}
+
+func (m Model) View(width, height int) string {
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("170")).
+		Padding(1, 0)
+
+	infoStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("243"))
+
+	title := titleStyle.Render("Snapshots")
+	info := infoStyle.Render(fmt.Sprintf("\n%d archives in %s\nMerge keeps what the bus has; replace discards it first.\n", len(m.files), m.dir))
+
+	status := ""
+	if m.statusMsg != "" {
+		color := lipgloss.Color("42")
+		if m.isError {
+			color = lipgloss.Color("196")
+		}
+		status = "\n" + lipgloss.NewStyle().Foreground(color).Render(m.statusMsg)
+	}
+
+	return lipgloss.NewStyle().
+		Padding(1, 2).
+		Render(title + "\n" + info + "\n" + baseStyle.Render(m.Table.View()) + status + "\n\n" + m.Help.View(m.Keys))
+}
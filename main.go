@@ -1,25 +1,188 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 	"freeport/ui"
 	"freeport/api"
+	"freeport/cli"
+	"freeport/config"
+	"freeport/discovery"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func main() {
+	cfg := config.Load()
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:], cfg))
+	}
+
+	if cfg.AdminToken == "" {
+		cfg.AdminToken = newAdminToken()
+		cfg.Save()
+	}
+
 	server := api.NewServer("6767")
+	configureServer(server, cfg)
+	federation := startFederation(server, cfg)
+	alerts := startAlerts(server, cfg)
 	go func() {
 		if err := server.Start(); err != nil {
 			fmt.Printf("API Server Error: %v\n", err)
 		}
 	}()
 
-	p := tea.NewProgram(ui.NewModel(), tea.WithAltScreen())
+	browser := startDiscovery(cfg)
+
+	p := tea.NewProgram(ui.NewModel(server, browser, federation, alerts), tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
+
+func configureServer(server *api.Server, cfg *config.Config) {
+	read, _ := time.ParseDuration(cfg.Server.ReadTimeout)
+	write, _ := time.ParseDuration(cfg.Server.WriteTimeout)
+	idle, _ := time.ParseDuration(cfg.Server.IdleTimeout)
+	server.SetTimeouts(read, write, idle)
+	server.SetAdminToken(cfg.AdminToken)
+
+	mode, _ := strconv.ParseUint(cfg.Server.Socket.Mode, 8, 32)
+	server.SetUnixSocket(cfg.Server.Socket.Path, os.FileMode(mode))
+	server.SetTCPEnabled(!cfg.Server.Socket.DisableTCP || cfg.Server.Socket.Path == "")
+	server.SetTrustedUIDs(cfg.Server.Socket.TrustedUIDs)
+
+	api.SetDefaultLimits(api.Limits{
+		MaxPayload:        cfg.Server.Limits.MaxPayloadBytes,
+		RequestsPerSecond: cfg.Server.Limits.RequestsPerSecond,
+		Burst:             cfg.Server.Limits.Burst,
+		MaxKeys:           cfg.Server.Limits.MaxKeys,
+	})
+	for appName, limits := range cfg.ProtocolLimits {
+		api.ConfigureProtocolLimits(appName, api.Limits{
+			MaxPayload:        limits.MaxPayloadBytes,
+			RequestsPerSecond: limits.RequestsPerSecond,
+			Burst:             limits.Burst,
+			MaxKeys:           limits.MaxKeys,
+		})
+	}
+
+	api.ConfigureLogging(cfg.Logging.Dir, cfg.Logging.MaxBytes, cfg.Logging.MaxBackups)
+}
+
+// startDiscovery advertises this bus and browses for others as configured.
+// It returns the browser, or nil when browsing is off.
+func startDiscovery(cfg *config.Config) *discovery.Browser {
+	self := discovery.DefaultInstance(6767)
+
+	if cfg.Discovery.Advertise {
+		responder := discovery.NewResponder(cfg.Discovery.Address, func() discovery.Instance {
+			instance := self
+			instance.Version = api.Version
+			for _, protocol := range api.ListProtocols() {
+				instance.Protocols = append(instance.Protocols, protocol.AppName)
+			}
+			return instance
+		})
+		if err := responder.Start(); err != nil {
+			fmt.Printf("Discovery Error: %v\n", err)
+		}
+	}
+
+	if !cfg.Discovery.Browse {
+		return nil
+	}
+	interval, _ := time.ParseDuration(cfg.Discovery.Interval)
+	browser := discovery.NewBrowser(cfg.Discovery.Address, interval)
+	browser.SetSelf(self.Name)
+	if err := browser.Start(); err != nil {
+		fmt.Printf("Discovery Error: %v\n", err)
+		return nil
+	}
+	return browser
+}
+
+// startFederation links this bus to the peers in the config. It returns
+// nil when federation is not set up.
+func startFederation(server *api.Server, cfg *config.Config) *api.Federation {
+	if cfg.Federation.Token == "" && len(cfg.Federation.Links) == 0 {
+		return nil
+	}
+
+	node := cfg.Federation.Node
+	if node == "" {
+		node = discovery.DefaultInstance(6767).Name
+	}
+	federation := api.NewFederation(server.Registry(), node, cfg.Federation.Token)
+	for _, link := range cfg.Federation.Links {
+		err := federation.AddLink(api.LinkConfig{
+			Name:   link.Name,
+			URL:    link.URL,
+			Token:  link.Token,
+			Mirror: link.Mirror,
+		})
+		if err != nil {
+			fmt.Printf("Federation Error: %v\n", err)
+		}
+	}
+	server.SetFederation(federation)
+	federation.Start()
+	return federation
+}
+
+// startAlerts checks the alert rules in the config. It returns nil when
+// there are none.
+func startAlerts(server *api.Server, cfg *config.Config) *api.Alerts {
+	if len(cfg.Alerts.Rules) == 0 {
+		return nil
+	}
+
+	interval, _ := time.ParseDuration(cfg.Alerts.Interval)
+	alerts := api.NewAlerts(server.Registry(), interval)
+	for _, rule := range cfg.Alerts.Rules {
+		forDuration, err := parseOptionalDuration(rule.For)
+		if err != nil {
+			fmt.Printf("Alert Error: %s: for: %v\n", rule.Name, err)
+			continue
+		}
+		stale, err := parseOptionalDuration(rule.Stale)
+		if err != nil {
+			fmt.Printf("Alert Error: %s: stale: %v\n", rule.Name, err)
+			continue
+		}
+		err = alerts.AddRule(api.AlertRule{
+			Name:      rule.Name,
+			Source:    rule.Source,
+			Condition: rule.Condition,
+			For:       forDuration,
+			Stale:     stale,
+			Notify:    rule.Notify,
+			Webhook:   rule.Webhook,
+		})
+		if err != nil {
+			fmt.Printf("Alert Error: %v\n", err)
+		}
+	}
+	server.SetAlerts(alerts)
+	alerts.Start()
+	return alerts
+}
+
+func parseOptionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func newAdminToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
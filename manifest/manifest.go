@@ -0,0 +1,87 @@
+// Package manifest reads and writes protocol manifests as YAML or JSON.
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"freeport/api"
+)
+
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// Parse decodes a manifest. JSON is recognised by its opening brace;
+// anything else is read as YAML. Unknown fields are errors so that a typo
+// does not silently drop a setting.
+func Parse(data []byte) (*api.Manifest, error) {
+	var m api.Manifest
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		value, err := decodeYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("manifest: %w", err)
+		}
+		value = coerceStrings(value, reflect.TypeOf(m))
+		if trimmed, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&m); err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// Load reads a manifest from path, or from standard input when path is "-".
+func Load(path string) (*api.Manifest, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Encode writes m in format, FormatYAML or FormatJSON.
+func Encode(m *api.Manifest, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatJSON:
+		return append(data, '\n'), nil
+	case FormatYAML:
+		return encodeYAML(data)
+	}
+	return nil, fmt.Errorf("unknown manifest format %q", format)
+}
+
+// FormatFor picks the format from a file name, defaulting to YAML.
+func FormatFor(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return FormatJSON
+	}
+	return FormatYAML
+}
@@ -0,0 +1,255 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeYAML parses data into the same generic values encoding/json would
+// produce, so the result can be re-encoded as JSON and decoded into a type.
+// Plain numbers and booleans come back as scalars that remember their text,
+// for coerceStrings.
+func decodeYAML(data []byte) (interface{}, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	var doc yaml.Node
+	if err := decoder.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var next yaml.Node
+	if err := decoder.Decode(&next); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("line %d: only one YAML document is supported", next.Line)
+	}
+	return fromNode(&doc)
+}
+
+func fromNode(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return fromNode(n.Content[0])
+	case yaml.AliasNode:
+		return fromNode(n.Alias)
+	case yaml.SequenceNode:
+		items := make([]interface{}, 0, len(n.Content))
+		for _, child := range n.Content {
+			item, err := fromNode(child)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case yaml.MappingNode:
+		object := make(map[string]interface{}, len(n.Content)/2)
+		if err := addFields(object, n); err != nil {
+			return nil, err
+		}
+		return object, nil
+	}
+	return fromScalar(n)
+}
+
+// addFields copies the pairs of mapping n into object. Keys from a "<<"
+// merge only fill in what n does not set itself.
+func addFields(object map[string]interface{}, n *yaml.Node) error {
+	var merges []*yaml.Node
+	own := map[string]bool{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, child := n.Content[i], n.Content[i+1]
+		if key.ShortTag() == "!!merge" {
+			merges = append(merges, child)
+			continue
+		}
+		if key.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d: mapping keys must be scalars", key.Line)
+		}
+		if own[key.Value] {
+			return fmt.Errorf("line %d: duplicate key %q", key.Line, key.Value)
+		}
+		own[key.Value] = true
+		value, err := fromNode(child)
+		if err != nil {
+			return err
+		}
+		object[key.Value] = value
+	}
+
+	for _, merge := range merges {
+		if merge.Kind == yaml.AliasNode {
+			merge = merge.Alias
+		}
+		sources := []*yaml.Node{merge}
+		if merge.Kind == yaml.SequenceNode {
+			sources = merge.Content
+		}
+		for _, source := range sources {
+			if source.Kind == yaml.AliasNode {
+				source = source.Alias
+			}
+			if source.Kind != yaml.MappingNode {
+				return fmt.Errorf("line %d: << needs a mapping", merge.Line)
+			}
+			merged := map[string]interface{}{}
+			if err := addFields(merged, source); err != nil {
+				return err
+			}
+			for key, value := range merged {
+				if _, ok := object[key]; !ok {
+					object[key] = value
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func fromScalar(n *yaml.Node) (interface{}, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool", "!!int", "!!float":
+		var value interface{}
+		if err := n.Decode(&value); err != nil {
+			return nil, err
+		}
+		return scalar{value: value, text: n.Value}, nil
+	}
+	return n.Value, nil
+}
+
+// scalar is a plain number or boolean that remembers how it was written,
+// in case the field it lands in turns out to be a string.
+type scalar struct {
+	value interface{}
+	text  string
+}
+
+func (s scalar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.value)
+}
+
+// coerceStrings turns plain numbers and booleans back into the text they
+// were written as wherever t expects a string, so that "passkey: 123" needs
+// no quotes. value is updated in place and returned.
+func coerceStrings(value interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		if v, ok := value.(scalar); ok {
+			return v.text
+		}
+	case reflect.Slice:
+		if items, ok := value.([]interface{}); ok {
+			for i, item := range items {
+				items[i] = coerceStrings(item, t.Elem())
+			}
+		}
+	case reflect.Map:
+		if object, ok := value.(map[string]interface{}); ok {
+			for key, item := range object {
+				object[key] = coerceStrings(item, t.Elem())
+			}
+		}
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" {
+				name = f.Name
+			}
+			if item, ok := object[name]; ok {
+				object[name] = coerceStrings(item, f.Type)
+			}
+		}
+	}
+	return value
+}
+
+// encodeYAML writes JSON as block-style YAML, keeping object keys in the
+// order they appear in the JSON.
+func encodeYAML(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	node, err := readNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// readNode reads the next JSON value from decoder as a YAML node.
+func readNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if v == '[' {
+			node = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+		for decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			child, err := readNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		if len(node.Content) == 0 {
+			node.Style = yaml.FlowStyle
+		}
+		_, err := decoder.Token()
+		return node, err
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(v)}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(v.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}, nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: token.(string)}, nil
+}
@@ -0,0 +1,168 @@
+package manifest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDecodeYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string // the decoded value as JSON
+	}{
+		{"empty", "", `null`},
+		{"plain scalars", "a: 1\nb: 2.5\nc: true\nd: ~\ne: hello world", `{"a":1,"b":2.5,"c":true,"d":null,"e":"hello world"}`},
+		{"quoted", `a: "x: y # z"` + "\nb: 'it''s'", `{"a":"x: y # z","b":"it's"}`},
+		{"comments", "# top\na: 1 # trailing\nb: x#y", `{"a":1,"b":"x#y"}`},
+		{"nested mapping", "a:\n  b:\n    c: 1", `{"a":{"b":{"c":1}}}`},
+		{"sequence", "- 1\n- two\n-\n  - 3", `[1,"two",[3]]`},
+		{"sequence at key indent", "a:\n- 1\n- 2\nb: 3", `{"a":[1,2],"b":3}`},
+		{"sequence of mappings", "- name: a\n  x: 1\n- name: b", `[{"name":"a","x":1},{"name":"b"}]`},
+		{"flow", "a: [1, b, {c: d}]\ne: {}", `{"a":[1,"b",{"c":"d"}],"e":{}}`},
+		{"literal block", "a: |\n  one\n\n  two\nb: 1", `{"a":"one\n\ntwo\n","b":1}`},
+		{"folded block", "a: >-\n  one\n  two\n\n  three", `{"a":"one two\nthree"}`},
+		{"folded blank lines", "a: >\n  one\n\n\n  two\n", `{"a":"one\n\ntwo\n"}`},
+		{"apostrophe in a plain scalar", "description: it's hot # a comment\nb: don't", `{"b":"don't","description":"it's hot"}`},
+		{"hash inside a word", "a: it's#1 # note", `{"a":"it's#1"}`},
+		{"anchors and merges", "base: &b {x: 1, y: 2}\nc:\n  <<: *b\n  y: 3", `{"base":{"x":1,"y":2},"c":{"x":1,"y":3}}`},
+		{"document markers", "---\na: 1\n...", `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := decodeYAML([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("decodeYAML: %v", err)
+			}
+			got, err := json.Marshal(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"tab indent", "a:\n\tb: 1", "line 2:"},
+		{"duplicate key", "a: 1\na: 2", "line 2: duplicate key"},
+		{"bad indentation", "a: 1\n  b: 2", "line 2:"},
+		{"unterminated string", `a: "x`, "unexpected end of stream"},
+		{"unterminated list", "a: [1, 2", "line 1:"},
+		{"second document", "a: 1\n---\nb: 2", "line 2: only one YAML document"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeYAML([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCoercesScalarsToStrings(t *testing.T) {
+	tests := []struct {
+		name        string
+		yaml        string
+		passkey     string
+		description string
+	}{
+		{"integer passkey", "protocols:\n  - name: a\n    passkey: 123", "123", ""},
+		{"leading zeros kept", "protocols:\n  - name: a\n    passkey: 0123", "0123", ""},
+		{"float passkey", "protocols:\n  - name: a\n    passkey: 1.50", "1.50", ""},
+		{"boolean passkey", "protocols:\n  - name: a\n    passkey: True", "True", ""},
+		{"numeric description", "protocols:\n  - name: a\n    description: 42", "", "42"},
+		{"quoted stays", "protocols:\n  - name: a\n    passkey: \"007\"", "007", ""},
+		{"apostrophe before a comment", "protocols:\n  - name: a\n    description: it's hot # a comment", "", "it's hot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			p := m.Protocols[0]
+			if p.Passkey != tt.passkey || p.Description != tt.description {
+				t.Errorf("passkey %q, description %q; want %q, %q", p.Passkey, p.Description, tt.passkey, tt.description)
+			}
+		})
+	}
+}
+
+func TestParseKeepsTypedFields(t *testing.T) {
+	yaml := `version: 1
+protocols:
+  - name: 2024
+    retention: {history: 10, ttl: 30s}
+    methods:
+      - name: temp
+        schema:
+          type: object
+          required: [1]
+          properties:
+            unit: {type: string, enum: [1, true, c]}
+      - name: avg
+        derive:
+          sources: {t: 2024/temp}
+          expr: t * 2
+`
+	m, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	p := m.Protocols[0]
+	if p.Name != "2024" || p.Retention.History != 10 || p.Retention.TTL != "30s" {
+		t.Errorf("protocol = %+v, retention %+v", p, *p.Retention)
+	}
+	schema := p.Methods[0].Schema
+	if len(schema.Required) != 1 || schema.Required[0] != "1" {
+		t.Errorf("required = %v, want [\"1\"]", schema.Required)
+	}
+	enum := schema.Properties["unit"].Enum
+	if len(enum) != 3 || enum[0] != float64(1) || enum[1] != true || enum[2] != "c" {
+		t.Errorf("enum = %#v, want a number, a bool and a string", enum)
+	}
+	if src := p.Methods[1].Derive.Sources["t"]; src != "2024/temp" {
+		t.Errorf("source = %q", src)
+	}
+}
+
+func TestParseRejectsBadTypes(t *testing.T) {
+	if _, err := Parse([]byte("protocols:\n  - name: a\n    retention: {history: ten}")); err == nil {
+		t.Error("Parse accepted a string history")
+	}
+	if _, err := Parse([]byte("protocols:\n  - name: a\n    color: red")); err == nil {
+		t.Error("Parse accepted an unknown field")
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	yaml := "version: 1\nprotocols:\n  - name: a\n    passkey: \"123\"\n    methods:\n      - name: \"yes: no\"\n"
+	m, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := Encode(m, FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Parse(encoded)
+	if err != nil {
+		t.Fatalf("Parse(Encode()): %v\n%s", err, encoded)
+	}
+	if again.Protocols[0].Passkey != "123" || again.Protocols[0].Methods[0].Name != "yes: no" {
+		t.Errorf("round trip = %+v\n%s", again.Protocols[0], encoded)
+	}
+}
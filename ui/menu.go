@@ -21,7 +21,20 @@ func (m Model) updateMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, nil
 				case "Send Data":
 					m.view = DataSendView
+					m.dataSendModel.Refresh()
 					return m, nil
+				case "Monitor":
+					m.view = MonitorView
+					return m, nil
+				case "Logs":
+					m.view = LogsView
+					return m, m.logsModel.Init()
+				case "Peers":
+					m.view = PeersView
+					return m, m.peersModel.Init()
+				case "Snapshots":
+					m.view = SnapshotsView
+					return m, m.snapshotsModel.Init()
 				case "Settings":
 					m.view = SettingsView
 					return m, nil
@@ -1,12 +1,17 @@
 package ui
 
 import (
-	"fmt"
 	"freeport/api"
 	"freeport/config"
+	"freeport/discovery"
+	"freeport/features/alerts"
 	"freeport/features/dataview"
 	"freeport/features/datasend"
+	"freeport/features/logs"
+	"freeport/features/monitor"
+	"freeport/features/peers"
 	"freeport/features/settings"
+	"freeport/features/snapshots"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
@@ -22,6 +27,10 @@ const (
 	DataViewView
 	DataSendView
 	SettingsView
+	LogsView
+	MonitorView
+	PeersView
+	SnapshotsView
 )
 
 type keyMap struct {
@@ -86,17 +95,26 @@ type Model struct {
 	width    int
 	height   int
 
-	dataViewModel *dataview.Model
-	dataSendModel *datasend.Model
-	settingsModel *settings.Model
+	dataViewModel  *dataview.Model
+	dataSendModel  *datasend.Model
+	settingsModel  *settings.Model
+	logsModel      *logs.Model
+	monitorModel   *monitor.Model
+	peersModel     *peers.Model
+	snapshotsModel *snapshots.Model
+	alertsModel    *alerts.Model
 }
 
-func NewModel() Model {
+func NewModel(server *api.Server, browser *discovery.Browser, federation *api.Federation, alerting *api.Alerts) Model {
 	cfg := config.Load()
 
 	items := []list.Item{
 		item{title: "View Data", desc: "View system data and API information"},
 		item{title: "Send Data", desc: "Send data through the API bus"},
+		item{title: "Monitor", desc: "Watch live traffic on the API bus"},
+		item{title: "Logs", desc: "Browse the access log and audit trail"},
+		item{title: "Peers", desc: "Find other freeport instances and watch federation links"},
+		item{title: "Snapshots", desc: "Save bus data to an archive or restore it"},
 		item{title: "Settings", desc: "Configure application settings"},
 		item{title: "Exit", desc: "Exit the application"},
 	}
@@ -121,32 +139,40 @@ func NewModel() Model {
 
 	h := help.New()
 
+	dataViewModel := dataview.NewModel()
+	dataViewModel.SetBaseURL(cfg.BusURL())
+
 	dataSendModel := datasend.NewModel()
+	dataSendModel.SetInProcess(server.InProcessHandler())
+	dataSendModel.SetExportPath(config.ManifestPath())
 	
 	dataSendModel.SetProtocolCreatedCallback(func(p datasend.Protocol) {
-		fmt.Printf("DEBUG: Registering protocol %s with passkey %s\n", p.AppName, p.Passkey)
 		api.RegisterProtocol(p.AppName, p.Passkey, p.Description)
 	})
 	
 	dataSendModel.SetMethodCreatedCallback(func(appName, methodName, description string) {
-		fmt.Printf("DEBUG: Registering method %s for app %s\n", methodName, appName)
 		api.RegisterMethod(appName, methodName, description)
 	})
 
 	return Model{
-		list:          l,
-		help:          h,
-		keys:          keys,
-		view:          MenuView,
-		config:        cfg,
-		dataViewModel: dataview.NewModel(),
-		dataSendModel: dataSendModel,
-		settingsModel: settings.NewModel(cfg),
+		list:           l,
+		help:           h,
+		keys:           keys,
+		view:           MenuView,
+		config:         cfg,
+		dataViewModel:  dataViewModel,
+		dataSendModel:  dataSendModel,
+		settingsModel:  settings.NewModel(cfg),
+		logsModel:      logs.NewModel(),
+		monitorModel:   monitor.NewModel(),
+		peersModel:     peers.NewModel(browser, federation),
+		snapshotsModel: snapshots.NewModel(config.SnapshotDir()),
+		alertsModel:    alerts.NewModel(alerting),
 	}
 }
 
 func (m Model) Init() tea.Cmd {
-	return nil
+	return tea.Batch(m.monitorModel.Init(), m.alertsModel.Init())
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -157,6 +183,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		h, v := docStyle.GetFrameSize()
 		m.list.SetSize(msg.Width-h, msg.Height-v)
 		m.help.Width = msg.Width
+	case monitor.EventMsg:
+		var cmd tea.Cmd
+		m.monitorModel, cmd = m.monitorModel.Update(msg)
+		return m, cmd
+	}
+	if alerts.Handles(msg) {
+		var cmd tea.Cmd
+		m.alertsModel, cmd = m.alertsModel.Update(msg)
+		return m, cmd
 	}
 
 	switch m.view {
@@ -166,12 +201,30 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.updateDataSend(msg)
 	case SettingsView:
 		return m.updateSettings(msg)
+	case LogsView:
+		return m.updateLogs(msg)
+	case MonitorView:
+		return m.updateMonitor(msg)
+	case PeersView:
+		return m.updatePeers(msg)
+	case SnapshotsView:
+		return m.updateSnapshots(msg)
 	default:
 		return m.updateMenu(msg)
 	}
 }
 
+// View puts the alert notification area, when there is one, above the
+// current screen.
 func (m Model) View() string {
+	screen := m.viewScreen()
+	if area := m.alertsModel.View(m.width); area != "" {
+		return area + "\n" + screen
+	}
+	return screen
+}
+
+func (m Model) viewScreen() string {
 	switch m.view {
 	case DataViewView:
 		return m.dataViewModel.View(m.width, m.height)
@@ -179,6 +232,14 @@ func (m Model) View() string {
 		return m.dataSendModel.View(m.width, m.height)
 	case SettingsView:
 		return m.settingsModel.View(m.width, m.height)
+	case LogsView:
+		return m.logsModel.View(m.width, m.height)
+	case MonitorView:
+		return m.monitorModel.View(m.width, m.height)
+	case PeersView:
+		return m.peersModel.View(m.width, m.height)
+	case SnapshotsView:
+		return m.snapshotsModel.View(m.width, m.height)
 	default:
 		return m.viewMenu()
 	}
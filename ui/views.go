@@ -41,6 +41,78 @@ func (m Model) updateDataSend(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+func (m Model) updateLogs(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			return m, tea.Quit
+		case "esc", "b":
+			m.view = MenuView
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.logsModel, cmd = m.logsModel.Update(msg)
+	return m, cmd
+}
+
+func (m Model) updatePeers(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			return m, tea.Quit
+		case "esc", "b":
+			m.view = MenuView
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.peersModel, cmd = m.peersModel.Update(msg)
+	return m, cmd
+}
+
+func (m Model) updateSnapshots(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			return m, tea.Quit
+		case "esc", "b":
+			if !m.snapshotsModel.Confirming {
+				m.view = MenuView
+				return m, nil
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.snapshotsModel, cmd = m.snapshotsModel.Update(msg)
+	return m, cmd
+}
+
+func (m Model) updateMonitor(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			return m, tea.Quit
+		case "esc", "b":
+			if !m.monitorModel.Filtering {
+				m.view = MenuView
+				return m, nil
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.monitorModel, cmd = m.monitorModel.Update(msg)
+	return m, cmd
+}
+
 func (m Model) updateSettings(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
@@ -79,6 +151,10 @@ func (m Model) updateSettings(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case "esc", "b":
 				m.view = MenuView
 				m.settingsModel.StatusMsg = ""
+				m.settingsModel.ShowToken = false
+				return m, nil
+			case "t":
+				m.settingsModel.ShowToken = !m.settingsModel.ShowToken
 				return m, nil
 			case "e":
 				m.settingsModel.Mode = settings.EditMode